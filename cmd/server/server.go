@@ -10,6 +10,14 @@ import (
 	yaml "gopkg.in/yaml.v2"
 
 	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/core/ilm"
+	"github.com/tatris-io/tatris/internal/core/merge"
+	"github.com/tatris-io/tatris/internal/core/retention"
+	"github.com/tatris-io/tatris/internal/core/tiering"
+	"github.com/tatris-io/tatris/internal/core/wal"
+	"github.com/tatris-io/tatris/internal/input/forward"
+	"github.com/tatris-io/tatris/internal/input/syslog"
+	"github.com/tatris-io/tatris/internal/input/tail"
 
 	"github.com/alecthomas/kong"
 	"github.com/gin-gonic/gin"
@@ -75,6 +83,25 @@ func cleanHistory() {
 	}
 }
 
+// startInputs starts the enabled inputs, they run until the process exits
+func startInputs() {
+	if config.Cfg.Input.Syslog.Enabled {
+		if _, err := syslog.Start(config.Cfg.Input.Syslog); err != nil {
+			logger.Panic("fail to start the syslog input", zap.Error(err))
+		}
+	}
+	if config.Cfg.Input.Forward.Enabled {
+		if _, err := forward.Start(config.Cfg.Input.Forward); err != nil {
+			logger.Panic("fail to start the forward input", zap.Error(err))
+		}
+	}
+	if config.Cfg.Input.Tail.Enabled {
+		if _, err := tail.Start(config.Cfg.Input.Tail); err != nil {
+			logger.Panic("fail to start the tail input", zap.Error(err))
+		}
+	}
+}
+
 func main() {
 	kong.Parse(&cli, kong.Name("tatris-server"),
 		kong.Description("The Server of TATRIS project"),
@@ -96,10 +123,28 @@ func main() {
 
 	cleanHistory()
 
+	// drain the WALs left by the last run in the background, the cluster is reported healthy
+	// after that
+	wal.Recover()
+
+	// merge the small readonly segments in the background, it runs until the process exits
+	if config.Cfg.Segment.Merge.Enabled {
+		merge.Start(config.Cfg.Segment.Merge)
+	}
+	// drop the segments expired by the retention settings of the indexes in the background
+	retention.Start(config.Cfg.Segment.Retention)
+	// move the indexes through their lifecycle policies in the background
+	ilm.Start(config.Cfg.Lifecycle)
+	// move the warm segments to the object storage in the background
+	if config.Cfg.Segment.Tiering.Enabled {
+		tiering.Start(config.Cfg.Segment.Tiering)
+	}
+
 	if cli.Debug {
 		gin.SetMode(gin.DebugMode)
 	} else {
 		gin.SetMode(gin.ReleaseMode)
 	}
+	startInputs()
 	service.StartHTTPServer("all")
 }
@@ -0,0 +1,15 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package consts
+
+// actions that can be applied to a document
+const (
+	// ActionCreate indexes a document, the document is expected to be new
+	ActionCreate = "create"
+	// ActionIndex indexes a document, an existing document with the same _id is replaced
+	ActionIndex = "index"
+	// ActionUpdate partially updates an existing document with the same _id
+	ActionUpdate = "update"
+	// ActionDelete removes an existing document with the same _id
+	ActionDelete = "delete"
+)
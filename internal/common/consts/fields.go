@@ -10,3 +10,6 @@ const (
 	IndexField     = "_index"
 	TypeField      = "_type"
 )
+
+// DeadLetterIndexSuffix is appended to the name of an index to name its default dead-letter index
+const DeadLetterIndexSuffix = "-dlq"
@@ -11,7 +11,18 @@ const (
 	PathMeta      = "_meta"
 	PathWAL       = "_wal"
 	PathCache     = "_cache"
+	PathIDs       = "_ids"
 
 	DirectoryOSS = "oss"
 	PathOss      = "oss"
+
+	DirectoryS3 = "s3"
+	PathS3      = "s3"
+
+	WalTypeTidwall = "tidwall"
+	WalTypeNative  = "native"
+
+	WalCompressionNone   = "none"
+	WalCompressionSnappy = "snappy"
+	WalCompressionZstd   = "zstd"
 )
@@ -0,0 +1,22 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package consts
+
+// PipelineNone disables the default pipeline of the index
+const PipelineNone = "_none"
+
+// types of the processors in a pipeline
+const (
+	ProcessorSet       = "set"
+	ProcessorRemove    = "remove"
+	ProcessorRename    = "rename"
+	ProcessorLowercase = "lowercase"
+	ProcessorUppercase = "uppercase"
+	ProcessorConvert   = "convert"
+	ProcessorDate      = "date"
+	ProcessorGrok      = "grok"
+	ProcessorDissect   = "dissect"
+	ProcessorJSON      = "json"
+	ProcessorSplit     = "split"
+	ProcessorDrop      = "drop"
+)
@@ -0,0 +1,14 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package consts
+
+// policies of making the ingested documents visible to search
+const (
+	// RefreshFalse returns once the documents are written to the WAL, they become visible when the
+	// WAL is consumed periodically
+	RefreshFalse = "false"
+	// RefreshTrue consumes the WAL of the affected shards immediately before returning
+	RefreshTrue = "true"
+	// RefreshWaitFor waits for the periodic consumption to reach the documents before returning
+	RefreshWaitFor = "wait_for"
+)
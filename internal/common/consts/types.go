@@ -19,6 +19,7 @@ const (
 	MappingFieldTypeText            = "text"
 	MappingFieldTypeMatchOnlyText   = "match_only_text"
 	MappingFieldTypeDate            = "date"
+	MappingFieldTypeObject          = "object"
 )
 
 // field types supported by the underlying index library
@@ -37,8 +38,8 @@ const (
 	JSONFieldTypeDouble  = "double"
 	JSONFieldTypeBoolean = "boolean"
 	JSONFieldTypeDate    = "date"
+	JSONFieldTypeObject  = "object"
 	// TODO to be supported
-	// JSONFieldTypeObject  = "object"
 	// JSONFieldTypeBinary  = "binary"
 )
 
@@ -53,5 +54,6 @@ func IsJSONFieldType(t string) bool {
 	return strings.EqualFold(t, JSONFieldTypeString) || strings.EqualFold(t, JSONFieldTypeLong) ||
 		strings.EqualFold(t, JSONFieldTypeDouble) ||
 		strings.EqualFold(t, JSONFieldTypeBoolean) ||
-		strings.EqualFold(t, JSONFieldTypeDate)
+		strings.EqualFold(t, JSONFieldTypeDate) ||
+		strings.EqualFold(t, JSONFieldTypeObject)
 }
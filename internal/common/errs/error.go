@@ -120,6 +120,16 @@ func (e *InvalidFieldValError) Error() string {
 	return fmt.Sprintf("invalid field value for %s: %s, %v ", e.Type, e.Field, e.Value)
 }
 
+// IsRejection returns whether the error rejects a document because of its content, such documents
+// are never accepted however many times they are retried, and go to the dead-letter index if any
+func IsRejection(err error) bool {
+	var fieldErr *InvalidFieldError
+	var fieldValErr *InvalidFieldValError
+	var unsupportedErr *UnsupportedError
+	return err != nil && (errors.As(err, &fieldErr) || errors.As(err, &fieldValErr) ||
+		errors.As(err, &unsupportedErr))
+}
+
 type InvalidAggFieldTypeError struct {
 	Field           string `json:"field"`
 	FieldType       string `json:"type"`
@@ -215,3 +225,72 @@ type QueryLoadExceedError struct {
 func (e *QueryLoadExceedError) Error() string {
 	return fmt.Sprintf("query load exceeded: %v, %s: %v", e.Indexes, e.Message, e.Query)
 }
+
+type WalLagExceedError struct {
+	Shard   string `json:"shard"`
+	Message string `json:"message"`
+}
+
+func (e *WalLagExceedError) Error() string {
+	return fmt.Sprintf("wal lag exceeded: %s, %s", e.Shard, e.Message)
+}
+
+func IsWalLagExceed(err error) bool {
+	var walLagExceedErr *WalLagExceedError
+	return err != nil && errors.As(err, &walLagExceedErr)
+}
+
+type PipelineNotFoundError struct {
+	Pipeline string `json:"pipeline"`
+}
+
+func (e *PipelineNotFoundError) Error() string {
+	return fmt.Sprintf("pipeline not found: %s", e.Pipeline)
+}
+
+func IsPipelineNotFound(err error) bool {
+	var notFoundErr *PipelineNotFoundError
+	return err != nil && errors.As(err, &notFoundErr)
+}
+
+type LifecyclePolicyNotFoundError struct {
+	Policy string `json:"policy"`
+}
+
+func (e *LifecyclePolicyNotFoundError) Error() string {
+	return fmt.Sprintf("lifecycle policy not found: %s", e.Policy)
+}
+
+func IsLifecyclePolicyNotFound(err error) bool {
+	var notFoundErr *LifecyclePolicyNotFoundError
+	return err != nil && errors.As(err, &notFoundErr)
+}
+
+type ProcessorError struct {
+	Processor string `json:"processor"`
+	Message   string `json:"message"`
+}
+
+func (e *ProcessorError) Error() string {
+	return fmt.Sprintf("processor %s failed: %s", e.Processor, e.Message)
+}
+
+func IsProcessorError(err error) bool {
+	var processorErr *ProcessorError
+	return err != nil && errors.As(err, &processorErr)
+}
+
+// DocumentConflictError means a document is created with the _id of an existing document
+type DocumentConflictError struct {
+	Index string `json:"index"`
+	ID    string `json:"id"`
+}
+
+func (e *DocumentConflictError) Error() string {
+	return fmt.Sprintf("[%s]: version conflict, document already exists in %s", e.ID, e.Index)
+}
+
+func IsDocumentConflict(err error) bool {
+	var conflictErr *DocumentConflictError
+	return err != nil && errors.As(err, &conflictErr)
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// BloomFilter tells whether a string may have been added, it has no false negatives, and its
+// false positive rate rises above the expected one after more strings than the capacity are added
+type BloomFilter struct {
+	lock   sync.RWMutex
+	bits   []uint64
+	hashes uint64
+}
+
+// NewBloomFilter creates a bloom filter holding the capacity of strings at the false positive
+// rate
+func NewBloomFilter(capacity int, falsePositiveRate float64) *BloomFilter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	// m = -n*ln(p)/ln(2)^2, k = m/n*ln(2)
+	m := math.Ceil(-float64(capacity) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(capacity) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{
+		bits:   make([]uint64, (uint64(m)+63)/64),
+		hashes: uint64(k),
+	}
+}
+
+func (f *BloomFilter) Add(s string) {
+	h1, h2 := hashString(s)
+	size := uint64(len(f.bits)) * 64
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % size
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// MayContain returns false if the string has never been added
+func (f *BloomFilter) MayContain(s string) bool {
+	h1, h2 := hashString(s)
+	size := uint64(len(f.bits)) * 64
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % size
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalBinary encodes the bloom filter as the number of hashes followed by the bits
+func (f *BloomFilter) MarshalBinary() ([]byte, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	data := make([]byte, 8*(len(f.bits)+1))
+	binary.LittleEndian.PutUint64(data, f.hashes)
+	for i, word := range f.bits {
+		binary.LittleEndian.PutUint64(data[8*(i+1):], word)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes the bloom filter encoded by MarshalBinary
+func (f *BloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < 16 || len(data)%8 != 0 {
+		return errors.New("invalid bloom filter data")
+	}
+	bits := make([]uint64, len(data)/8-1)
+	for i := range bits {
+		bits[i] = binary.LittleEndian.Uint64(data[8*(i+1):])
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.hashes = binary.LittleEndian.Uint64(data)
+	f.bits = bits
+	return nil
+}
+
+// hashString derives the two hashes of the double hashing from a 64-bit FNV-1a hash
+func hashString(s string) (uint64, uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	sum := h.Sum64()
+	return sum & 0xffffffff, sum>>32 | 1
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloomFilter(t *testing.T) {
+	filter := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		filter.Add("id-" + strconv.Itoa(i))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.True(t, filter.MayContain("id-"+strconv.Itoa(i)))
+	}
+	falsePositives := 0
+	for i := 1000; i < 11000; i++ {
+		if filter.MayContain("id-" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 300)
+}
+
+func TestBloomFilterBinary(t *testing.T) {
+	filter := NewBloomFilter(100, 0.01)
+	for i := 0; i < 100; i++ {
+		filter.Add("id-" + strconv.Itoa(i))
+	}
+	data, err := filter.MarshalBinary()
+	assert.NoError(t, err)
+	decoded := &BloomFilter{}
+	assert.NoError(t, decoded.UnmarshalBinary(data))
+	for i := 0; i < 1000; i++ {
+		id := "id-" + strconv.Itoa(i)
+		assert.Equal(t, filter.MayContain(id), decoded.MayContain(id))
+	}
+	assert.Error(t, decoded.UnmarshalBinary(data[:7]))
+}
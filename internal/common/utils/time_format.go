@@ -0,0 +1,134 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the special time formats
+const (
+	TimeFormatISO8601 = "ISO8601"
+	TimeFormatUnix    = "UNIX"
+	TimeFormatUnixMs  = "UNIX_MS"
+)
+
+// TimeParser parses a string to time, the location is used if the string has no time zone
+type TimeParser func(string, *time.Location) (time.Time, error)
+
+// NewTimeParser returns the parser of a format, which is one of the special time formats or a
+// Java-style pattern such as `dd/MMM/yyyy:HH:mm:ss Z`
+func NewTimeParser(format string) (TimeParser, error) {
+	switch format {
+	case TimeFormatISO8601:
+		return parseISO8601, nil
+	case TimeFormatUnix:
+		return parseUnix(time.Second), nil
+	case TimeFormatUnixMs:
+		return parseUnix(time.Millisecond), nil
+	default:
+		layout, err := javaLayout(format)
+		if err != nil {
+			return nil, err
+		}
+		return func(s string, loc *time.Location) (time.Time, error) {
+			return time.ParseInLocation(layout, s, loc)
+		}, nil
+	}
+}
+
+// FormatTimeValue formats a time value to the string to be parsed by a TimeParser
+func FormatTimeValue(value any) string {
+	if f, isFloat := value.(float64); isFloat {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// ParseTimeWithFormat parses a time value by the format in UTC, the value is parsed by ParseTime
+// if the format is empty or the value is already a time
+func ParseTimeWithFormat(value any, format string) (time.Time, error) {
+	if _, ok := value.(time.Time); ok || format == "" {
+		return ParseTime(value)
+	}
+	parse, err := NewTimeParser(format)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parse(FormatTimeValue(value), time.UTC)
+}
+
+func parseISO8601(s string, loc *time.Location) (time.Time, error) {
+	for _, layout := range []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999Z0700",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02",
+	} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("[%s] is not an ISO8601 date", s)
+}
+
+func parseUnix(unit time.Duration) TimeParser {
+	return func(s string, _ *time.Location) (time.Time, error) {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, int64(f*float64(unit))), nil
+	}
+}
+
+// javaLayouts maps the letters of the Java DateTimeFormatter patterns to the Go layouts
+var javaLayouts = map[string]string{
+	"yyyy": "2006", "yy": "06", "uuuu": "2006",
+	"MMMM": "January", "MMM": "Jan", "MM": "01", "M": "1",
+	"dd": "02", "d": "2",
+	"EEEE": "Monday", "EEE": "Mon",
+	"HH": "15", "hh": "03", "h": "3",
+	"mm": "04", "m": "4",
+	"ss": "05", "s": "5",
+	"a": "PM",
+	"Z": "-0700", "ZZ": "-07:00", "XXX": "Z07:00", "XX": "Z0700", "X": "Z07",
+	"z":   "MST",
+	"SSS": "000", "SSSSSS": "000000", "SSSSSSSSS": "000000000",
+}
+
+// javaLayout converts a Java-style pattern such as `dd/MMM/yyyy:HH:mm:ss Z` to a Go layout
+func javaLayout(pattern string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		switch {
+		case c == '\'':
+			end := strings.IndexByte(pattern[i+1:], '\'')
+			if end < 0 {
+				return "", fmt.Errorf("unclosed quote in date format [%s]", pattern)
+			}
+			sb.WriteString(pattern[i+1 : i+1+end])
+			i += end + 2
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			j := i
+			for j < len(pattern) && pattern[j] == c {
+				j++
+			}
+			layout, ok := javaLayouts[pattern[i:j]]
+			if !ok {
+				return "", fmt.Errorf("unsupported [%s] in date format [%s]", pattern[i:j], pattern)
+			}
+			sb.WriteString(layout)
+			i = j
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeWithFormat(t *testing.T) {
+	expected := time.Date(2023, 1, 26, 8, 0, 40, 0, time.UTC)
+	tests := []struct {
+		value  any
+		format string
+	}{
+		{value: "2023-01-26T08:00:40Z", format: TimeFormatISO8601},
+		{value: float64(expected.Unix()), format: TimeFormatUnix},
+		{value: "1674720040000", format: TimeFormatUnixMs},
+		{value: "26/Jan/2023:08:00:40 +0000", format: "dd/MMM/yyyy:HH:mm:ss Z"},
+		{value: expected, format: "yyyy"},
+	}
+	for _, tt := range tests {
+		parsed, err := ParseTimeWithFormat(tt.value, tt.format)
+		assert.NoError(t, err)
+		assert.True(t, expected.Equal(parsed), tt.format)
+	}
+
+	_, err := ParseTimeWithFormat("2023-01-26", "dd/MM/yyyy")
+	assert.Error(t, err)
+	_, err = NewTimeParser("yyyy-MM-dd QQ")
+	assert.Error(t, err)
+}
@@ -72,6 +72,15 @@ func IsBool(value interface{}) bool {
 	}
 }
 
+func IsObject(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
 func ToFloat64(v interface{}) (float64, error) {
 	switch v := v.(type) {
 	case float64:
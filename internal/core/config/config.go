@@ -6,7 +6,9 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"regexp"
 	"sync"
+	"time"
 
 	"github.com/tatris-io/tatris/internal/common/consts"
 	"github.com/tatris-io/tatris/internal/common/log/logger"
@@ -25,12 +27,42 @@ func init() {
 			FS: &FS{
 				Path: consts.DefaultFSPath,
 			},
+			S3: &S3{
+				Region:                     "us-east-1",
+				PathStyle:                  true,
+				PartSize:                   67108864,
+				MinimumConcurrencyLoadSize: 134217728,
+			},
 		},
 		Segment: &Segment{
 			MatureThreshold: 20000,
+			MatureAge:       0,
+			MatureTimeSpan:  0,
+			LateThreshold:   0,
+			LateBucketSpan:  time.Hour,
+			Merge: &Merge{
+				Enabled:     false,
+				Interval:    time.Minute,
+				MaxDocs:     100000,
+				MinSegments: 2,
+				CleanDelay:  time.Minute,
+			},
+			Retention: &Retention{
+				Interval:   10 * time.Minute,
+				CleanDelay: time.Minute,
+			},
+			Tiering: &Tiering{
+				Enabled:    false,
+				Directory:  consts.DirectoryOSS,
+				Interval:   10 * time.Minute,
+				WarmAge:    24 * time.Hour,
+				CleanDelay: time.Minute,
+			},
 		},
 		Wal: &Wal{
+			Type:             consts.WalTypeTidwall,
 			NoSync:           false,
+			SyncInterval:     0,
 			SegmentSize:      20971520,
 			LogFormat:        0,
 			SegmentCacheSize: 3,
@@ -38,6 +70,45 @@ func init() {
 			DirPerms:         0750,
 			FilePerms:        0640,
 			Parallel:         16,
+			ConsumeBatchSize: 5000,
+			ConsumeMaxWait:   10 * time.Millisecond,
+			ConsumeInterval:  time.Second,
+			MaxLagEntries:    0,
+			MaxLagBytes:      1073741824,
+			RetryAfter:       time.Second,
+			Compression:      consts.WalCompressionZstd,
+		},
+		Input: &Input{
+			Syslog: &Syslog{
+				Enabled:        false,
+				TCP:            ":5140",
+				UDP:            ":5140",
+				Index:          "syslog-{+yyyy.MM.dd}",
+				MaxMessageSize: 65536,
+				BatchSize:      1000,
+				FlushInterval:  time.Second,
+			},
+			OTLP: &OTLP{
+				Index: "otlp-{+yyyy.MM.dd}",
+			},
+			Loki: &Loki{
+				IndexLabel:   "index",
+				DefaultIndex: "loki",
+			},
+			Forward: &Forward{
+				Enabled: false,
+				Address: ":24224",
+			},
+			Tail: &Tail{
+				Enabled:       false,
+				Index:         "tail-{+yyyy.MM.dd}",
+				PollInterval:  time.Second,
+				MaxReadBytes:  1048576,
+				MaxEventLines: 500,
+			},
+		},
+		Lifecycle: &Lifecycle{
+			Interval: 10 * time.Minute,
 		},
 		Query: &Query{
 			DefaultScanHours:            12,
@@ -53,6 +124,8 @@ type Config struct {
 	Directory *Directory `yaml:"directory"`
 	Segment   *Segment   `yaml:"segment"`
 	Wal       *Wal       `yaml:"wal"`
+	Input     *Input     `yaml:"input"`
+	Lifecycle *Lifecycle `yaml:"lifecycle"`
 	Query     *Query     `yaml:"query"`
 
 	_once   sync.Once
@@ -63,6 +136,7 @@ type Directory struct {
 	Type string `yaml:"type"`
 	FS   *FS    `yaml:"fs"`
 	OSS  *OSS   `yaml:"oss"`
+	S3   *S3    `yaml:"s3"`
 }
 
 type FS struct {
@@ -79,13 +153,98 @@ type OSS struct {
 	MinimumConcurrencyLoadSize int `yaml:"minimum_concurrency_load_size"`
 }
 
+// S3 configures the object storage speaking the S3 API, such as AWS S3, Ceph RGW and MinIO
+type S3 struct {
+	// the endpoint with the scheme, such as `https://s3.us-east-1.amazonaws.com` or
+	// `http://127.0.0.1:9000`
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	// whether the bucket is addressed by the path of the endpoint instead of its host, which is
+	// required by MinIO and Ceph RGW by default
+	PathStyle bool `yaml:"path_style"`
+	// the size of the parts of the multipart uploads, the objects larger than this are uploaded
+	// in parts. It should be at least 5MiB as required by S3.
+	PartSize int64 `yaml:"part_size"`
+	// MinimumConcurrencyLoadSize is the minimum object size to enable concurrent query.
+	// When the object size to be loaded is greater than this value, it is loaded by ranges
+	// concurrently
+	MinimumConcurrencyLoadSize int `yaml:"minimum_concurrency_load_size"`
+}
+
 type Segment struct {
+	// a writable segment matures once it holds more documents than this
 	MatureThreshold int64 `yaml:"mature_threshold"`
+	// a writable segment matures once it has been created for this long, 0 means never
+	MatureAge time.Duration `yaml:"mature_age"`
+	// a writable segment matures once the event time of its documents spans this long, 0 means
+	// never
+	MatureTimeSpan time.Duration `yaml:"mature_time_span"`
+	// the documents whose event time is earlier than now by more than this are late, they are
+	// written into the separate segments of their time buckets, 0 means they are not separated
+	LateThreshold time.Duration `yaml:"late_threshold"`
+	// the span of the time buckets of the late documents
+	LateBucketSpan time.Duration `yaml:"late_bucket_span"`
+	Merge          *Merge        `yaml:"merge"`
+	Retention      *Retention    `yaml:"retention"`
+	Tiering        *Tiering      `yaml:"tiering"`
+}
+
+// Merge configures the background merging of the small readonly segments, the adjacent ones of a
+// shard are merged into one larger segment so that fewer segments are opened by the queries
+type Merge struct {
+	Enabled bool `yaml:"enabled"`
+	// how often the shards are checked for the segments to merge
+	Interval time.Duration `yaml:"interval"`
+	// a merged segment holds at most this many documents, the segments holding more are never
+	// merged
+	MaxDocs int64 `yaml:"max_docs"`
+	// the minimum number of the adjacent segments merged at a time
+	MinSegments int `yaml:"min_segments"`
+	// how long the data of the merged segments is kept after they are swapped out, so that the
+	// queries reading them can finish
+	CleanDelay time.Duration `yaml:"clean_delay"`
+}
+
+// Retention configures the background dropping of the mature segments older than the retention
+// periods of their indexes, the indexes without the retention setting are never touched
+type Retention struct {
+	// how often the indexes are checked for the segments to drop
+	Interval time.Duration `yaml:"interval"`
+	// how long the data of the dropped segments is kept after they are removed from their
+	// shards, so that the queries reading them can finish
+	CleanDelay time.Duration `yaml:"clean_delay"`
+}
+
+// Tiering configures the background moving of the mature segments from the local file system to
+// the object storage. The segments are always written to the local file system for fast ingestion
+// and queries, and they are served by the object storage once they get warm. It requires
+// directory.type to be fs.
+type Tiering struct {
+	Enabled bool `yaml:"enabled"`
+	// the type of the object storage the segments are moved to: oss or s3, which is configured by
+	// directory.oss or directory.s3
+	Directory string `yaml:"directory"`
+	// how often the shards are checked for the segments to move
+	Interval time.Duration `yaml:"interval"`
+	// a segment is moved once it has been mature for this long
+	WarmAge time.Duration `yaml:"warm_age"`
+	// how long the local data of the moved segments is kept after they are served by the object
+	// storage, so that the queries reading them can finish
+	CleanDelay time.Duration `yaml:"clean_delay"`
 }
 
 type Wal struct {
-	NoSync      bool `yaml:"no_sync"`
-	SegmentSize int  `yaml:"segment_size"`
+	// the implementation of WAL: tidwall or native, do not change it while there are WALs not
+	// consumed yet since their formats on disk are different
+	Type   string `yaml:"type"`
+	NoSync bool   `yaml:"no_sync"`
+	// only for the native WAL: the interval of syncing the writes in the background, 0 means
+	// every write is synced before it returns and the concurrent writes share one fsync
+	SyncInterval time.Duration `yaml:"sync_interval"`
+	SegmentSize  int           `yaml:"segment_size"`
 	// 0: Binary; 1: JSON
 	LogFormat        byte        `yaml:"log_format"`
 	SegmentCacheSize int         `yaml:"segment_cache_size"`
@@ -94,6 +253,105 @@ type Wal struct {
 	FilePerms        os.FileMode `yaml:"file_perms"`
 	// the number of Goroutines used to consume WAL each time
 	Parallel int `yaml:"parallel"`
+	// the maximum number of operations consumed from the WAL of a shard at a time, the entries
+	// are consumed whole, so a batch may exceed it by the operations of its last entry
+	ConsumeBatchSize int `yaml:"consume_batch_size"`
+	// how long the consumer of a shard waits for more operations to fill a batch after it is
+	// signaled by a write, 0 means consuming immediately
+	ConsumeMaxWait time.Duration `yaml:"consume_max_wait"`
+	// the interval of consuming all the WALs periodically, which is a fallback of the
+	// consumption signaled by writes
+	ConsumeInterval time.Duration `yaml:"consume_interval"`
+	// the maximum number of entries in the WAL of a shard that are written but not consumed yet,
+	// writes to the shard are rejected with 429 once it is exceeded, 0 means no limit.
+	// Each write to a shard takes one entry, whatever the number of operations it carries.
+	MaxLagEntries uint64 `yaml:"max_lag_entries"`
+	// the maximum bytes of the WAL segments of a shard holding entries not consumed yet, writes to
+	// the shard are rejected with 429 once it is exceeded, 0 means no limit
+	MaxLagBytes int64 `yaml:"max_lag_bytes"`
+	// how long the rejected clients are advised to wait before retrying, it is carried by the
+	// Retry-After header
+	RetryAfter time.Duration `yaml:"retry_after"`
+	// how the records written to the WAL are compressed: none, snappy or zstd
+	Compression string `yaml:"compression"`
+}
+
+// Input configures the inputs that receive logs by protocols other than the HTTP APIs
+type Input struct {
+	Syslog  *Syslog  `yaml:"syslog"`
+	OTLP    *OTLP    `yaml:"otlp"`
+	Loki    *Loki    `yaml:"loki"`
+	Forward *Forward `yaml:"forward"`
+	Tail    *Tail    `yaml:"tail"`
+}
+
+type Syslog struct {
+	Enabled bool `yaml:"enabled"`
+	// the address to receive syslog over TCP, frames are delimited by newlines or prefixed with
+	// their lengths (RFC 6587), empty means not listening on TCP
+	TCP string `yaml:"tcp"`
+	// the address to receive syslog over UDP, one frame per datagram, empty means not listening
+	// on UDP
+	UDP string `yaml:"udp"`
+	// the target index, `{field}` is replaced with the field of the parsed message such as
+	// `{app}` and `{host}`, `{+yyyy.MM.dd}` is replaced with the formatted @timestamp
+	Index string `yaml:"index"`
+	// the maximum bytes of a frame, the longer ones are discarded
+	MaxMessageSize int `yaml:"max_message_size"`
+	// the maximum number of messages ingested at a time
+	BatchSize int `yaml:"batch_size"`
+	// the longest time that a received message waits to be ingested
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+// OTLP configures the OTLP/HTTP logs receiver at `/v1/logs`
+type OTLP struct {
+	// the target index, `{field}` is replaced with the field of the decoded record such as
+	// `{resource.service.name}`, `{+yyyy.MM.dd}` is replaced with the formatted @timestamp
+	Index string `yaml:"index"`
+}
+
+// Loki configures the Loki push API at `/loki/api/v1/push`
+type Loki struct {
+	// the label whose value is the target index of a stream, empty means all the streams are
+	// ingested into the default index
+	IndexLabel string `yaml:"index_label"`
+	// the target index of the streams without the index label
+	DefaultIndex string `yaml:"default_index"`
+}
+
+// Forward configures the input of the Fluent forward protocol, which receives the events forwarded
+// by Fluentd or Fluent Bit and ingests them into the indexes named after their lowercased tags
+type Forward struct {
+	Enabled bool `yaml:"enabled"`
+	// the TCP address to listen on
+	Address string `yaml:"address"`
+}
+
+// Tail configures the input that tails the local files, the read offsets are persisted in the
+// metadata so that the tailing resumes after restarts
+type Tail struct {
+	Enabled bool `yaml:"enabled"`
+	// the glob patterns of the files to tail, such as `/var/log/app/*.log`
+	Paths []string `yaml:"paths"`
+	// the target index, `{+yyyy.MM.dd}` is replaced with the formatted @timestamp
+	Index string `yaml:"index"`
+	// a line matching the regex starts a new event and the following lines not matching it are
+	// joined to the event, such as `^\d{4}-` for the stack traces, empty means each line is an
+	// event
+	MultilinePattern string `yaml:"multiline_pattern"`
+	// how often the files are checked for the new lines and the paths are globbed again
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// the maximum bytes read from a file at a time, a longer line is split
+	MaxReadBytes int `yaml:"max_read_bytes"`
+	// the maximum lines joined into an event, the following lines start a new event
+	MaxEventLines int `yaml:"max_event_lines"`
+}
+
+// Lifecycle configures the scheduler moving the indexes through their lifecycle policies
+type Lifecycle struct {
+	// how often the indexes are checked against their policies
+	Interval time.Duration `yaml:"interval"`
 }
 
 type Query struct {
@@ -129,6 +387,12 @@ func (dir *Directory) verify() {
 	if dir.Type == consts.DirectoryOSS {
 		dir.OSS.verify()
 	}
+	if dir.Type == consts.DirectoryS3 {
+		if dir.S3 == nil {
+			panic("directory.s3 must be specified when directory type is s3")
+		}
+		dir.S3.verify()
+	}
 }
 
 func (fs *FS) verify() {
@@ -159,13 +423,86 @@ func (oss *OSS) verify() {
 	}
 }
 
+func (s3 *S3) verify() {
+	if s3.Endpoint == "" || s3.Bucket == "" || s3.AccessKeyID == "" ||
+		s3.SecretAccessKey == "" {
+		panic("directory.s3.endpoint, bucket, access_key_id and secret_access_key must be specified")
+	}
+	if s3.Region == "" {
+		panic("directory.s3.region must be specified")
+	}
+	if s3.PartSize < 5*1024*1024 {
+		panic("directory.s3.part_size should be at least 5MiB")
+	}
+}
+
 func (s *Segment) verify() {
 	if s.MatureThreshold <= 0 {
 		panic("segment.mature_threshold should be positive")
 	}
+	if s.MatureAge < 0 || s.MatureTimeSpan < 0 || s.LateThreshold < 0 {
+		panic("segment.mature_age, mature_time_span and late_threshold should not be negative")
+	}
+	if s.LateThreshold > 0 && s.LateBucketSpan <= 0 {
+		panic("segment.late_bucket_span should be positive when late_threshold is set")
+	}
+	if m := s.Merge; m != nil && m.Enabled {
+		if m.Interval <= 0 || m.MaxDocs <= 0 {
+			panic("segment.merge.interval and max_docs should be positive")
+		}
+		if m.MinSegments < 2 {
+			panic("segment.merge.min_segments should be at least 2")
+		}
+		if m.CleanDelay < 0 {
+			panic("segment.merge.clean_delay should not be negative")
+		}
+	}
+	if r := s.Retention; r != nil {
+		if r.Interval <= 0 {
+			panic("segment.retention.interval should be positive")
+		}
+		if r.CleanDelay < 0 {
+			panic("segment.retention.clean_delay should not be negative")
+		}
+	}
+}
+
+func (t *Tiering) verify(dir *Directory) {
+	if t == nil || !t.Enabled {
+		return
+	}
+	if t.Interval <= 0 {
+		panic("segment.tiering.interval should be positive")
+	}
+	if t.WarmAge < 0 || t.CleanDelay < 0 {
+		panic("segment.tiering.warm_age and clean_delay should not be negative")
+	}
+	if dir.Type != consts.DirectoryFS {
+		panic("segment.tiering requires directory.type to be fs")
+	}
+	switch t.Directory {
+	case consts.DirectoryOSS:
+		if dir.OSS == nil {
+			panic("directory.oss must be specified when segment.tiering.directory is oss")
+		}
+		dir.OSS.verify()
+	case consts.DirectoryS3:
+		if dir.S3 == nil {
+			panic("directory.s3 must be specified when segment.tiering.directory is s3")
+		}
+		dir.S3.verify()
+	default:
+		panic("segment.tiering.directory should be oss or s3")
+	}
 }
 
 func (w *Wal) verify() {
+	if w.Type != consts.WalTypeTidwall && w.Type != consts.WalTypeNative {
+		panic("wal.type should be tidwall or native")
+	}
+	if w.SyncInterval < 0 {
+		panic("wal.sync_interval should not be negative")
+	}
 	if w.LogFormat > 1 {
 		panic("wal.log_format should be 0 for binary format or 1 for JSON format")
 	}
@@ -178,6 +515,103 @@ func (w *Wal) verify() {
 	if w.Parallel <= 0 {
 		panic("wal.parallel should be positive")
 	}
+	if w.ConsumeBatchSize <= 0 {
+		panic("wal.consume_batch_size should be positive")
+	}
+	if w.ConsumeMaxWait < 0 {
+		panic("wal.consume_max_wait should not be negative")
+	}
+	if w.ConsumeInterval <= 0 {
+		panic("wal.consume_interval should be positive")
+	}
+	if w.MaxLagBytes < 0 {
+		panic("wal.max_lag_bytes should not be negative")
+	}
+	if w.RetryAfter <= 0 {
+		panic("wal.retry_after should be positive")
+	}
+	switch w.Compression {
+	case consts.WalCompressionNone, consts.WalCompressionSnappy, consts.WalCompressionZstd:
+	default:
+		panic("wal.compression should be one of none, snappy and zstd")
+	}
+}
+
+func (i *Input) verify() {
+	i.Syslog.verify()
+	i.OTLP.verify()
+	i.Loki.verify()
+	i.Forward.verify()
+	i.Tail.verify()
+}
+
+func (s *Syslog) verify() {
+	if !s.Enabled {
+		return
+	}
+	if s.TCP == "" && s.UDP == "" {
+		panic("input.syslog.tcp or input.syslog.udp should be specified")
+	}
+	if s.Index == "" {
+		panic("input.syslog.index should be specified")
+	}
+	if s.MaxMessageSize <= 0 {
+		panic("input.syslog.max_message_size should be positive")
+	}
+	if s.BatchSize <= 0 {
+		panic("input.syslog.batch_size should be positive")
+	}
+	if s.FlushInterval <= 0 {
+		panic("input.syslog.flush_interval should be positive")
+	}
+}
+
+func (o *OTLP) verify() {
+	if o.Index == "" {
+		panic("input.otlp.index should be specified")
+	}
+}
+
+func (l *Loki) verify() {
+	if l.DefaultIndex == "" {
+		panic("input.loki.default_index should be specified")
+	}
+}
+
+func (f *Forward) verify() {
+	if f.Enabled && f.Address == "" {
+		panic("input.forward.address should be specified")
+	}
+}
+
+func (t *Tail) verify() {
+	if !t.Enabled {
+		return
+	}
+	if len(t.Paths) == 0 {
+		panic("input.tail.paths should be specified")
+	}
+	if t.Index == "" {
+		panic("input.tail.index should be specified")
+	}
+	if _, err := regexp.Compile(t.MultilinePattern); err != nil {
+		panic("input.tail.multiline_pattern should be a valid regex")
+	}
+	if t.PollInterval <= 0 {
+		panic("input.tail.poll_interval should be positive")
+	}
+	if t.MaxReadBytes <= 0 {
+		panic("input.tail.max_read_bytes should be positive")
+	}
+	if t.MaxEventLines <= 0 {
+		panic("input.tail.max_event_lines should be positive")
+	}
+}
+
+func (l *Lifecycle) verify() {
+	if l.Interval <= 0 {
+		panic("lifecycle.interval should be positive")
+	}
 }
 
 func (q *Query) verify() {
@@ -187,7 +621,10 @@ func (q *Query) verify() {
 func (cfg *Config) doVerify() {
 	cfg.Directory.verify()
 	cfg.Segment.verify()
+	cfg.Segment.Tiering.verify(cfg.Directory)
 	cfg.Wal.verify()
+	cfg.Input.verify()
+	cfg.Lifecycle.verify()
 	cfg.Query.verify()
 }
 
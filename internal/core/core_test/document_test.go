@@ -4,6 +4,7 @@ package core_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/tatris-io/tatris/internal/common/utils"
 
@@ -342,3 +343,114 @@ func TestCheckDocuments(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckObjectDocuments(t *testing.T) {
+	index := &core.Index{
+		Index: &protocol.Index{
+			Name: "object_mappings",
+			Mappings: &protocol.Mappings{
+				Dynamic: consts.DynamicMappingMode,
+				DynamicTemplates: []map[string]*protocol.DynamicTemplate{
+					{"labels_as_keyword": &protocol.DynamicTemplate{
+						MatchMappingType: consts.JSONFieldTypeString,
+						PathMatch:        "kubernetes.labels.*",
+						Mapping: &protocol.DynamicTemplateMapping{
+							Type: consts.MappingFieldTypeKeyword,
+						},
+					}},
+				},
+				Properties: map[string]*protocol.Property{
+					consts.IDField:        {Type: consts.MappingFieldTypeKeyword},
+					consts.TimestampField: {Type: consts.MappingFieldTypeDate},
+					"kubernetes": {
+						Type: consts.MappingFieldTypeObject,
+						Properties: map[string]*protocol.Property{
+							"pod": {
+								Type: consts.MappingFieldTypeObject,
+								Properties: map[string]*protocol.Property{
+									"name": {Type: consts.MappingFieldTypeKeyword},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	docs := []protocol.Document{
+		{
+			consts.IDField:        "123456789",
+			consts.TimestampField: "2023-02-22T19:47:36.499723+08:00",
+			"kubernetes": map[string]any{
+				"pod":       map[string]any{"name": "tatris-0", "restarts": 1},
+				"labels":    map[string]any{"app": "tatris"},
+				"namespace": "default",
+			},
+			"message.level": "info",
+		},
+	}
+	assert.NoError(t, core.BuildDocuments(index, docs))
+	expectedTypes := map[string]string{
+		"kubernetes":              consts.MappingFieldTypeObject,
+		"kubernetes.pod":          consts.MappingFieldTypeObject,
+		"kubernetes.pod.name":     consts.MappingFieldTypeKeyword,
+		"kubernetes.pod.restarts": consts.MappingFieldTypeLong,
+		"kubernetes.labels":       consts.MappingFieldTypeObject,
+		"kubernetes.labels.app":   consts.MappingFieldTypeKeyword,
+		"kubernetes.namespace":    consts.MappingFieldTypeText,
+		"message":                 consts.MappingFieldTypeObject,
+		"message.level":           consts.MappingFieldTypeText,
+	}
+	for path, expected := range expectedTypes {
+		property, ok := index.Mappings.GetProperty(path)
+		assert.True(t, ok, path)
+		assert.Equal(t, expected, property.Type, path)
+	}
+
+	// an object can not be indexed into a leaf field
+	docs = []protocol.Document{
+		{
+			consts.IDField:        "123456789",
+			consts.TimestampField: "2023-02-22T19:47:36.499723+08:00",
+			"kubernetes":          map[string]any{"pod": map[string]any{"name": map[string]any{}}},
+		},
+	}
+	assert.Error(t, core.BuildDocuments(index, docs))
+}
+
+func TestBuildDocumentsWithTimestampField(t *testing.T) {
+	index := &core.Index{
+		Index: &protocol.Index{
+			Name: "timestamp_field",
+			Mappings: &protocol.Mappings{
+				Dynamic:   consts.DynamicMappingMode,
+				Timestamp: &protocol.Timestamp{Field: "event.created", Format: "UNIX_MS"},
+				Properties: map[string]*protocol.Property{
+					consts.IDField: {Type: consts.MappingFieldTypeKeyword},
+					"event": {
+						Type: consts.MappingFieldTypeObject,
+						Properties: map[string]*protocol.Property{
+							"created": {Type: consts.MappingFieldTypeDate},
+						},
+					},
+				},
+			},
+		},
+	}
+	docs := []protocol.Document{
+		{"event": map[string]any{"created": float64(1674720040000)}, "message": "created"},
+		{"message": "now"},
+	}
+	assert.NoError(t, core.BuildDocuments(index, docs))
+	created, ok := docs[0].Get("event.created")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1674720040000), created.(time.Time).UnixMilli())
+	// the missing event time is filled with the current time
+	_, ok = docs[1].Get("event.created")
+	assert.True(t, ok)
+	_, ok = docs[0][consts.TimestampField]
+	assert.False(t, ok)
+
+	docs = []protocol.Document{{"event": map[string]any{"created": "yesterday"}}}
+	assert.Error(t, core.BuildDocuments(index, docs))
+}
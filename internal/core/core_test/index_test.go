@@ -4,6 +4,7 @@ package core_test
 
 import (
 	"math"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -46,17 +47,22 @@ func TestIndex(t *testing.T) {
 		for i := 0; i < index.GetShardNum(); i++ {
 			assert.NotNil(t, index.GetShard(i))
 		}
-		assert.NotNil(t, index.GetShardByRouting())
+		assert.NotNil(t, index.GetShardByRouting("elasticsearch"))
 		reader, err := index.GetReadersByTime(start.Unix(), time.Now().UnixMilli())
 		if reader != nil {
 			defer reader.Close()
 		}
 		assert.NoError(t, err)
-		assert.Equal(
-			t,
-			(int)(math.Ceil((float64(len(docs)))/(float64(config.Cfg.Segment.MatureThreshold)))),
-			reader.Count(),
-		)
+		segmentNum := 0
+		docNum := int64(0)
+		for _, shard := range index.GetShards() {
+			segmentNum += (int)(
+				math.Ceil((float64(shard.Stat.DocNum)) / (float64(config.Cfg.Segment.MatureThreshold))),
+			)
+			docNum += shard.Stat.DocNum
+		}
+		assert.Equal(t, int64(len(docs)), docNum)
+		assert.Equal(t, segmentNum, reader.Count())
 
 		resp, err := query.SearchDocs(
 			[]*core.Index{index}, protocol.QueryRequest{
@@ -112,3 +118,25 @@ func TestSegmentReader(t *testing.T) {
 
 	assert.Equal(t, core.SegmentStatusReadonly, segment.Status())
 }
+
+func TestShardRouting(t *testing.T) {
+	index := &core.Index{Index: &protocol.Index{Name: "routing"}}
+	for i := 0; i < 3; i++ {
+		index.Shards = append(index.Shards, &core.Shard{Index: index, ShardID: i})
+	}
+
+	// the same routing is always routed to the same shard
+	for i := 0; i < 100; i++ {
+		routing := strconv.Itoa(i)
+		assert.Same(t, index.GetShardByRouting(routing), index.GetShardByRouting(routing))
+	}
+
+	// different routings are spread over all shards
+	hits := make(map[int]int)
+	for i := 0; i < 300; i++ {
+		hits[index.GetShardByRouting(strconv.Itoa(i)).ShardID]++
+	}
+	assert.Equal(t, 3, len(hits))
+
+	assert.Nil(t, (&core.Index{Index: &protocol.Index{Name: "empty"}}).GetShardByRouting("1"))
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package core_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/ingestion"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/tatris-io/tatris/test/ut/prepare"
+)
+
+func TestSegmentMature(t *testing.T) {
+	cfg := *config.Cfg.Segment
+	defer func() {
+		*config.Cfg.Segment = cfg
+	}()
+	config.Cfg.Segment.MatureAge = time.Hour
+	config.Cfg.Segment.MatureTimeSpan = 6 * time.Hour
+
+	now := time.Now()
+	segment := &core.Segment{
+		Stat: core.SegmentStat{
+			Stat: core.Stat{CreateTime: now.Add(-2 * time.Hour).UnixMilli()},
+		},
+		SegmentStatus: core.SegmentStatusWritable,
+	}
+	// an empty segment never matures by time
+	assert.False(t, segment.IsMature())
+	// matures by age
+	segment.Stat.DocNum = 1
+	segment.Stat.MinTime = now.UnixMilli()
+	segment.Stat.MaxTime = now.UnixMilli()
+	assert.True(t, segment.IsMature())
+	segment.Stat.CreateTime = now.UnixMilli()
+	assert.False(t, segment.IsMature())
+	// matures by the time span of its documents
+	segment.Stat.MinTime = now.Add(-7 * time.Hour).UnixMilli()
+	assert.True(t, segment.IsMature())
+	segment.Stat.MinTime = now.Add(-5 * time.Hour).UnixMilli()
+	assert.False(t, segment.IsMature())
+	// matures by the number of its documents
+	segment.Stat.DocNum = config.Cfg.Segment.MatureThreshold + 1
+	assert.True(t, segment.IsMature())
+}
+
+func TestSegmentIDsReload(t *testing.T) {
+	index, err := prepare.CreateIndex(
+		strings.ReplaceAll(
+			time.Now().Format(consts.TimeFmtWithoutSeparator),
+			consts.Dot,
+			consts.Empty,
+		),
+	)
+	assert.NoError(t, err)
+	ids := []string{"reload-1", "reload-2", "reload-3"}
+	ops := make([]*protocol.Operation, len(ids))
+	for i, id := range ids {
+		ops[i] = &protocol.Operation{
+			Action:   consts.ActionCreate,
+			ID:       id,
+			Document: protocol.Document{"name": id},
+		}
+	}
+	results, err := ingestion.IngestOperations(index, ops)
+	assert.NoError(t, err)
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+		result := result
+		assert.Eventually(t, func() bool {
+			return result.Shard.GetWalIndex() >= result.WalIndex
+		}, 10*time.Second, 100*time.Millisecond)
+	}
+	// the _ids are saved once the segments mature
+	for _, shard := range index.GetShards() {
+		shard.ForceAddSegment()
+	}
+
+	// reload the index from its metadata as the server does after restarts
+	data, err := json.Marshal(index)
+	assert.NoError(t, err)
+	reloaded := &core.Index{}
+	assert.NoError(t, json.Unmarshal(data, reloaded))
+	for _, shard := range reloaded.Shards {
+		shard.Index = reloaded
+		for _, segment := range shard.Segments {
+			segment.Shard = shard
+		}
+	}
+	for _, id := range ids {
+		shard := reloaded.GetShardByRouting(id)
+		_, _, conflicts, err := shard.WriteUnique(
+			[]*protocol.Operation{{
+				Action:   consts.ActionCreate,
+				ID:       id,
+				Document: protocol.Document{"name": id},
+			}},
+			func([]*protocol.Operation) (uint64, error) {
+				t.Errorf("duplicate _id %s is written", id)
+				return 0, nil
+			},
+		)
+		assert.NoError(t, err)
+		assert.True(t, errs.IsDocumentConflict(conflicts[0]))
+	}
+	// the _ids never written are ruled out by the loaded _ids without searching the segments
+	loaded := 0
+	for _, shard := range reloaded.Shards {
+		for _, segment := range shard.Segments {
+			if segment.Stat.DocNum == 0 {
+				continue
+			}
+			assert.FileExists(
+				t,
+				path.Join(config.Cfg.GetFSPath(), consts.PathIDs, segment.GetName()),
+			)
+			assert.False(t, segment.MayContain("reload-0"))
+			loaded++
+		}
+	}
+	assert.NotZero(t, loaded)
+}
+
+func TestMergeSegments(t *testing.T) {
+	index, err := prepare.CreateIndex(
+		strings.ReplaceAll(
+			time.Now().Format(consts.TimeFmtWithoutSeparator),
+			consts.Dot,
+			consts.Empty,
+		),
+	)
+	assert.NoError(t, err)
+	// the documents routed to one shard span several pages of the merge
+	shard := index.GetShardByRouting("merge-0")
+	ids := make([]string, 0)
+	for i := 0; len(ids) < 2500; i++ {
+		id := fmt.Sprintf("merge-%d", i)
+		if index.GetShardByRouting(id) == shard {
+			ids = append(ids, id)
+		}
+	}
+	ops := make([]*protocol.Operation, len(ids))
+	for i, id := range ids {
+		ops[i] = &protocol.Operation{
+			Action:   consts.ActionCreate,
+			ID:       id,
+			Document: protocol.Document{"name": id},
+		}
+	}
+	results, err := ingestion.IngestOperations(index, ops)
+	assert.NoError(t, err)
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+		result := result
+		assert.Eventually(t, func() bool {
+			return result.Shard.GetWalIndex() >= result.WalIndex
+		}, 10*time.Second, 100*time.Millisecond)
+	}
+	shard.ForceAddSegment()
+
+	segments := make([]*core.Segment, 0)
+	for _, segment := range shard.GetSegments() {
+		if segment.Status() == core.SegmentStatusReadonly && segment.Stat.DocNum > 0 {
+			segments = append(segments, segment)
+		}
+	}
+	assert.NotEmpty(t, segments)
+	merged, err := shard.MergeSegments(shard.AllocateSegmentID(), segments)
+	if err != nil {
+		t.Fatalf("merge segments fail: %s", err.Error())
+	}
+	defer func() {
+		assert.NoError(t, merged.RemoveData())
+	}()
+	// every document is read once
+	assert.Equal(t, int64(len(ids)), merged.Stat.DocNum)
+	for _, id := range ids {
+		assert.True(t, merged.MayContain(id))
+	}
+}
@@ -19,6 +19,8 @@ func BuildDocuments(
 	index *Index,
 	docs []protocol.Document,
 ) error {
+	timestampField := index.Mappings.TimestampField()
+	timestampFormat := index.Mappings.TimestampFormat()
 	for _, doc := range docs {
 		var err error
 		docID := ""
@@ -32,14 +34,18 @@ func BuildDocuments(
 			}
 			docID = genID
 		}
-		if timestamp, ok := doc[consts.TimestampField]; ok && timestamp != nil {
-			docTimestamp, err = utils.ParseTime(timestamp)
+		if timestamp, ok := doc.Get(timestampField); ok && timestamp != nil {
+			docTimestamp, err = utils.ParseTimeWithFormat(timestamp, timestampFormat)
 			if err != nil {
-				return err
+				return &errs.InvalidFieldValError{
+					Field: timestampField,
+					Type:  consts.MappingFieldTypeDate,
+					Value: timestamp,
+				}
 			}
 		}
 		doc[consts.IDField] = docID
-		doc[consts.TimestampField] = docTimestamp
+		doc.Set(timestampField, docTimestamp)
 		err = CheckDocument(index, doc)
 		if err != nil {
 			return err
@@ -48,90 +54,252 @@ func BuildDocuments(
 	return nil
 }
 
+// BuildOperations builds the operations one by one, it stops at the first failure.
+func BuildOperations(
+	index *Index,
+	ops []*protocol.Operation,
+) error {
+	for _, op := range ops {
+		if err := BuildOperation(index, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildOperation builds the documents carried by an operation, the _id of the operation is
+// determined after building.
+func BuildOperation(
+	index *Index,
+	op *protocol.Operation,
+) error {
+	switch op.Action {
+	case consts.ActionCreate, consts.ActionIndex:
+		if op.Document == nil {
+			return &errs.InvalidFieldError{
+				Field:   consts.SourceField,
+				Message: "must be specified for " + op.Action,
+			}
+		}
+		// the _id of the operation is taken unless the document carries its own
+		if _, ok := op.Document[consts.IDField]; !ok && op.ID != "" {
+			op.Document[consts.IDField] = op.ID
+		}
+		id, ok := op.Document[consts.IDField]
+		op.AutoID = !ok || id == nil || id == ""
+		if err := BuildDocuments(index, []protocol.Document{op.Document}); err != nil {
+			return err
+		}
+		op.ID = op.Document[consts.IDField].(string)
+	case consts.ActionUpdate:
+		if op.ID == "" {
+			return &errs.InvalidFieldError{
+				Field:   consts.IDField,
+				Message: "must be specified for update",
+			}
+		}
+		if err := buildPartialDocument(index, op.Document); err != nil {
+			return err
+		}
+		if op.Upsert != nil {
+			op.Upsert[consts.IDField] = op.ID
+			if err := BuildDocuments(index, []protocol.Document{op.Upsert}); err != nil {
+				return err
+			}
+		}
+	case consts.ActionDelete:
+		if op.ID == "" {
+			return &errs.InvalidFieldError{
+				Field:   consts.IDField,
+				Message: "must be specified for delete",
+			}
+		}
+	default:
+		return &errs.UnsupportedError{Desc: "action", Value: op.Action}
+	}
+	return nil
+}
+
+// buildPartialDocument builds the partial document of an update, the fields absent from it are
+// taken from the existing document when it is merged, so no _id or event time is generated here.
+func buildPartialDocument(index *Index, doc protocol.Document) error {
+	if _, ok := doc[consts.IDField]; ok {
+		return &errs.InvalidFieldError{Field: consts.IDField, Message: "can not be updated"}
+	}
+	timestampField := index.Mappings.TimestampField()
+	if timestamp, ok := doc.Get(timestampField); ok && timestamp != nil {
+		docTimestamp, err := utils.ParseTimeWithFormat(timestamp, index.Mappings.TimestampFormat())
+		if err != nil {
+			return &errs.InvalidFieldValError{
+				Field: timestampField,
+				Type:  consts.MappingFieldTypeDate,
+				Value: timestamp,
+			}
+		}
+		doc.Set(timestampField, docTimestamp)
+	}
+	return CheckDocument(index, doc)
+}
+
+// MergeDocument merges a partial document into a copy of the existing document, nested objects
+// are merged recursively.
+func MergeDocument(existing, partial protocol.Document) protocol.Document {
+	merged := make(protocol.Document, len(existing)+len(partial))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range partial {
+		pv, pok := v.(map[string]any)
+		ev, eok := merged[k].(map[string]any)
+		if pok && eok {
+			merged[k] = map[string]any(MergeDocument(ev, pv))
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
 func CheckDocument(index *Index, doc protocol.Document) error {
 	if index.Index == nil || index.Mappings == nil || index.Mappings.Properties == nil {
 		return errs.ErrEmptyMappings
 	}
 
 	mappings := index.Mappings
-	properties := mappings.Properties
-	iDynamic := mappings.Dynamic
-	dynamicTemplates := mappings.DynamicTemplates
-
 	newProperties := make(map[string]*protocol.Property)
+	err := checkFields(
+		mappings.Dynamic,
+		mappings.DynamicTemplates,
+		mappings.Properties,
+		"",
+		doc,
+		newProperties,
+	)
+	if err != nil {
+		return err
+	}
+	index.AddProperties(newProperties)
+	return nil
+}
 
-	for k, v := range doc {
+// checkFields checks the fields of a document or an object, the subfields of an object are
+// checked recursively with their dotted paths, e.g. `kubernetes.pod.name`.
+// The new valid fields deduced by dynamic mode are collected into newProperties by their paths.
+func checkFields(
+	dynamic string,
+	dynamicTemplates []map[string]*protocol.DynamicTemplate,
+	properties map[string]*protocol.Property,
+	prefix string,
+	fields map[string]any,
+	newProperties map[string]*protocol.Property,
+) error {
+	for k, v := range fields {
+		path := k
+		if prefix != "" {
+			path = prefix + consts.Dot + k
+		}
+		// the field name may be a dotted path too
+		property, mapped := protocol.GetProperty(properties, k)
 		// get field-level dynamic mode
-		fDynamic := fieldLevelDynamic(iDynamic, properties, k)
+		fDynamic := fieldLevelDynamic(dynamic, property)
 		// get field type, possibly deduced by dynamic mode and value if not explicitly defined
-		fType, err := fieldType(fDynamic, dynamicTemplates, properties, k, v)
+		fType, err := fieldType(fDynamic, dynamicTemplates, property, k, path, v)
 		if err != nil {
 			return err
 		}
 		if fType == "" {
 			continue
 		}
+		if object, ok := v.(map[string]any); ok &&
+			strings.EqualFold(fType, consts.MappingFieldTypeObject) {
+			// the subfields inherit the dynamic mode of the object
+			var subProperties map[string]*protocol.Property
+			if mapped {
+				subProperties = property.Properties
+			}
+			err = checkFields(
+				fDynamic,
+				dynamicTemplates,
+				subProperties,
+				path,
+				object,
+				newProperties,
+			)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 		// check if field type and value are compatible
-		err = checkValue(fType, k, v)
+		err = checkValue(fType, path, v)
 		if err != nil {
 			return err
 		}
 		// if new valid field types have been deduced, store them into the index metadata
-		if _, ok := properties[k]; !ok && strings.EqualFold(iDynamic, consts.DynamicMappingMode) {
-			newProperties[k] = &protocol.Property{
+		if !mapped && strings.EqualFold(dynamic, consts.DynamicMappingMode) {
+			newProperties[path] = &protocol.Property{
 				Type:    fType,
 				Dynamic: consts.DynamicMappingMode,
 			}
 		}
 	}
-	index.AddProperties(newProperties)
 	return nil
 }
 
 func fieldType(
 	dynamic string,
 	dynamicTemplates []map[string]*protocol.DynamicTemplate,
-	properties map[string]*protocol.Property,
+	property *protocol.Property,
 	field string,
+	path string,
 	value interface{},
 ) (string, error) {
 	// if the field has been explicitly defined, return
-	if property, ok := properties[field]; ok && property.Type != "" {
+	if property != nil && property.Type != "" {
 		return property.Type, nil
 	}
 	// otherwise, try to get dynamic type
-	return dynamicFieldType(dynamic, dynamicTemplates, field, value)
+	return dynamicFieldType(dynamic, dynamicTemplates, field, path, value)
 }
 
 func dynamicFieldType(
 	dynamic string,
 	dynamicTemplates []map[string]*protocol.DynamicTemplate,
 	field string,
+	path string,
 	value interface{},
 ) (string, error) {
 	switch dynamic {
 	case consts.DynamicMappingMode:
 		// if a dynamic template is matched, apply its specified type
-		if t, matched := matchDynamicTemplate(dynamicTemplates, field, value); matched {
+		if t, matched := matchDynamicTemplate(dynamicTemplates, field, path, value); matched {
 			return t, nil
 		}
+		// an object is mapped by its subfields
+		if _, ok := value.(map[string]any); ok {
+			return consts.MappingFieldTypeObject, nil
+		}
 		// deduce from value
 		if t, deduced := indexlib.DeduceType(value); deduced {
 			return t, nil
 		}
-		return "", &errs.InvalidFieldValError{Field: field, Value: value}
+		return "", &errs.InvalidFieldValError{Field: path, Value: value}
 	case consts.IgnoreMappingMode:
 		return "", nil
 	case consts.StrictMappingMode:
-		return "", &errs.InvalidFieldValError{Field: field, Type: "_strict", Value: value}
+		return "", &errs.InvalidFieldValError{Field: path, Type: "_strict", Value: value}
 	default:
 		return "", &errs.UnsupportedError{Desc: "dynamic mode", Value: dynamic}
 	}
 }
 
+// matchDynamicTemplate returns the mapping type of the first dynamic template matching the field,
+// `match` and `unmatch` test the name of the field while `path_match` and `path_unmatch` test its
+// dotted path.
 func matchDynamicTemplate(
 	dynamicTemplates []map[string]*protocol.DynamicTemplate,
 	field string,
+	path string,
 	value any,
 ) (string, bool) {
 	for _, dynamicTemplate := range dynamicTemplates {
@@ -142,12 +310,24 @@ func matchDynamicTemplate(
 			if dt.Unmatch != "" && utils.Match(dt.Unmatch, field, dt.MatchPattern) {
 				continue
 			}
+			if dt.PathMatch != "" && !utils.Match(dt.PathMatch, path, dt.MatchPattern) {
+				continue
+			}
+			if dt.PathUnmatch != "" && utils.Match(dt.PathUnmatch, path, dt.MatchPattern) {
+				continue
+			}
+			// an object is only matched by the templates matching the object mapping type
+			if utils.IsObject(value) !=
+				strings.EqualFold(dt.MatchMappingType, consts.JSONFieldTypeObject) {
+				continue
+			}
 			if dt.MatchMappingType != "" &&
 				!(strings.EqualFold(dt.MatchMappingType, consts.JSONFieldTypeString) && utils.IsString(value) ||
 					strings.EqualFold(dt.MatchMappingType, consts.JSONFieldTypeLong) && utils.IsInteger(value) ||
 					strings.EqualFold(dt.MatchMappingType, consts.JSONFieldTypeDouble) && utils.IsFloat(value) ||
 					strings.EqualFold(dt.MatchMappingType, consts.JSONFieldTypeBoolean) && utils.IsBool(value) ||
-					strings.EqualFold(dt.MatchMappingType, consts.JSONFieldTypeDate) && utils.IsDateType(value)) {
+					strings.EqualFold(dt.MatchMappingType, consts.JSONFieldTypeDate) && utils.IsDateType(value) ||
+					strings.EqualFold(dt.MatchMappingType, consts.JSONFieldTypeObject) && utils.IsObject(value)) {
 				continue
 			}
 			return dt.Mapping.Type, true
@@ -163,15 +343,9 @@ func checkValue(t string, field string, value any) error {
 	return &errs.InvalidFieldValError{Field: field, Type: t, Value: value}
 }
 
-func fieldLevelDynamic(
-	dynamic string,
-	properties map[string]*protocol.Property,
-	fieldName string,
-) string {
-	if property, ok := properties[fieldName]; ok {
-		if property.Dynamic != "" {
-			return property.Dynamic
-		}
+func fieldLevelDynamic(dynamic string, property *protocol.Property) string {
+	if property != nil && property.Dynamic != "" {
+		return property.Dynamic
 	}
 	return dynamic
 }
@@ -0,0 +1,354 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package ilm moves the indexes through the phases of their lifecycle policies in the background
+package ilm
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/core/merge"
+	"github.com/tatris-io/tatris/internal/core/tiering"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/xhit/go-str2duration/v2"
+	"go.uber.org/zap"
+)
+
+// rolloverPattern matches the names of the indexes that can be rolled over, such as `logs-000001`
+var rolloverPattern = regexp.MustCompile(`^(.*-)(\d+)$`)
+
+// Scheduler checks the managed indexes periodically, and takes the actions of their policies.
+// An index enters the next phase of its policy once all the actions of its current phase are
+// taken and it is old enough. The failed actions are retried at the next check.
+type Scheduler struct {
+	options *config.Lifecycle
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Start starts checking the indexes in the background, the returned scheduler should be stopped
+// by Stop
+func Start(options *config.Lifecycle) *Scheduler {
+	s := &Scheduler{
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	logger.Info("lifecycle scheduler started", zap.Duration("interval", options.Interval))
+	return s
+}
+
+// Stop stops checking, the check in progress is finished first
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+		for _, index := range metadata.GetAllIndexes() {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+			if err := CheckIndex(index, time.Now()); err != nil {
+				logger.Warn(
+					"lifecycle check failed",
+					zap.String("index", index.Name),
+					zap.Error(err),
+				)
+			}
+		}
+	}
+}
+
+// CheckIndex takes the actions of the lifecycle policy of the index as of now, the state of the
+// index in the policy is persisted along with the index
+func CheckIndex(index *core.Index, now time.Time) error {
+	name := index.Settings.LifecycleName()
+	if name == "" {
+		return nil
+	}
+	state := protocol.LifecycleState{
+		Phase:      protocol.LifecyclePhaseNew,
+		PhaseTime:  now.UnixMilli(),
+		Action:     protocol.LifecycleActionComplete,
+		ActionTime: now.UnixMilli(),
+	}
+	if current := index.GetLifecycle(); current != nil {
+		state = *current
+	}
+	deleted, err := step(index, name, &state, now)
+	if deleted {
+		return nil
+	}
+	state.Error = ""
+	if err != nil {
+		state.Error = err.Error()
+	}
+	// the state is swapped as a whole because it is read by the writes concurrently
+	if current := index.GetLifecycle(); current == nil || *current != state {
+		index.SetLifecycle(&state)
+		if saveErr := metadata.SaveIndex(index); saveErr != nil {
+			return saveErr
+		}
+	}
+	return err
+}
+
+// Age returns how old the index is in its lifecycle policy, which counts from its rollover if it
+// has been rolled over, or from its creation
+func Age(index *core.Index, now time.Time) time.Duration {
+	origin := index.GetCreateTime()
+	if lifecycle := index.GetLifecycle(); lifecycle != nil && lifecycle.RolloverTime > 0 {
+		origin = lifecycle.RolloverTime
+	}
+	return now.Sub(time.UnixMilli(origin))
+}
+
+// step takes the actions of the index one by one, and enters the next phases when the actions of
+// the current phase are all taken. It returns whether the index is deleted.
+func step(
+	index *core.Index,
+	name string,
+	state *protocol.LifecycleState,
+	now time.Time,
+) (bool, error) {
+	policy, err := metadata.GetLifecyclePolicyExplicitly(name)
+	if err != nil {
+		return false, err
+	}
+	for {
+		if state.Action != protocol.LifecycleActionComplete {
+			phase := policy.Phase(state.Phase)
+			done, err := take(index, phase, state, now)
+			if err != nil || !done {
+				return false, err
+			}
+			logger.Info(
+				"lifecycle action taken",
+				zap.String("index", index.Name),
+				zap.String("phase", state.Phase),
+				zap.String("action", state.Action),
+			)
+			if state.Action == protocol.LifecycleActionDelete {
+				return true, nil
+			}
+			state.Action = nextAction(phase, state.Action)
+			state.ActionTime = now.UnixMilli()
+			continue
+		}
+		next := nextPhase(policy, state.Phase)
+		if next == "" {
+			return false, nil
+		}
+		phase := policy.Phase(next)
+		minAge, err := parseDuration(phase.MinAge)
+		if err != nil || Age(index, now) < minAge {
+			return false, err
+		}
+		state.Phase = next
+		state.PhaseTime = now.UnixMilli()
+		state.Action = nextAction(phase, "")
+		state.ActionTime = now.UnixMilli()
+		logger.Info(
+			"lifecycle phase entered",
+			zap.String("index", index.Name),
+			zap.String("policy", name),
+			zap.String("phase", next),
+		)
+	}
+}
+
+// take takes the current action of the index, it returns false if the action is waiting for its
+// conditions
+func take(
+	index *core.Index,
+	phase *protocol.LifecyclePhase,
+	state *protocol.LifecycleState,
+	now time.Time,
+) (bool, error) {
+	if phase == nil || phase.Actions == nil {
+		// the phase has been removed from the policy
+		return true, nil
+	}
+	switch state.Action {
+	case protocol.LifecycleActionRollover:
+		if phase.Actions.Rollover == nil || state.RolloverTime > 0 {
+			return true, nil
+		}
+		ready, err := readyToRollover(index, phase.Actions.Rollover, now)
+		if err != nil || !ready {
+			return false, err
+		}
+		// the index stops being the write index of the alias before the next index is attached to
+		// the alias, so that the writes never go to both of them
+		previous := index.GetLifecycle()
+		rolled := *state
+		rolled.RolloverTime = now.UnixMilli()
+		index.SetLifecycle(&rolled)
+		if err = rollover(index); err != nil {
+			index.SetLifecycle(previous)
+			return false, err
+		}
+		state.RolloverTime = rolled.RolloverTime
+		return true, nil
+	case protocol.LifecycleActionForceMerge:
+		if phase.Actions.ForceMerge == nil {
+			return true, nil
+		}
+		options := *config.Cfg.Segment.Merge
+		options.MinSegments = 2
+		if phase.Actions.ForceMerge.MaxDocs > 0 {
+			options.MaxDocs = phase.Actions.ForceMerge.MaxDocs
+		}
+		for _, shard := range index.GetShards() {
+			if err := merge.MergeShard(shard, &options); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case protocol.LifecycleActionMigrate:
+		if phase.Actions.Migrate == nil {
+			return true, nil
+		}
+		// the object storage is only configured along with the tiering
+		if !config.Cfg.Segment.Tiering.Enabled {
+			return false, errors.New("migrate requires segment.tiering to be enabled")
+		}
+		options := *config.Cfg.Segment.Tiering
+		options.WarmAge = 0
+		for _, shard := range index.GetShards() {
+			if err := tiering.MoveShard(shard, &options, now); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case protocol.LifecycleActionDelete:
+		if phase.Actions.Delete == nil {
+			return true, nil
+		}
+		if err := metadata.DeleteIndex(index.Name); err != nil && !errs.IsIndexNotFound(err) {
+			return false, err
+		}
+		return true, nil
+	default:
+		return true, nil
+	}
+}
+
+// readyToRollover returns whether any of the conditions of the rollover is met
+func readyToRollover(
+	index *core.Index,
+	action *protocol.RolloverAction,
+	now time.Time,
+) (bool, error) {
+	if action.MaxDocs > 0 && index.GetDocNum() >= action.MaxDocs {
+		return true, nil
+	}
+	if action.MaxAge == "" {
+		return false, nil
+	}
+	maxAge, err := parseDuration(action.MaxAge)
+	if err != nil {
+		return false, err
+	}
+	return now.Sub(time.UnixMilli(index.GetCreateTime())) >= maxAge, nil
+}
+
+// rollover creates the next index of the rollover alias with the settings and the mappings of the
+// index, and points the alias to it. The old index keeps the alias so that it is still searched
+// through the alias.
+func rollover(index *core.Index) error {
+	alias := index.Settings.RolloverAlias()
+	if alias == "" {
+		return errors.New("rollover_alias is not set")
+	}
+	name, err := nextIndexName(index.Name)
+	if err != nil {
+		return err
+	}
+	if _, err = metadata.GetIndexExplicitly(name); errs.IsIndexNotFound(err) {
+		err = metadata.CreateIndex(&core.Index{Index: &protocol.Index{
+			Name:     name,
+			Settings: index.Settings,
+			Mappings: index.Mappings,
+		}})
+	}
+	if err != nil {
+		return err
+	}
+	if err = metadata.AddAlias(&protocol.AliasTerm{Index: name, Alias: alias}); err != nil {
+		return err
+	}
+	logger.Info(
+		"rollover index",
+		zap.String("index", index.Name),
+		zap.String("alias", alias),
+		zap.String("next", name),
+	)
+	return nil
+}
+
+// nextIndexName increments the number at the end of the index name, keeping its width
+func nextIndexName(name string) (string, error) {
+	matches := rolloverPattern.FindStringSubmatch(name)
+	if matches == nil {
+		return "", fmt.Errorf("index name %s does not end with a number to rollover", name)
+	}
+	n, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%0*d", matches[1], len(matches[2]), n+1), nil
+}
+
+// parseDuration parses the duration like `7d`, empty means 0
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return str2duration.ParseDuration(value)
+}
+
+// nextPhase returns the next phase defined by the policy, empty if there is none
+func nextPhase(policy *protocol.LifecyclePolicy, phase string) string {
+	passed := phase == protocol.LifecyclePhaseNew
+	for _, name := range protocol.LifecyclePhaseNames {
+		if passed && policy.Phase(name) != nil {
+			return name
+		}
+		passed = passed || name == phase
+	}
+	return ""
+}
+
+// nextAction returns the action of the phase following the action, or `complete` if there is none
+func nextAction(phase *protocol.LifecyclePhase, action string) string {
+	passed := action == ""
+	for _, name := range phase.ActionNames() {
+		if passed {
+			return name
+		}
+		passed = name == action
+	}
+	return protocol.LifecycleActionComplete
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package ilm
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/ingestion"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+func TestNextIndexName(t *testing.T) {
+	name, err := nextIndexName("logs-000001")
+	assert.NoError(t, err)
+	assert.Equal(t, "logs-000002", name)
+	name, err = nextIndexName("logs-a-99")
+	assert.NoError(t, err)
+	assert.Equal(t, "logs-a-100", name)
+	_, err = nextIndexName("logs")
+	assert.Error(t, err)
+}
+
+func TestCheckIndex(t *testing.T) {
+	version := strings.ReplaceAll(
+		time.Now().Format(consts.TimeFmtWithoutSeparator),
+		consts.Dot,
+		consts.Empty,
+	)
+	alias := "ilm_" + version
+	policy := &protocol.LifecyclePolicy{
+		Name: "policy_" + version,
+		Phases: &protocol.LifecyclePhases{
+			Hot: &protocol.LifecyclePhase{
+				Actions: &protocol.LifecycleActions{
+					Rollover: &protocol.RolloverAction{MaxDocs: 2},
+				},
+			},
+			Delete: &protocol.LifecyclePhase{
+				MinAge:  "1d",
+				Actions: &protocol.LifecycleActions{Delete: &protocol.DeleteAction{}},
+			},
+		},
+	}
+	assert.NoError(t, metadata.CheckLifecyclePolicy(policy))
+	assert.NoError(t, metadata.SaveLifecyclePolicy(policy))
+	index := &core.Index{Index: &protocol.Index{
+		Name: alias + "-000001",
+		Settings: &protocol.Settings{
+			Lifecycle: &protocol.Lifecycle{Name: policy.Name, RolloverAlias: alias},
+		},
+	}}
+	assert.NoError(t, metadata.CreateIndex(index))
+	assert.NoError(t, metadata.AddAlias(&protocol.AliasTerm{Index: index.Name, Alias: alias}))
+
+	// the writes to the alias go to the index
+	writeIndex, err := metadata.ResolveWriteIndex(alias)
+	assert.NoError(t, err)
+	assert.Equal(t, index.Name, writeIndex.Name)
+
+	now := time.Now()
+	assert.NoError(t, CheckIndex(index, now))
+	assert.Equal(t, protocol.LifecyclePhaseHot, index.Lifecycle.Phase)
+	assert.Equal(t, protocol.LifecycleActionRollover, index.Lifecycle.Action)
+
+	// the index being rolled over keeps taking the writes until the next index is attached
+	state := *index.GetLifecycle()
+	rolling := state
+	rolling.RolloverTime = now.UnixMilli()
+	index.SetLifecycle(&rolling)
+	writeIndex, err = metadata.ResolveWriteIndex(alias)
+	assert.NoError(t, err)
+	assert.Equal(t, index.Name, writeIndex.Name)
+	index.SetLifecycle(&state)
+
+	results, err := ingestion.IngestDocs(writeIndex, []protocol.Document{
+		{"name": "tatris"},
+		{"name": "elasticsearch"},
+	}, "")
+	assert.NoError(t, err)
+	for _, result := range results {
+		result := result
+		assert.Eventually(t, func() bool {
+			return result.Shard.GetWalIndex() >= result.WalIndex
+		}, 10*time.Second, 100*time.Millisecond)
+	}
+
+	// the index is rolled over once it has enough documents
+	assert.NoError(t, CheckIndex(index, now))
+	assert.Equal(t, protocol.LifecycleActionComplete, index.Lifecycle.Action)
+	assert.Greater(t, index.Lifecycle.RolloverTime, int64(0))
+	writeIndex, err = metadata.ResolveWriteIndex(alias)
+	assert.NoError(t, err)
+	assert.Equal(t, alias+"-000002", writeIndex.Name)
+	assert.Equal(t, policy.Name, writeIndex.Settings.LifecycleName())
+	indexes, err := metadata.ResolveIndexes(alias)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(indexes))
+
+	// the index is deleted once it has been rolled over for a day
+	assert.NoError(t, CheckIndex(index, now.Add(time.Hour)))
+	assert.Equal(t, protocol.LifecyclePhaseHot, index.Lifecycle.Phase)
+	assert.NoError(t, CheckIndex(index, now.Add(25*time.Hour)))
+	_, err = metadata.GetIndexExplicitly(index.Name)
+	assert.True(t, errs.IsIndexNotFound(err))
+}
+
+func TestMigrate(t *testing.T) {
+	version := strings.ReplaceAll(
+		time.Now().Format(consts.TimeFmtWithoutSeparator),
+		consts.Dot,
+		consts.Empty,
+	)
+	policy := &protocol.LifecyclePolicy{
+		Name: "policy_migrate_" + version,
+		Phases: &protocol.LifecyclePhases{
+			Warm: &protocol.LifecyclePhase{
+				Actions: &protocol.LifecycleActions{Migrate: &protocol.MigrateAction{}},
+			},
+		},
+	}
+	assert.NoError(t, metadata.CheckLifecyclePolicy(policy))
+	assert.NoError(t, metadata.SaveLifecyclePolicy(policy))
+	index := &core.Index{Index: &protocol.Index{
+		Name: "ilm_migrate_" + version,
+		Settings: &protocol.Settings{
+			Lifecycle: &protocol.Lifecycle{Name: policy.Name},
+		},
+	}}
+	assert.NoError(t, metadata.CreateIndex(index))
+
+	// the action waits for the object storage of the tiering, and is retried at the next check
+	assert.False(t, config.Cfg.Segment.Tiering.Enabled)
+	assert.Error(t, CheckIndex(index, time.Now()))
+	assert.Equal(t, protocol.LifecyclePhaseWarm, index.Lifecycle.Phase)
+	assert.Equal(t, protocol.LifecycleActionMigrate, index.Lifecycle.Action)
+	assert.NotEmpty(t, index.Lifecycle.Error)
+}
@@ -4,12 +4,14 @@
 package core
 
 import (
+	"hash/fnv"
 	"os"
 	"path"
 	"strings"
 	"sync"
 
 	"github.com/tatris-io/tatris/internal/indexlib/bluge/directory/oss"
+	"github.com/tatris-io/tatris/internal/indexlib/bluge/directory/s3"
 
 	"github.com/tatris-io/tatris/internal/common/consts"
 
@@ -30,7 +32,10 @@ import (
 type Index struct {
 	*protocol.Index
 	Shards []*Shard `json:"shards"`
-	lock   sync.RWMutex
+	// Lifecycle is where the index is in its lifecycle policy, nil if it is not managed or has not
+	// been checked yet
+	Lifecycle *protocol.LifecycleState `json:"lifecycle,omitempty"`
+	lock      sync.RWMutex
 }
 
 func (index *Index) GetName() string {
@@ -49,6 +54,43 @@ func (index *Index) GetShard(idx int) *Shard {
 	return index.Shards[idx]
 }
 
+// GetCreateTime returns when the index was created in milliseconds, which is when its shards were
+// created
+func (index *Index) GetCreateTime() int64 {
+	var createTime int64
+	for _, shard := range index.Shards {
+		if createTime == 0 || shard.Stat.CreateTime < createTime {
+			createTime = shard.Stat.CreateTime
+		}
+	}
+	return createTime
+}
+
+// GetDocNum returns the number of the documents of the index
+func (index *Index) GetDocNum() int64 {
+	var docs int64
+	for _, shard := range index.Shards {
+		docs += shard.Stat.DocNum
+	}
+	return docs
+}
+
+// GetLifecycle returns where the index is in its lifecycle policy, the returned state is never
+// changed, since the state is swapped as a whole by SetLifecycle
+func (index *Index) GetLifecycle() *protocol.LifecycleState {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	return index.Lifecycle
+}
+
+// SetLifecycle swaps the state of the index in its lifecycle policy, the state should not be
+// changed afterwards since it is read by the writes concurrently
+func (index *Index) SetLifecycle(state *protocol.LifecycleState) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	index.Lifecycle = state
+}
+
 func (index *Index) AddProperties(addProperties map[string]*protocol.Property) {
 	if len(addProperties) > 0 {
 		index.lock.Lock()
@@ -58,22 +100,24 @@ func (index *Index) AddProperties(addProperties map[string]*protocol.Property) {
 			properties[name] = property
 		}
 		for name, addProperty := range addProperties {
-			properties[name] = &protocol.Property{
-				Type:    addProperty.Type,
-				Dynamic: addProperty.Dynamic,
-			}
+			protocol.PutProperty(properties, name, addProperty)
 		}
 		index.Mappings.Properties = properties
 	}
 }
 
-// GetShardByRouting
-// TODO: build the real route, temporarily think that there is always only 1 shard
-func (index *Index) GetShardByRouting() *Shard {
-	for _, shard := range index.Shards {
-		return shard
+// GetShardByRouting routes to a shard by the hash of the routing value, which is the document's
+// _id unless an explicit routing is specified by the client.
+// The same routing value is always routed to the same shard as long as the number of shards stays
+// unchanged.
+func (index *Index) GetShardByRouting(routing string) *Shard {
+	shardNum := len(index.Shards)
+	if shardNum == 0 {
+		return nil
 	}
-	return nil
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(routing))
+	return index.Shards[h.Sum32()%uint32(shardNum)]
 }
 
 func (index *Index) GetReadersByTime(start, end int64) (indexlib.Reader, error) {
@@ -131,6 +175,10 @@ func (index *Index) Destroy() error {
 	wp := path.Join(config.Cfg.GetFSPath(), consts.PathWAL, index.GetName())
 	err3 := os.RemoveAll(wp)
 
+	// clear fs ids dir
+	ip := path.Join(config.Cfg.GetFSPath(), consts.PathIDs, index.GetName())
+	err4 := os.RemoveAll(ip)
+
 	if err1 != nil {
 		logger.Error(
 			"clear fs data dir fail",
@@ -158,8 +206,22 @@ func (index *Index) Destroy() error {
 		return err3
 	}
 
-	// clear oss data objects
-	if strings.EqualFold(consts.DirectoryOSS, config.Cfg.Directory.Type) {
+	if err4 != nil {
+		logger.Error(
+			"clear fs ids dir fail",
+			zap.String("index", index.GetName()),
+			zap.Error(err4),
+		)
+		return err4
+	}
+
+	// clear oss data objects, including the ones of the segments moved by the tiering
+	tiering := config.Cfg.Segment.Tiering
+	tieringTo := func(directory string) bool {
+		return tiering != nil && tiering.Enabled && tiering.Directory == directory
+	}
+	if strings.EqualFold(consts.DirectoryOSS, config.Cfg.Directory.Type) ||
+		tieringTo(consts.DirectoryOSS) {
 		var err error
 		defaultCli, err := oss.DefaultClient()
 		if err == nil {
@@ -204,5 +266,25 @@ func (index *Index) Destroy() error {
 		}
 	}
 
+	// clear s3 data objects, including the ones of the segments moved by the tiering
+	if strings.EqualFold(consts.DirectoryS3, config.Cfg.Directory.Type) ||
+		tieringTo(consts.DirectoryS3) {
+		client, err := s3.DefaultClient()
+		if err == nil {
+			err = client.DeleteObjectsByPrefix(
+				config.Cfg.Directory.S3.Bucket,
+				s3.Path(index.GetName()),
+			)
+		}
+		if err != nil {
+			logger.Error(
+				"clear s3 objects fail",
+				zap.String("index", index.GetName()),
+				zap.Error(err),
+			)
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,172 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package merge merges the small readonly segments of the shards in the background
+package merge
+
+import (
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/core/wal"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"go.uber.org/zap"
+)
+
+// Merger checks the shards of all the indexes periodically, and merges the runs of their adjacent
+// readonly segments into larger segments.
+// A merged segment is written aside first, then swapped in for the segments merged while the WAL
+// of the shard is not consumed. The merging is abandoned if any of the segments merged has deleted
+// documents meanwhile.
+type Merger struct {
+	options *config.Merge
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Start starts merging in the background, the returned merger should be stopped by Stop
+func Start(options *config.Merge) *Merger {
+	m := &Merger{
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go m.run()
+	logger.Info(
+		"segment merger started",
+		zap.Duration("interval", options.Interval),
+		zap.Int64("maxDocs", options.MaxDocs),
+	)
+	return m
+}
+
+// Stop stops merging, the merging in progress is finished first
+func (m *Merger) Stop() {
+	close(m.stop)
+	<-m.done
+}
+
+func (m *Merger) run() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-m.stop:
+			return
+		}
+		for _, index := range metadata.GetAllIndexes() {
+			for _, shard := range index.GetShards() {
+				select {
+				case <-m.stop:
+					return
+				default:
+				}
+				if err := MergeShard(shard, m.options); err != nil {
+					logger.Warn(
+						"merge segments failed",
+						zap.String("shard", shard.GetName()),
+						zap.Error(err),
+					)
+				}
+			}
+		}
+	}
+}
+
+// MergeShard merges the runs of the adjacent small readonly segments of the shard one by one
+func MergeShard(shard *core.Shard, options *config.Merge) error {
+	for _, run := range pickRuns(shard.GetSegments(), options.MaxDocs, options.MinSegments) {
+		if err := merge(shard, run, options.CleanDelay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pickRuns picks the runs of the adjacent readonly segments to merge, the documents of a run are
+// no more than maxDocs, and a run has at least minSegments segments.
+// The segments of the late documents are only merged with the ones of the same time bucket, and the
+// segments moved to the object storage are only merged with each other.
+func pickRuns(segments []*core.Segment, maxDocs int64, minSegments int) [][]*core.Segment {
+	runs := make([][]*core.Segment, 0)
+	run := make([]*core.Segment, 0)
+	var docs int64
+	flush := func() {
+		if len(run) >= minSegments {
+			runs = append(runs, run)
+		}
+		run = make([]*core.Segment, 0)
+		docs = 0
+	}
+	for _, segment := range segments {
+		if segment.Status() != core.SegmentStatusReadonly || segment.Stat.DocNum >= maxDocs {
+			flush()
+			continue
+		}
+		if len(run) > 0 && (segment.Late != run[0].Late ||
+			segment.LateBucket != run[0].LateBucket ||
+			segment.GetDirectory() != run[0].GetDirectory() ||
+			docs+segment.Stat.DocNum > maxDocs) {
+			flush()
+		}
+		run = append(run, segment)
+		docs += segment.Stat.DocNum
+	}
+	flush()
+	return runs
+}
+
+// merge merges the segments into a new segment and swaps it in for them, the data of the merged
+// segments is removed after cleanDelay.
+func merge(shard *core.Shard, segments []*core.Segment, cleanDelay time.Duration) error {
+	start := time.Now()
+	docNums := make([]int64, len(segments))
+	for i, segment := range segments {
+		docNums[i] = segment.Stat.DocNum
+	}
+	// the ID is persisted before the data is written, so that it is never reused after restarts
+	segmentID := shard.AllocateSegmentID()
+	if err := metadata.SaveIndex(shard.Index); err != nil {
+		return err
+	}
+	merged, err := shard.MergeSegments(segmentID, segments)
+	if err != nil {
+		return err
+	}
+
+	unlock := wal.LockConsumption(shard)
+	changed := false
+	for i, segment := range segments {
+		changed = changed || segment.Stat.DocNum != docNums[i]
+	}
+	swapped := !changed && shard.ReplaceSegments(segments, merged)
+	if swapped {
+		err = metadata.SaveIndex(shard.Index)
+	}
+	unlock()
+	if !swapped {
+		logger.Info(
+			"segments changed while merging, the merged segment is discarded",
+			zap.String("segment", merged.GetName()),
+		)
+		core.RemoveSegmentData([]*core.Segment{merged}, 0)
+		return nil
+	}
+	if err != nil {
+		// the old segments are still referred to by the persisted metadata
+		return err
+	}
+	logger.Info(
+		"merge segments",
+		zap.String("shard", shard.GetName()),
+		zap.Int("segments", len(segments)),
+		zap.String("merged", merged.GetName()),
+		zap.Int64("docNum", merged.Stat.DocNum),
+		zap.Duration("took", time.Since(start)),
+	)
+	core.RemoveSegmentData(segments, cleanDelay)
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package merge
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/ingestion"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/tatris-io/tatris/internal/query"
+	"github.com/tatris-io/tatris/test/ut/prepare"
+)
+
+func dataPath(segment *core.Segment) string {
+	return path.Join(config.Cfg.GetFSPath(), consts.PathData, segment.GetName())
+}
+
+func TestPickRuns(t *testing.T) {
+	segment := func(docs int64, status uint8, late bool) *core.Segment {
+		return &core.Segment{
+			Stat:          core.SegmentStat{Stat: core.Stat{DocNum: docs}},
+			SegmentStatus: status,
+			Late:          late,
+		}
+	}
+	readonly, writable := core.SegmentStatusReadonly, core.SegmentStatusWritable
+	segments := []*core.Segment{
+		segment(10, readonly, false),
+		segment(20, readonly, false),
+		// a large segment breaks the run
+		segment(100, readonly, false),
+		segment(30, readonly, false),
+		segment(40, readonly, false),
+		// the run is split to keep its documents no more than the max
+		segment(50, readonly, false),
+		// the segments of the late documents are merged apart
+		segment(5, readonly, true),
+		segment(5, readonly, true),
+		segment(10, writable, false),
+	}
+	runs := pickRuns(segments, 100, 2)
+	assert.Equal(t, [][]*core.Segment{
+		segments[0:2],
+		segments[3:5],
+		segments[6:8],
+	}, runs)
+	assert.Equal(t, 2, len(pickRuns(segments, 150, 3)))
+}
+
+func TestMergeShard(t *testing.T) {
+	index, err := prepare.CreateIndex(
+		strings.ReplaceAll(
+			time.Now().Format(consts.TimeFmtWithoutSeparator),
+			consts.Dot,
+			consts.Empty,
+		),
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, index)
+
+	count := func() int64 {
+		resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+			Index: index.Name,
+			Query: protocol.Query{MatchAll: &protocol.MatchAll{}},
+			Size:  0,
+		})
+		assert.NoError(t, err)
+		return resp.Hits.Total.Value
+	}
+
+	// write a few small segments in each shard
+	total := 0
+	for i := 0; i < 3; i++ {
+		docs := make([]protocol.Document, 0)
+		for j := 0; j < 6; j++ {
+			docs = append(docs, protocol.Document{"name": strconv.Itoa(total)})
+			total++
+		}
+		results, err := ingestion.IngestDocs(index, docs, "")
+		assert.NoError(t, err)
+		for _, result := range results {
+			result := result
+			assert.Eventually(t, func() bool {
+				return result.Shard.GetWalIndex() >= result.WalIndex
+			}, 10*time.Second, 100*time.Millisecond)
+		}
+		for _, shard := range index.GetShards() {
+			shard.ForceAddSegment()
+		}
+	}
+	assert.Equal(t, int64(total), count())
+
+	options := &config.Merge{
+		Enabled:     true,
+		Interval:    time.Minute,
+		MaxDocs:     100,
+		MinSegments: 2,
+	}
+	for _, shard := range index.GetShards() {
+		merged := make([]*core.Segment, 0)
+		for _, run := range pickRuns(shard.GetSegments(), options.MaxDocs, options.MinSegments) {
+			merged = append(merged, run...)
+		}
+		for _, segment := range merged {
+			if segment.Stat.DocNum > 0 {
+				assert.DirExists(t, dataPath(segment))
+			}
+		}
+		before := shard.GetSegmentNum()
+		assert.NoError(t, MergeShard(shard, options))
+		if len(merged) == 0 {
+			continue
+		}
+		assert.Less(t, shard.GetSegmentNum(), before)
+		// the data of the merged segments is removed
+		for _, segment := range merged {
+			assert.NoDirExists(t, dataPath(segment))
+		}
+	}
+	// the documents are all found in the merged segments
+	assert.Equal(t, int64(total), count())
+}
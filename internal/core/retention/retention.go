@@ -0,0 +1,115 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package retention drops the segments older than the retention periods of their indexes in the
+// background
+package retention
+
+import (
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/core/wal"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"go.uber.org/zap"
+)
+
+// Cleaner checks the indexes with the retention setting periodically, and drops their mature
+// segments whose documents are all older than the retention periods.
+// A segment is dropped as a whole, so the documents may be kept a little longer than the retention
+// period, until the newest document of the segment expires.
+type Cleaner struct {
+	options *config.Retention
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Start starts dropping the expired segments in the background, the returned cleaner should be
+// stopped by Stop
+func Start(options *config.Retention) *Cleaner {
+	c := &Cleaner{
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.run()
+	logger.Info("segment retention started", zap.Duration("interval", options.Interval))
+	return c
+}
+
+// Stop stops dropping, the dropping in progress is finished first
+func (c *Cleaner) Stop() {
+	close(c.stop)
+	<-c.done
+}
+
+func (c *Cleaner) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.stop:
+			return
+		}
+		for _, index := range metadata.GetAllIndexes() {
+			select {
+			case <-c.stop:
+				return
+			default:
+			}
+			if err := CleanIndex(index, time.Now(), c.options.CleanDelay); err != nil {
+				logger.Warn(
+					"drop expired segments failed",
+					zap.String("index", index.Name),
+					zap.Error(err),
+				)
+			}
+		}
+	}
+}
+
+// CleanIndex drops the mature segments of the index whose documents are all older than the
+// retention period before now, the data of the dropped segments is removed after cleanDelay.
+func CleanIndex(index *core.Index, now time.Time, cleanDelay time.Duration) error {
+	retention, err := index.Settings.RetentionPeriod()
+	if err != nil || retention <= 0 {
+		return err
+	}
+	cutoff := now.Add(-retention).UnixMilli()
+	for _, shard := range index.GetShards() {
+		expired := make([]*core.Segment, 0)
+		for _, segment := range shard.GetSegments() {
+			if segment.Status() == core.SegmentStatusReadonly && segment.Stat.MaxTime < cutoff {
+				expired = append(expired, segment)
+			}
+		}
+		if len(expired) == 0 {
+			continue
+		}
+		// the WAL consumption may delete the documents of the segments meanwhile
+		unlock := wal.LockConsumption(shard)
+		removed := shard.RemoveSegments(expired)
+		if removed {
+			err = metadata.SaveIndex(index)
+		}
+		unlock()
+		if !removed {
+			// the segments have been merged, they are checked again next time
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		logger.Info(
+			"drop expired segments",
+			zap.String("shard", shard.GetName()),
+			zap.Int("segments", len(expired)),
+			zap.Time("cutoff", time.UnixMilli(cutoff)),
+		)
+		core.RemoveSegmentData(expired, cleanDelay)
+	}
+	return nil
+}
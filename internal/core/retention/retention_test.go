@@ -0,0 +1,96 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package retention
+
+import (
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/ingestion"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/tatris-io/tatris/test/ut/prepare"
+)
+
+func dataPath(segment *core.Segment) string {
+	return path.Join(config.Cfg.GetFSPath(), consts.PathData, segment.GetName())
+}
+
+func TestCleanIndex(t *testing.T) {
+	index, err := prepare.GetIndex(
+		strings.ReplaceAll(
+			time.Now().Format(consts.TimeFmtWithoutSeparator),
+			consts.Dot,
+			consts.Empty,
+		),
+	)
+	assert.NoError(t, err)
+	index.Settings.Retention = "1d"
+	assert.NoError(t, metadata.CreateIndex(index))
+
+	now := time.Now()
+	ingest := func(timestamp time.Time) {
+		docs := make([]protocol.Document, 0)
+		for i := 0; i < 6; i++ {
+			docs = append(docs, protocol.Document{
+				"name":                "retention",
+				consts.TimestampField: timestamp,
+			})
+		}
+		results, err := ingestion.IngestDocs(index, docs, "")
+		assert.NoError(t, err)
+		for _, result := range results {
+			result := result
+			assert.Eventually(t, func() bool {
+				return result.Shard.GetWalIndex() >= result.WalIndex
+			}, 10*time.Second, 100*time.Millisecond)
+		}
+		for _, shard := range index.GetShards() {
+			shard.ForceAddSegment()
+		}
+	}
+	docNum := func() int64 {
+		var docs int64
+		for _, shard := range index.GetShards() {
+			for _, segment := range shard.GetSegments() {
+				docs += segment.Stat.DocNum
+			}
+		}
+		return docs
+	}
+	ingest(now.Add(-72 * time.Hour))
+	ingest(now.Add(-time.Hour))
+	assert.Equal(t, int64(12), docNum())
+
+	expired := make([]*core.Segment, 0)
+	for _, shard := range index.GetShards() {
+		for _, segment := range shard.GetSegments() {
+			if segment.Stat.DocNum > 0 &&
+				segment.Stat.MaxTime < now.Add(-24*time.Hour).UnixMilli() {
+				expired = append(expired, segment)
+			}
+		}
+	}
+	assert.NotEmpty(t, expired)
+	for _, segment := range expired {
+		assert.DirExists(t, dataPath(segment))
+	}
+
+	assert.NoError(t, CleanIndex(index, now, 0))
+	// only the segments of the recent documents are kept
+	assert.Equal(t, int64(6), docNum())
+	for _, segment := range expired {
+		assert.NoDirExists(t, dataPath(segment))
+	}
+	for _, shard := range index.GetShards() {
+		for _, segment := range shard.GetSegments() {
+			assert.NotContains(t, expired, segment)
+		}
+	}
+}
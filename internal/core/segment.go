@@ -3,13 +3,18 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path"
 	"reflect"
 	"sync"
 	"time"
 
+	"github.com/tatris-io/tatris/internal/common/consts"
 	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/common/utils"
 
 	"github.com/tatris-io/tatris/internal/core/config"
 
@@ -18,6 +23,7 @@ import (
 
 	"github.com/tatris-io/tatris/internal/indexlib"
 	"github.com/tatris-io/tatris/internal/indexlib/manage"
+	"github.com/tatris-io/tatris/internal/protocol"
 )
 
 // Segment is a physical split of the index under a shard
@@ -38,9 +44,22 @@ type Segment struct {
 	SegmentID     int
 	Stat          SegmentStat
 	SegmentStatus uint8
-	lock          sync.Mutex
-	writer        indexlib.Writer
-	readerRef     int
+	// Directory is the type of the directory serving the data of the segment, empty means
+	// config.Directory.Type. The segments written to the local file system are moved to the
+	// object storage once they get warm, see config.Segment.Tiering
+	Directory string
+	// Late is true if the segment holds the late documents of the time bucket starting at
+	// LateBucket in milliseconds, see config.Segment.LateThreshold
+	Late       bool
+	LateBucket int64
+	lock       sync.Mutex
+	writer     indexlib.Writer
+	readerRef  int
+	// ids holds the _ids written to the segment, it is saved once the segment matures and loaded
+	// lazily after restarts. It is nil if the _ids are unknown, e.g. the segment was being
+	// written when the server stopped.
+	ids     *utils.BloomFilter
+	idsOnce sync.Once
 }
 
 func (segment *Segment) Status() uint8 {
@@ -59,6 +78,22 @@ func (segment *Segment) GetName() string {
 	)
 }
 
+// GetDirectory returns the type of the directory serving the data of the segment
+func (segment *Segment) GetDirectory() string {
+	segment.lock.Lock()
+	defer segment.lock.Unlock()
+
+	if segment.Directory == "" {
+		return config.Cfg.Directory.Type
+	}
+	return segment.Directory
+}
+
+// conf builds the indexlib config of the segment, whose directory type is the one serving it
+func (segment *Segment) conf() *indexlib.Config {
+	return indexlib.BuildConf(config.Cfg.Directory).WithDirectory(segment.Directory)
+}
+
 func (segment *Segment) GetWriter() (indexlib.Writer, error) {
 	segment.lock.Lock()
 	defer segment.lock.Unlock()
@@ -77,9 +112,8 @@ func (segment *Segment) GetWriter() (indexlib.Writer, error) {
 // openWriter open underlying writer
 func (segment *Segment) openWriter() (indexlib.Writer, error) {
 	// open a writer
-	config := indexlib.BuildConf(config.Cfg.Directory)
 	writer, err := manage.GetWriter(
-		config,
+		segment.conf(),
 		*segment.Shard.Index.Mappings,
 		segment.Shard.Index.GetName(),
 		segment.GetName(),
@@ -133,8 +167,7 @@ func (segment *Segment) GetReader() (indexlib.Reader, error) {
 
 	// The segment is readonly, so we can cache the result and reuse it
 	if segment.SegmentStatus == SegmentStatusReadonly {
-		config := indexlib.BuildConf(config.Cfg.Directory)
-		return manage.GetReaderUsingCache(config, segment.GetName())
+		return manage.GetReaderUsingCache(segment.conf(), segment.GetName())
 	}
 
 	// The segment is never write since server startup. So we force open the writer here.
@@ -145,9 +178,26 @@ func (segment *Segment) GetReader() (indexlib.Reader, error) {
 	return segment.openReaderFromWriter()
 }
 
+// IsMature returns whether the segment should stop accepting documents, a segment matures by the
+// number, the age or the time span of its documents.
 func (segment *Segment) IsMature() bool {
-	return segment.Stat.DocNum > config.Cfg.Segment.MatureThreshold ||
-		segment.SegmentStatus == SegmentStatusReadonly
+	if segment.SegmentStatus == SegmentStatusReadonly {
+		return true
+	}
+	cfg := config.Cfg.Segment
+	if segment.Stat.DocNum > cfg.MatureThreshold {
+		return true
+	}
+	// an empty segment never matures by time, otherwise it would be replaced by another empty one
+	if segment.Stat.DocNum <= 0 {
+		return false
+	}
+	if cfg.MatureAge > 0 &&
+		time.Now().UnixMilli()-segment.Stat.CreateTime >= cfg.MatureAge.Milliseconds() {
+		return true
+	}
+	return cfg.MatureTimeSpan > 0 &&
+		segment.Stat.MaxTime-segment.Stat.MinTime >= cfg.MatureTimeSpan.Milliseconds()
 }
 
 func (segment *Segment) Readonly() bool {
@@ -185,6 +235,247 @@ func (segment *Segment) UpdateStat(min, max time.Time, docs int64) {
 	)
 }
 
+// AddIDs records the _ids written to the segment
+func (segment *Segment) AddIDs(ids []string) {
+	if segment.ids == nil {
+		return
+	}
+	for _, id := range ids {
+		segment.ids.Add(id)
+	}
+}
+
+// MayContain returns false if the document of the _id has never been written to the segment
+func (segment *Segment) MayContain(id string) bool {
+	ids := segment.getIDs()
+	return ids == nil || ids.MayContain(id)
+}
+
+// getIDs returns the _ids written to the segment, the _ids of a readonly segment loaded from the
+// metadata are loaded from the file saved when it matured
+func (segment *Segment) getIDs() *utils.BloomFilter {
+	segment.idsOnce.Do(func() {
+		if segment.ids != nil || segment.Status() != SegmentStatusReadonly {
+			return
+		}
+		data, err := os.ReadFile(segment.idsPath())
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Warn(
+					"load segment ids failed",
+					zap.String("segment", segment.GetName()),
+					zap.Error(err),
+				)
+			}
+			return
+		}
+		ids := &utils.BloomFilter{}
+		if err := ids.UnmarshalBinary(data); err != nil {
+			logger.Warn(
+				"decode segment ids failed",
+				zap.String("segment", segment.GetName()),
+				zap.Error(err),
+			)
+			return
+		}
+		segment.ids = ids
+	})
+	return segment.ids
+}
+
+// saveIDs saves the _ids written to the readonly segment, which never change afterwards
+func (segment *Segment) saveIDs() error {
+	if segment.ids == nil {
+		return nil
+	}
+	data, err := segment.ids.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	p := segment.idsPath()
+	if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+func (segment *Segment) idsPath() string {
+	return path.Join(config.Cfg.GetFSPath(), consts.PathIDs, segment.GetName())
+}
+
+// DeleteDocuments deletes documents from the segment by IDs.
+// The writer of a readonly segment has been closed, so a temporary writer is opened to delete,
+// and the cached reader of the segment is evicted afterwards.
+func (segment *Segment) DeleteDocuments(ids []string) error {
+	segment.lock.Lock()
+	defer segment.lock.Unlock()
+
+	if reflect.ValueOf(segment.writer).IsValid() {
+		if err := segment.writer.Replace(nil, ids); err != nil {
+			return err
+		}
+	} else {
+		writer, err := manage.GetWriter(
+			segment.conf(),
+			*segment.Shard.Index.Mappings,
+			segment.Shard.Index.GetName(),
+			segment.GetName(),
+		)
+		if err != nil {
+			return err
+		}
+		err = writer.Replace(nil, ids)
+		// close the temporary writer to make sure the deletion is persisted
+		writer.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if segment.SegmentStatus == SegmentStatusReadonly {
+		manage.EvictReaderCache(segment.GetName())
+	}
+	segment.Stat.DocNum -= int64(len(ids))
+	logger.Info(
+		"delete segment docs",
+		zap.String("segment", segment.GetName()),
+		zap.Int("size", len(ids)),
+		zap.Int64("docNum", segment.Stat.DocNum),
+	)
+	return nil
+}
+
+// readPageSize is the number of the documents read at a time by readDocuments
+const readPageSize = 1000
+
+// readDocuments reads all the documents of the segment page by page, and hands each page keyed by
+// the _ids over to visit. The pages are sorted by _id and each one is searched after the last _id
+// of the previous one, all of them are read from one reader, whose snapshot never changes.
+func (segment *Segment) readDocuments(visit func(map[string]protocol.Document) error) error {
+	reader, err := segment.GetReader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	query := indexlib.NewMatchAllQuery()
+	query.SetSort(indexlib.Sort{{consts.IDField: indexlib.SortTerm{Order: "asc"}}})
+	count := 0
+	seen := make(map[string]struct{})
+	for {
+		resp, err := reader.Search(context.Background(), query, readPageSize, 0)
+		if err != nil {
+			return err
+		}
+		count = int(resp.Hits.Total.Value)
+		if len(resp.Hits.Hits) == 0 {
+			break
+		}
+		docs := make(map[string]protocol.Document, len(resp.Hits.Hits))
+		for _, hit := range resp.Hits.Hits {
+			docs[hit.ID] = hit.Source
+			seen[hit.ID] = struct{}{}
+		}
+		if err := visit(docs); err != nil {
+			return err
+		}
+		if len(resp.Hits.Hits) < readPageSize {
+			break
+		}
+		query.SetSearchAfter([]string{resp.Hits.Hits[len(resp.Hits.Hits)-1].ID})
+	}
+	// the pages miss documents if some of them share an _id
+	if len(seen) != count {
+		return fmt.Errorf(
+			"%d documents of segment %s are read, %d expected",
+			len(seen),
+			segment.GetName(),
+			count,
+		)
+	}
+	return nil
+}
+
+// RemoveData closes the writer of the segment, evicts its cached reader and removes its data from
+// the directory, the segment should have been removed from its shard.
+func (segment *Segment) RemoveData() error {
+	segment.lock.Lock()
+	defer segment.lock.Unlock()
+
+	segment.SegmentStatus = SegmentStatusReadonly
+	if reflect.ValueOf(segment.writer).IsValid() {
+		segment.closeWriter()
+	}
+	manage.EvictReaderCache(segment.GetName())
+	err := manage.RemoveData(segment.conf(), segment.GetName())
+	if err != nil {
+		return err
+	}
+	logger.Info("remove segment data", zap.String("segment", segment.GetName()))
+	return nil
+}
+
+// UploadData uploads the data of the readonly segment from the local file system to the object
+// storage of the directory type. The segment is still served by the local file system until it is
+// switched by SetDirectory.
+func (segment *Segment) UploadData(directory string) error {
+	segment.lock.Lock()
+	if !segment.Readonly() || reflect.ValueOf(segment.writer).IsValid() {
+		segment.lock.Unlock()
+		return fmt.Errorf("segment %s is being written", segment.GetName())
+	}
+	conf := segment.conf()
+	segment.lock.Unlock()
+
+	if conf.DirectoryType != consts.DirectoryFS {
+		return fmt.Errorf("segment %s is not served by the local file system", segment.GetName())
+	}
+	// the upload takes long, the queries are not blocked meanwhile
+	return manage.UploadData(conf, directory, segment.GetName())
+}
+
+// SetDirectory switches the directory serving the data of the segment, the cached reader of the
+// segment is evicted so that the data is read from the new directory afterwards
+func (segment *Segment) SetDirectory(directory string) {
+	segment.lock.Lock()
+	defer segment.lock.Unlock()
+
+	segment.Directory = directory
+	manage.EvictReaderCache(segment.GetName())
+}
+
+// RemoveLocalData removes the data of the segment left on the local file system after it is
+// moved to the object storage
+func (segment *Segment) RemoveLocalData() error {
+	return manage.RemoveLocalData(segment.conf(), segment.GetName())
+}
+
+// RemoveSegmentData removes the data and the saved _ids of the segments removed from their shards
+// after the delay, so that the queries still reading them can finish
+func RemoveSegmentData(segments []*Segment, delay time.Duration) {
+	remove := func() {
+		for _, segment := range segments {
+			if err := segment.RemoveData(); err != nil {
+				logger.Warn(
+					"remove segment data failed",
+					zap.String("segment", segment.GetName()),
+					zap.Error(err),
+				)
+			}
+			if err := os.Remove(segment.idsPath()); err != nil && !os.IsNotExist(err) {
+				logger.Warn(
+					"remove segment ids failed",
+					zap.String("segment", segment.GetName()),
+					zap.Error(err),
+				)
+			}
+		}
+	}
+	if delay > 0 {
+		time.AfterFunc(delay, remove)
+	} else {
+		remove()
+	}
+}
+
 // OnMature is called when segment becomes mature.
 // It marks segment readonly and closes the underlying writer.
 func (segment *Segment) OnMature() {
@@ -200,6 +491,14 @@ func (segment *Segment) OnMature() {
 
 	segment.Stat.MatureTime = time.Now().UnixMilli()
 
+	if err := segment.saveIDs(); err != nil {
+		logger.Warn(
+			"save segment ids failed",
+			zap.String("segment", segment.GetName()),
+			zap.Error(err),
+		)
+	}
+
 	logger.Info(
 		"segment is mature",
 		zap.String("segment", segment.GetName()),
@@ -3,12 +3,19 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/errs"
 	"github.com/tatris-io/tatris/internal/common/utils"
+	"github.com/tatris-io/tatris/internal/core/config"
 	"github.com/tatris-io/tatris/internal/core/wal/log"
+	"github.com/tatris-io/tatris/internal/indexlib"
+	"github.com/tatris-io/tatris/internal/indexlib/manage"
+	"github.com/tatris-io/tatris/internal/protocol"
 	"go.uber.org/zap"
 
 	"github.com/tatris-io/tatris/internal/common/log/logger"
@@ -20,8 +27,28 @@ type Shard struct {
 	ShardID  int
 	Segments []*Segment
 	Stat     ShardStat
-	Wal      log.WalLog `json:"-"`
-	lock     sync.RWMutex
+	// NextSegmentID is the ID of the next segment to add, the IDs are never reused since the
+	// segments may be merged
+	NextSegmentID int
+	Wal           log.WalLog `json:"-"`
+	lock          sync.RWMutex
+	// walConsumed is closed and discarded every time the consumed WAL index advances, so that
+	// the waiters of WaitForWalIndex are woken up
+	walConsumed chan struct{}
+	// idLock serializes the writes checking the uniqueness of _ids
+	idLock sync.Mutex
+	// pendingIDs tracks the _ids of the operations written to the WAL but not consumed yet,
+	// guarded by idLock
+	pendingIDs map[string]pendingID
+}
+
+// idFalsePositiveRate is the false positive rate of the _ids recorded by the segments
+const idFalsePositiveRate = 0.01
+
+// pendingID is the state of a document after the pending operations on it are applied
+type pendingID struct {
+	exists   bool
+	walIndex uint64
 }
 
 func (shard *Shard) GetName() string {
@@ -44,23 +71,27 @@ func (shard *Shard) GetLatestSegmentID() int {
 	return shard.GetSegmentNum() - 1
 }
 
+// GetLatestSegment returns the latest segment of the in-order documents, the segments of the late
+// documents are skipped.
 func (shard *Shard) GetLatestSegment() *Segment {
-	SegmentID := shard.GetLatestSegmentID()
-	if SegmentID < 0 {
-		return nil
+	for i := shard.GetLatestSegmentID(); i >= 0; i-- {
+		if !shard.Segments[i].Late {
+			return shard.Segments[i]
+		}
 	}
-	return shard.Segments[SegmentID]
+	return nil
 }
 
+// CheckSegments adds a new latest segment if the latest one is mature, and marks the mature
+// segments of the late documents readonly.
 func (shard *Shard) CheckSegments() {
 	lastedSegment := shard.GetLatestSegment()
 	if lastedSegment == nil || lastedSegment.IsMature() {
 		shard.lock.Lock()
-		defer shard.lock.Unlock()
 		lastedSegment = shard.GetLatestSegment()
 		if lastedSegment == nil || lastedSegment.IsMature() {
-			newID := shard.GetSegmentNum()
-			shard.addSegment(newID)
+			newID := shard.allocateSegmentID()
+			shard.addSegment(newID, false, 0)
 			if lastedSegment != nil {
 				lastedSegment.OnMature()
 			}
@@ -71,17 +102,45 @@ func (shard *Shard) CheckSegments() {
 				zap.Int("segment", newID),
 			)
 		}
+		shard.lock.Unlock()
+	}
+	for _, segment := range shard.GetSegments() {
+		if segment.Late && segment.Status() == SegmentStatusWritable && segment.IsMature() {
+			segment.OnMature()
+		}
 	}
 }
 
+// GetLateSegment returns the writable segment of the late documents in the time bucket starting at
+// bucket in milliseconds, a new segment is added if there is none.
+func (shard *Shard) GetLateSegment(bucket int64) *Segment {
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	for _, segment := range shard.Segments {
+		if segment.Late && segment.LateBucket == bucket && !segment.IsMature() {
+			return segment
+		}
+	}
+	newID := shard.allocateSegmentID()
+	shard.addSegment(newID, true, bucket)
+	logger.Info(
+		"add late segment",
+		zap.String("index", shard.Index.Name),
+		zap.Int("shard", shard.ShardID),
+		zap.Int("segment", newID),
+		zap.Time("bucket", time.UnixMilli(bucket)),
+	)
+	return shard.Segments[shard.GetSegmentNum()-1]
+}
+
 // ForceAddSegment forces adding a segment to current shard
 func (shard *Shard) ForceAddSegment() {
 	shard.lock.Lock()
 	defer shard.lock.Unlock()
 
 	lastedSegment := shard.GetLatestSegment()
-	newID := shard.GetSegmentNum()
-	shard.addSegment(newID)
+	newID := shard.allocateSegmentID()
+	shard.addSegment(newID, false, 0)
 	if lastedSegment != nil {
 		lastedSegment.OnMature()
 	}
@@ -93,6 +152,298 @@ func (shard *Shard) ForceAddSegment() {
 	)
 }
 
+// AllocateSegmentID allocates an ID for a segment to add
+func (shard *Shard) AllocateSegmentID() int {
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	return shard.allocateSegmentID()
+}
+
+// ReplaceSegments replaces the adjacent segments with the segment merged from them, the segments
+// of the shard are swapped as a whole so that the readers iterating them are not affected.
+// It returns false if any of the segments is not found in the shard.
+func (shard *Shard) ReplaceSegments(segments []*Segment, merged *Segment) bool {
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	replaced := make(map[*Segment]bool, len(segments))
+	for _, segment := range segments {
+		replaced[segment] = true
+	}
+	swapped := make([]*Segment, 0, len(shard.Segments)-len(segments)+1)
+	for _, segment := range shard.Segments {
+		if !replaced[segment] {
+			swapped = append(swapped, segment)
+			continue
+		}
+		// the merged segment takes the place of the first segment merged
+		if len(replaced) == len(segments) {
+			swapped = append(swapped, merged)
+		}
+		delete(replaced, segment)
+	}
+	if len(replaced) > 0 {
+		return false
+	}
+	shard.Segments = swapped
+	return true
+}
+
+// RemoveSegments removes the segments from the shard, and subtracts their documents from the
+// stats of the shard. It returns false if any of the segments is not found in the shard.
+func (shard *Shard) RemoveSegments(segments []*Segment) bool {
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	removed := make(map[*Segment]bool, len(segments))
+	for _, segment := range segments {
+		removed[segment] = true
+	}
+	kept := make([]*Segment, 0, len(shard.Segments))
+	var docs int64
+	for _, segment := range shard.Segments {
+		if removed[segment] {
+			docs += segment.Stat.DocNum
+			delete(removed, segment)
+			continue
+		}
+		kept = append(kept, segment)
+	}
+	if len(removed) > 0 {
+		return false
+	}
+	shard.Segments = kept
+	shard.Stat.DocNum -= docs
+	return true
+}
+
+// MergeSegments writes the documents of the readonly segments into a new readonly segment of the
+// ID, the segments should be served by the same directory. The new segment is not added to the
+// shard until it is swapped in by ReplaceSegments.
+// The data written is removed if the merging fails.
+func (shard *Shard) MergeSegments(segmentID int, segments []*Segment) (*Segment, error) {
+	merged := &Segment{
+		Shard:     shard,
+		SegmentID: segmentID,
+		Stat: SegmentStat{
+			Stat: Stat{
+				CreateTime: time.Now().UnixMilli(),
+			},
+			MatureTime: time.Now().UnixMilli(),
+		},
+		SegmentStatus: SegmentStatusReadonly,
+		Directory:     segments[0].Directory,
+		Late:          segments[0].Late,
+		LateBucket:    segments[0].LateBucket,
+	}
+	// the merged segment is written to the directory serving the segments merged
+	writer, err := manage.GetWriter(
+		merged.conf(),
+		*shard.Index.Mappings,
+		shard.Index.GetName(),
+		merged.GetName(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0)
+	for _, segment := range segments {
+		// the documents are re-indexed a page at a time to bound the memory used
+		err = segment.readDocuments(func(docs map[string]protocol.Document) error {
+			for id := range docs {
+				ids = append(ids, id)
+			}
+			return writer.Batch(docs)
+		})
+		if err != nil {
+			break
+		}
+		if segment.Stat.DocNum > 0 {
+			if merged.Stat.MinTime == 0 || segment.Stat.MinTime < merged.Stat.MinTime {
+				merged.Stat.MinTime = segment.Stat.MinTime
+			}
+			if segment.Stat.MaxTime > merged.Stat.MaxTime {
+				merged.Stat.MaxTime = segment.Stat.MaxTime
+			}
+		}
+	}
+	// close the writer to make sure the documents are persisted
+	writer.Close()
+	if err != nil {
+		if removeErr := merged.RemoveData(); removeErr != nil {
+			logger.Warn(
+				"remove merged segment failed",
+				zap.String("segment", merged.GetName()),
+				zap.Error(removeErr),
+			)
+		}
+		return nil, err
+	}
+	merged.Stat.DocNum = int64(len(ids))
+	merged.ids = utils.NewBloomFilter(len(ids), idFalsePositiveRate)
+	merged.AddIDs(ids)
+	if err := merged.saveIDs(); err != nil {
+		logger.Warn(
+			"save segment ids failed",
+			zap.String("segment", merged.GetName()),
+			zap.Error(err),
+		)
+	}
+	return merged, nil
+}
+
+// FindDocuments looks up documents by IDs among all segments of the shard.
+// It returns the segments where the documents are located, and the sources of the documents found
+// in each segment.
+func (shard *Shard) FindDocuments(ids []string) (map[*Segment]map[string]protocol.Document, error) {
+	found := make(map[*Segment]map[string]protocol.Document)
+	if len(ids) == 0 {
+		return found, nil
+	}
+	for _, segment := range shard.GetSegments() {
+		if segment.Stat.DocNum <= 0 {
+			continue
+		}
+		// skip the _ids that have never been written to the segment
+		candidates := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if segment.MayContain(id) {
+				candidates = append(candidates, id)
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		query := indexlib.NewTermsQuery()
+		query.Terms = map[string]*indexlib.Terms{
+			consts.IDField: {BaseQuery: indexlib.NewBaseQuery(), Fields: candidates},
+		}
+		reader, err := segment.GetReader()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := reader.Search(context.Background(), query, len(candidates), 0)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Hits.Hits) == 0 {
+			continue
+		}
+		docs := make(map[string]protocol.Document, len(resp.Hits.Hits))
+		for _, hit := range resp.Hits.Hits {
+			docs[hit.ID] = hit.Source
+		}
+		found[segment] = docs
+	}
+	return found, nil
+}
+
+// WriteUnique writes the operations by write except the creations conflicting with the existing
+// documents, which include the documents written to the WAL but not consumed yet.
+// It returns the WAL index written, whether the indexes at each position replace existing
+// documents, and errs.DocumentConflictError at the positions of the rejected operations.
+// Nothing is written if all the operations are rejected.
+func (shard *Shard) WriteUnique(
+	ops []*protocol.Operation,
+	write func([]*protocol.Operation) (uint64, error),
+) (uint64, []bool, []error, error) {
+	replaced := make([]bool, len(ops))
+	conflicts := make([]error, len(ops))
+	explicit := false
+	for _, op := range ops {
+		explicit = explicit || !op.AutoID
+	}
+	if !explicit {
+		// the generated _ids never conflict
+		walIndex, err := write(ops)
+		return walIndex, replaced, conflicts, err
+	}
+
+	shard.idLock.Lock()
+	defer shard.idLock.Unlock()
+	// the documents to create or index are looked up in the segments unless they are pending
+	lookup := make([]string, 0)
+	for _, op := range ops {
+		if (op.Action == consts.ActionCreate || op.Action == consts.ActionIndex) && !op.AutoID {
+			if _, ok := shard.pendingIDs[op.ID]; !ok {
+				lookup = append(lookup, op.ID)
+			}
+		}
+	}
+	found, err := shard.FindDocuments(lookup)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	stored := make(map[string]bool)
+	for _, docs := range found {
+		for id := range docs {
+			stored[id] = true
+		}
+	}
+	// states holds whether the documents exist after the accepted operations are applied
+	states := make(map[string]bool)
+	exists := func(id string) bool {
+		if state, ok := states[id]; ok {
+			return state
+		}
+		if pending, ok := shard.pendingIDs[id]; ok {
+			return pending.exists
+		}
+		return stored[id]
+	}
+	accepted := make([]*protocol.Operation, 0, len(ops))
+	for i, op := range ops {
+		if op.AutoID {
+			accepted = append(accepted, op)
+			continue
+		}
+		switch op.Action {
+		case consts.ActionCreate:
+			if exists(op.ID) {
+				conflicts[i] = &errs.DocumentConflictError{Index: shard.Index.Name, ID: op.ID}
+				continue
+			}
+			states[op.ID] = true
+		case consts.ActionIndex:
+			replaced[i] = exists(op.ID)
+			states[op.ID] = true
+		case consts.ActionUpdate:
+			// an update without upsert does not change whether the document exists
+			if op.Upsert != nil {
+				states[op.ID] = true
+			}
+		case consts.ActionDelete:
+			states[op.ID] = false
+		}
+		accepted = append(accepted, op)
+	}
+	if len(accepted) == 0 {
+		return 0, replaced, conflicts, nil
+	}
+	walIndex, err := write(accepted)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if shard.pendingIDs == nil {
+		shard.pendingIDs = make(map[string]pendingID)
+	}
+	for id, state := range states {
+		shard.pendingIDs[id] = pendingID{exists: state, walIndex: walIndex}
+	}
+	return walIndex, replaced, conflicts, nil
+}
+
+// ConsumeIDs stops tracking the _ids of the operations once they are consumed to walIndex, the
+// documents can be found in the segments then
+func (shard *Shard) ConsumeIDs(ops []*protocol.Operation, walIndex uint64) {
+	shard.idLock.Lock()
+	defer shard.idLock.Unlock()
+	for _, op := range ops {
+		if pending, ok := shard.pendingIDs[op.ID]; ok && pending.walIndex <= walIndex {
+			delete(shard.pendingIDs, op.ID)
+		}
+	}
+}
+
 func (shard *Shard) UpdateStat(min, max time.Time, docs int64, wals uint64) {
 	mint := min.UnixMilli()
 	maxt := max.UnixMilli()
@@ -114,6 +465,10 @@ func (shard *Shard) UpdateStat(min, max time.Time, docs int64, wals uint64) {
 	shard.Stat.DocNum += docs
 	if wals != 0 {
 		shard.Stat.WalIndex = wals
+		if shard.walConsumed != nil {
+			close(shard.walConsumed)
+			shard.walConsumed = nil
+		}
 	}
 	logger.Info(
 		"update shard stat",
@@ -124,6 +479,37 @@ func (shard *Shard) UpdateStat(min, max time.Time, docs int64, wals uint64) {
 	)
 }
 
+// GetWalIndex returns the last consumed WAL index
+func (shard *Shard) GetWalIndex() uint64 {
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+	return shard.Stat.WalIndex
+}
+
+// WaitForWalIndex blocks until the WAL of the shard is consumed to walIndex or the timeout
+// expires, it reports whether the WAL index is reached.
+func (shard *Shard) WaitForWalIndex(walIndex uint64, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		shard.lock.Lock()
+		if shard.Stat.WalIndex >= walIndex {
+			shard.lock.Unlock()
+			return true
+		}
+		if shard.walConsumed == nil {
+			shard.walConsumed = make(chan struct{})
+		}
+		consumed := shard.walConsumed
+		shard.lock.Unlock()
+		select {
+		case <-consumed:
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
 func (shard *Shard) Destroy() error {
 
 	defer utils.Timerf("close shard finish, name:%s", shard.GetName())()
@@ -135,7 +521,20 @@ func (shard *Shard) Destroy() error {
 	return nil
 }
 
-func (shard *Shard) addSegment(segmentID int) {
+// allocateSegmentID returns the ID of the next segment, the caller should hold the lock
+func (shard *Shard) allocateSegmentID() int {
+	id := shard.NextSegmentID
+	// the shards loaded from the metadata of earlier versions have no NextSegmentID
+	for _, segment := range shard.Segments {
+		if segment.SegmentID >= id {
+			id = segment.SegmentID + 1
+		}
+	}
+	shard.NextSegmentID = id + 1
+	return id
+}
+
+func (shard *Shard) addSegment(segmentID int, late bool, lateBucket int64) {
 	shard.Segments = append(
 		shard.Segments,
 		&Segment{
@@ -147,6 +546,12 @@ func (shard *Shard) addSegment(segmentID int) {
 				},
 			},
 			SegmentStatus: SegmentStatusWritable,
+			Late:          late,
+			LateBucket:    lateBucket,
+			ids: utils.NewBloomFilter(
+				int(config.Cfg.Segment.MatureThreshold),
+				idFalsePositiveRate,
+			),
 		},
 	)
 }
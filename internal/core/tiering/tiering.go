@@ -0,0 +1,167 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package tiering moves the warm segments from the local file system to the object storage in the
+// background
+package tiering
+
+import (
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/core/wal"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"go.uber.org/zap"
+)
+
+// Mover checks the shards of all the indexes periodically, and moves their segments that have been
+// mature for long enough to the object storage.
+// The data of a segment is uploaded first, then the segment is switched to the object storage
+// while the WAL of the shard is not consumed. The moving is abandoned if the segment has deleted
+// documents or has been removed from the shard meanwhile.
+type Mover struct {
+	options *config.Tiering
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Start starts moving in the background, the returned mover should be stopped by Stop
+func Start(options *config.Tiering) *Mover {
+	m := &Mover{
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go m.run()
+	logger.Info(
+		"segment mover started",
+		zap.String("directory", options.Directory),
+		zap.Duration("interval", options.Interval),
+		zap.Duration("warmAge", options.WarmAge),
+	)
+	return m
+}
+
+// Stop stops moving, the moving in progress is finished first
+func (m *Mover) Stop() {
+	close(m.stop)
+	<-m.done
+}
+
+func (m *Mover) run() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-m.stop:
+			return
+		}
+		for _, index := range metadata.GetAllIndexes() {
+			for _, shard := range index.GetShards() {
+				select {
+				case <-m.stop:
+					return
+				default:
+				}
+				if err := MoveShard(shard, m.options, time.Now()); err != nil {
+					logger.Warn(
+						"move segments failed",
+						zap.String("shard", shard.GetName()),
+						zap.Error(err),
+					)
+				}
+			}
+		}
+	}
+}
+
+// MoveShard moves the segments of the shard that have been mature for options.WarmAge before now
+// to the object storage of options.Directory one by one
+func MoveShard(shard *core.Shard, options *config.Tiering, now time.Time) error {
+	cutoff := now.Add(-options.WarmAge).UnixMilli()
+	for _, segment := range shard.GetSegments() {
+		// the segments matured before the mature time is recorded are never moved
+		if segment.Status() != core.SegmentStatusReadonly ||
+			segment.GetDirectory() != consts.DirectoryFS ||
+			segment.Stat.MatureTime <= 0 || segment.Stat.MatureTime > cutoff {
+			continue
+		}
+		if err := move(shard, segment, options.Directory, options.CleanDelay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// move uploads the segment to the object storage of the directory type and switches it there, the
+// local data of the segment is removed after cleanDelay
+func move(
+	shard *core.Shard,
+	segment *core.Segment,
+	directory string,
+	cleanDelay time.Duration,
+) error {
+	start := time.Now()
+	docNum := segment.Stat.DocNum
+	if err := segment.UploadData(directory); err != nil {
+		return err
+	}
+
+	unlock := wal.LockConsumption(shard)
+	contained := false
+	for _, s := range shard.GetSegments() {
+		contained = contained || s == segment
+	}
+	switched := contained && segment.Stat.DocNum == docNum
+	var err error
+	if switched {
+		segment.SetDirectory(directory)
+		if err = metadata.SaveIndex(shard.Index); err != nil {
+			// the persisted metadata still refers to the local data
+			segment.SetDirectory(consts.DirectoryFS)
+		}
+	}
+	unlock()
+	if !switched || err != nil {
+		logger.Info(
+			"segment not switched, the uploaded data is discarded",
+			zap.String("segment", segment.GetName()),
+			zap.Bool("changed", !switched),
+		)
+		// the uploaded data is removed by a stub of the segment served by the object storage
+		discard := &core.Segment{
+			Shard:     shard,
+			SegmentID: segment.SegmentID,
+			Directory: directory,
+		}
+		if removeErr := discard.RemoveData(); removeErr != nil {
+			logger.Warn(
+				"remove uploaded segment data failed",
+				zap.String("segment", segment.GetName()),
+				zap.Error(removeErr),
+			)
+		}
+		return err
+	}
+	logger.Info(
+		"move segment to object storage",
+		zap.String("segment", segment.GetName()),
+		zap.String("directory", directory),
+		zap.Int64("docNum", docNum),
+		zap.Duration("took", time.Since(start)),
+	)
+	time.AfterFunc(cleanDelay, func() {
+		if err := segment.RemoveLocalData(); err != nil {
+			logger.Warn(
+				"remove local segment data failed",
+				zap.String("segment", segment.GetName()),
+				zap.Error(err),
+			)
+		}
+	})
+	return nil
+}
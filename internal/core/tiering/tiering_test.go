@@ -0,0 +1,73 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package tiering
+
+import (
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/ingestion"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/tatris-io/tatris/test/ut/prepare"
+)
+
+func TestMoveShard(t *testing.T) {
+	index, err := prepare.GetIndex(
+		strings.ReplaceAll(
+			time.Now().Format(consts.TimeFmtWithoutSeparator),
+			consts.Dot,
+			consts.Empty,
+		),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, metadata.CreateIndex(index))
+
+	docs := make([]protocol.Document, 0)
+	for i := 0; i < 6; i++ {
+		docs = append(docs, protocol.Document{"name": "tiering"})
+	}
+	results, err := ingestion.IngestDocs(index, docs, "")
+	assert.NoError(t, err)
+	for _, result := range results {
+		result := result
+		assert.Eventually(t, func() bool {
+			return result.Shard.GetWalIndex() >= result.WalIndex
+		}, 10*time.Second, 100*time.Millisecond)
+	}
+	mature := make([]*core.Segment, 0)
+	for _, shard := range index.GetShards() {
+		shard.ForceAddSegment()
+		for _, segment := range shard.GetSegments() {
+			if segment.Status() == core.SegmentStatusReadonly && segment.Stat.DocNum > 0 {
+				mature = append(mature, segment)
+			}
+		}
+	}
+	assert.NotEmpty(t, mature)
+
+	// the segments just matured are still hot
+	options := &config.Tiering{
+		Enabled:    true,
+		Directory:  consts.DirectoryOSS,
+		Interval:   time.Minute,
+		WarmAge:    time.Hour,
+		CleanDelay: 0,
+	}
+	for _, shard := range index.GetShards() {
+		assert.NoError(t, MoveShard(shard, options, time.Now()))
+	}
+	for _, segment := range mature {
+		assert.Equal(t, consts.DirectoryFS, segment.GetDirectory())
+		assert.DirExists(
+			t,
+			path.Join(config.Cfg.GetFSPath(), consts.PathData, segment.GetName()),
+		)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package wal
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/core/wal/log"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// consumer consumes the WAL of a shard as soon as it is signaled by the writes, rather than
+// waiting for the periodic consumption of all the WALs
+type consumer struct {
+	shard *core.Shard
+	wal   log.WalLog
+	// signal is notified after each write, it is buffered so that the writers never block and
+	// the signals during a consumption are merged into one
+	signal chan struct{}
+	stop   chan struct{}
+	// ops is the number of operations written since the last consumption started
+	ops atomic.Uint64
+}
+
+// consumers caches { shard name -> consumer }
+var consumers sync.Map
+
+// startConsumer starts consuming the WAL of the shard in the background, the previous consumer
+// of a shard with the same name (e.g. the index is deleted and created again) is stopped
+func startConsumer(shard *core.Shard, wal log.WalLog) {
+	c := &consumer{
+		shard:  shard,
+		wal:    wal,
+		signal: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	stopConsumer(shard.GetName())
+	consumers.Store(shard.GetName(), c)
+	go c.run()
+}
+
+// stopConsumer stops the consumer of the shard
+func stopConsumer(name string) {
+	if c, ok := consumers.LoadAndDelete(name); ok {
+		close(c.(*consumer).stop)
+	}
+}
+
+// signalConsumer notifies the consumer of the shard that an entry holding ops operations is
+// written
+func signalConsumer(name string, ops int) {
+	if c, ok := consumers.Load(name); ok {
+		c.(*consumer).ops.Add(uint64(ops))
+		select {
+		case c.(*consumer).signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *consumer) run() {
+	name := c.shard.GetName()
+	logger.Info("wal consumer start", zap.String("name", name))
+	defer logger.Info("wal consumer stop", zap.String("name", name))
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-c.signal:
+		}
+		if !c.waitForBatch() {
+			return
+		}
+		c.ops.Store(0)
+		// consume until catching up with the writes, a batch at a time
+		for {
+			consumed := c.shard.GetWalIndex()
+			if c.pending() == 0 {
+				break
+			}
+			if err := ConsumeWAL(c.shard, c.wal); err != nil {
+				logger.Error("consume shard wal failed", zap.String("name", name), zap.Error(err))
+				break
+			}
+			if c.shard.GetWalIndex() == consumed {
+				break
+			}
+		}
+	}
+}
+
+// waitForBatch waits until the operations written fill a batch or the max wait time expires, it
+// returns false if the consumer is stopped in the meantime.
+func (c *consumer) waitForBatch() bool {
+	options := config.Cfg.Wal
+	if options.ConsumeMaxWait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(options.ConsumeMaxWait)
+	defer timer.Stop()
+	for c.ops.Load() < uint64(options.ConsumeBatchSize) {
+		select {
+		case <-c.stop:
+			return false
+		case <-timer.C:
+			return true
+		case <-c.signal:
+		}
+	}
+	return true
+}
+
+// pending returns the number of entries that are written but not consumed yet
+func (c *consumer) pending() uint64 {
+	lastIndex, err := c.wal.LastIndex()
+	if err != nil {
+		logger.Error(
+			"get last index of wal failed",
+			zap.String("name", c.shard.GetName()),
+			zap.Error(err),
+		)
+		return 0
+	}
+	consumed := c.shard.GetWalIndex()
+	if lastIndex <= consumed {
+		return 0
+	}
+	return lastIndex - consumed
+}
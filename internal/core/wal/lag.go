@@ -0,0 +1,122 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package wal
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/core/wal/log"
+)
+
+// Lag describes how far the consumption of a shard's WAL falls behind the writes
+type Lag struct {
+	// Entries is the number of entries that are written but not consumed yet
+	Entries uint64
+	// Bytes is the size of the WAL segments holding the entries not consumed yet
+	Bytes int64
+}
+
+// GetLag returns the lag of the shard's WAL, a shard whose WAL is not open has no lag.
+// The segments consumed completely are not counted even if they are not truncated yet.
+func GetLag(shard *core.Shard) (Lag, error) {
+	lag := Lag{}
+	wal := shard.Wal
+	if wal == nil {
+		return lag, nil
+	}
+	lastIndex, err := wal.LastIndex()
+	if err != nil {
+		return lag, err
+	}
+	consumed := shard.GetWalIndex()
+	if lastIndex <= consumed {
+		return lag, nil
+	}
+	lag.Entries = lastIndex - consumed
+	if stater, ok := wal.(log.SegmentStater); ok {
+		for _, stat := range stater.SegmentStats() {
+			if stat.LastIndex > consumed {
+				lag.Bytes += stat.Size
+			}
+		}
+		return lag, nil
+	}
+	// the segment files are named by the indexes of their first entries, each segment ends
+	// before the next one begins
+	p := path.Join(config.Cfg.GetFSPath(), consts.PathWAL, shard.GetName())
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return lag, err
+	}
+	segments := make([]log.SegmentStat, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		firstIndex, err := strconv.ParseUint(entry.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// the file may be removed by the truncation in the meantime
+			continue
+		}
+		segments = append(segments, log.SegmentStat{FirstIndex: firstIndex, Size: info.Size()})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].FirstIndex < segments[j].FirstIndex
+	})
+	for i, segment := range segments {
+		last := lastIndex
+		if i+1 < len(segments) {
+			last = segments[i+1].FirstIndex - 1
+		}
+		if last > consumed {
+			lag.Bytes += segment.Size
+		}
+	}
+	return lag, nil
+}
+
+// CheckLag returns an errs.WalLagExceedError if the lag of the shard's WAL exceeds the thresholds,
+// the writes to the shard should be rejected until the consumption catches up.
+func CheckLag(shard *core.Shard) error {
+	options := config.Cfg.Wal
+	if options.MaxLagEntries == 0 && options.MaxLagBytes == 0 {
+		return nil
+	}
+	lag, err := GetLag(shard)
+	if err != nil {
+		return err
+	}
+	if options.MaxLagEntries > 0 && lag.Entries > options.MaxLagEntries {
+		return &errs.WalLagExceedError{
+			Shard: shard.GetName(),
+			Message: fmt.Sprintf(
+				"%d entries are not consumed, the limit is %d",
+				lag.Entries,
+				options.MaxLagEntries,
+			),
+		}
+	}
+	if options.MaxLagBytes > 0 && lag.Bytes > options.MaxLagBytes {
+		return &errs.WalLagExceedError{
+			Shard: shard.GetName(),
+			Message: fmt.Sprintf(
+				"%d bytes of segments are not consumed, the limit is %d",
+				lag.Bytes,
+				options.MaxLagBytes,
+			),
+		}
+	}
+	return nil
+}
@@ -5,7 +5,8 @@ package log
 
 type WalLog interface {
 	Write(data []byte) error
-	BWrite(datas [][]byte) error
+	// BWrite writes datas in a batch and returns the index of the last written entry
+	BWrite(datas [][]byte) (uint64, error)
 	Read(index uint64) ([]byte, error)
 	FirstIndex() (uint64, error)
 	LastIndex() (uint64, error)
@@ -13,3 +14,19 @@ type WalLog interface {
 	TruncateBack(id uint64) error
 	Close() error
 }
+
+// SegmentStat is the statistics of a segment file of a WAL
+type SegmentStat struct {
+	Path string
+	// FirstIndex and LastIndex are the indexes of the first and the last entry in the segment,
+	// both are 0 if the segment is empty
+	FirstIndex uint64
+	LastIndex  uint64
+	Entries    uint64
+	Size       int64
+}
+
+// SegmentStater is implemented by the WALs that expose the statistics of their segment files
+type SegmentStater interface {
+	SegmentStats() []SegmentStat
+}
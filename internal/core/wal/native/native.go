@@ -0,0 +1,519 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package native implements a WAL with group commit, the concurrent writes waiting for durability
+// share one fsync rather than paying one each
+package native
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/core/wal/log"
+)
+
+// Each entry is stored in a segment file as:
+//
+//	+------------+------------+------------------+
+//	| length (4) | crc32c (4) | data             |
+//	+------------+------------+------------------+
+//
+// A segment file is named by the index of its first entry, padded to 20 digits. The index of the
+// first entry of the whole log is kept in firstIndexFile once the log is truncated from the
+// front, so that truncation never rewrites a segment.
+const (
+	entryHeaderSize = 8
+	segmentNameLen  = 20
+	firstIndexFile  = "first_index"
+)
+
+var (
+	// ErrNotFound is returned when reading an entry that does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrOutOfRange is returned when truncating at an index that does not exist
+	ErrOutOfRange = errors.New("out of range")
+	// ErrCorrupt is returned when a segment other than the last one is corrupt
+	ErrCorrupt = errors.New("corrupt")
+	// ErrClosed is returned when operating a closed log
+	ErrClosed = errors.New("closed")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+type Options struct {
+	// SegmentSize is the size in bytes at which the segment being written is rolled
+	SegmentSize int64
+	// NoSync disables fsync entirely, the writes survive a process crash but not an OS crash
+	NoSync bool
+	// SyncInterval is the interval of syncing the writes in the background, 0 means that every
+	// write is synced before it returns and the concurrent writes share one fsync
+	SyncInterval time.Duration
+	DirPerms     os.FileMode
+	FilePerms    os.FileMode
+}
+
+type segment struct {
+	path string
+	// index is the index of the first entry in the file
+	index uint64
+	// offsets[i] is the offset of the entry index+i in the file
+	offsets []int64
+	size    int64
+	file    *os.File
+}
+
+// Log is a WAL made of segment files, entries are appended to the last segment
+type Log struct {
+	path    string
+	options *Options
+
+	lock     sync.RWMutex
+	segments []*segment
+	// first and last are the indexes of the first and the last entry, both are 0 if the log is
+	// empty
+	first  uint64
+	last   uint64
+	closed bool
+
+	// syncLock serializes fsyncs, the writers waiting for it share the fsync of the leader
+	syncLock sync.Mutex
+	// synced is the last index that is durable, guarded by syncLock
+	synced uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+var _ log.WalLog = (*Log)(nil)
+var _ log.SegmentStater = (*Log)(nil)
+
+// Open opens the log in the directory, the directory is created if it does not exist
+func Open(p string, options *Options) (*Log, error) {
+	if err := os.MkdirAll(p, options.DirPerms); err != nil {
+		return nil, err
+	}
+	l := &Log{path: p, options: options}
+	if err := l.load(); err != nil {
+		l.closeFiles()
+		return nil, err
+	}
+	l.synced = l.last
+	if !options.NoSync && options.SyncInterval > 0 {
+		l.stop = make(chan struct{})
+		l.done = make(chan struct{})
+		go l.syncPeriodically()
+	}
+	return l, nil
+}
+
+func (l *Log) load() error {
+	entries, err := os.ReadDir(l.path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || len(name) != segmentNameLen {
+			continue
+		}
+		index, err := strconv.ParseUint(name, 10, 64)
+		if err != nil || index == 0 {
+			continue
+		}
+		l.segments = append(l.segments, &segment{path: path.Join(l.path, name), index: index})
+	}
+	sort.Slice(l.segments, func(i, j int) bool {
+		return l.segments[i].index < l.segments[j].index
+	})
+	for i, s := range l.segments {
+		if err := s.load(l.options.FilePerms, i == len(l.segments)-1); err != nil {
+			return err
+		}
+	}
+	if len(l.segments) == 0 {
+		s, err := createSegment(l.path, 1, l.options.FilePerms)
+		if err != nil {
+			return err
+		}
+		l.segments = append(l.segments, s)
+	}
+	tail := l.segments[len(l.segments)-1]
+	l.last = tail.index + uint64(len(tail.offsets)) - 1
+	if l.last < l.segments[0].index {
+		// no entry at all
+		l.last = 0
+		return nil
+	}
+	l.first = l.segments[0].index
+	data, err := os.ReadFile(path.Join(l.path, firstIndexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		first, err := strconv.ParseUint(string(data), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: invalid %s: %s", ErrCorrupt, firstIndexFile, data)
+		}
+		if first > l.first && first <= l.last {
+			l.first = first
+		}
+	}
+	return l.removeSegmentsBefore(l.first)
+}
+
+func createSegment(dir string, index uint64, perm os.FileMode) (*segment, error) {
+	p := path.Join(dir, fmt.Sprintf("%020d", index))
+	file, err := os.OpenFile(p, os.O_CREATE|os.O_RDWR|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &segment{path: p, index: index, file: file}, nil
+}
+
+// load opens the segment file and indexes its entries. A torn write at the end of the last
+// segment is cut off, which is left by a crash, but any corruption of the others is an error.
+func (s *segment) load(perm os.FileMode, tail bool) error {
+	file, err := os.OpenFile(s.path, os.O_RDWR, perm)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var offset int64
+	size := int64(len(data))
+	for offset < size {
+		if size-offset < entryHeaderSize {
+			break
+		}
+		length := int64(binary.BigEndian.Uint32(data[offset:]))
+		if offset+entryHeaderSize+length > size {
+			break
+		}
+		checksum := binary.BigEndian.Uint32(data[offset+4:])
+		entry := data[offset+entryHeaderSize : offset+entryHeaderSize+length]
+		if crc32.Checksum(entry, crcTable) != checksum {
+			break
+		}
+		s.offsets = append(s.offsets, offset)
+		offset += entryHeaderSize + length
+	}
+	if offset < size {
+		if !tail {
+			return fmt.Errorf("%w: segment %s at offset %d", ErrCorrupt, s.path, offset)
+		}
+		if err := file.Truncate(offset); err != nil {
+			return err
+		}
+	}
+	s.size = offset
+	return nil
+}
+
+func (l *Log) Write(data []byte) error {
+	_, err := l.BWrite([][]byte{data})
+	return err
+}
+
+// BWrite appends datas to the log and returns the index of the last written entry.
+// Unless NoSync or SyncInterval is set, it returns after the datas are synced to disk, along with
+// the datas written by the other concurrent BWrite calls.
+func (l *Log) BWrite(datas [][]byte) (uint64, error) {
+	size := 0
+	for _, data := range datas {
+		size += entryHeaderSize + len(data)
+	}
+	buf := make([]byte, 0, size)
+	offsets := make([]int64, len(datas))
+	for i, data := range datas {
+		offsets[i] = int64(len(buf))
+		var header [entryHeaderSize]byte
+		binary.BigEndian.PutUint32(header[0:4], uint32(len(data)))
+		binary.BigEndian.PutUint32(header[4:8], crc32.Checksum(data, crcTable))
+		buf = append(buf, header[:]...)
+		buf = append(buf, data...)
+	}
+
+	l.lock.Lock()
+	if l.closed {
+		l.lock.Unlock()
+		return 0, ErrClosed
+	}
+	tail := l.segments[len(l.segments)-1]
+	if tail.size > 0 && tail.size+int64(len(buf)) > l.options.SegmentSize {
+		var err error
+		if tail, err = l.roll(); err != nil {
+			l.lock.Unlock()
+			return 0, err
+		}
+	}
+	if _, err := tail.file.WriteAt(buf, tail.size); err != nil {
+		// cut off the partial write
+		_ = tail.file.Truncate(tail.size)
+		l.lock.Unlock()
+		return 0, err
+	}
+	for _, offset := range offsets {
+		tail.offsets = append(tail.offsets, tail.size+offset)
+	}
+	tail.size += int64(len(buf))
+	if l.first == 0 {
+		l.first = tail.index
+		l.last = tail.index - 1
+	}
+	l.last += uint64(len(datas))
+	last := l.last
+	l.lock.Unlock()
+
+	if !l.options.NoSync && l.options.SyncInterval == 0 {
+		if err := l.sync(last); err != nil {
+			return 0, err
+		}
+	}
+	return last, nil
+}
+
+// roll syncs the segment being written and starts a new one, it must be called with lock held
+func (l *Log) roll() (*segment, error) {
+	tail := l.segments[len(l.segments)-1]
+	if !l.options.NoSync {
+		if err := tail.file.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	s, err := createSegment(l.path, l.last+1, l.options.FilePerms)
+	if err != nil {
+		return nil, err
+	}
+	l.segments = append(l.segments, s)
+	return s, nil
+}
+
+// sync makes the entries up to index durable. Only one fsync runs at a time, the writers queued
+// behind it find their entries synced by the leader and return without another fsync.
+func (l *Log) sync(index uint64) error {
+	l.syncLock.Lock()
+	defer l.syncLock.Unlock()
+	if l.synced >= index {
+		return nil
+	}
+	l.lock.RLock()
+	if l.closed {
+		l.lock.RUnlock()
+		return ErrClosed
+	}
+	last := l.last
+	// the segments before the last one are synced when they are rolled
+	file := l.segments[len(l.segments)-1].file
+	l.lock.RUnlock()
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	l.synced = last
+	return nil
+}
+
+func (l *Log) syncPeriodically() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.options.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			last, _ := l.LastIndex()
+			_ = l.sync(last)
+		}
+	}
+}
+
+func (l *Log) Read(index uint64) ([]byte, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.closed {
+		return nil, ErrClosed
+	}
+	if l.first == 0 || index < l.first || index > l.last {
+		return nil, ErrNotFound
+	}
+	s := l.segments[l.findSegment(index)]
+	i := index - s.index
+	start := s.offsets[i]
+	end := s.size
+	if i+1 < uint64(len(s.offsets)) {
+		end = s.offsets[i+1]
+	}
+	buf := make([]byte, end-start)
+	if _, err := s.file.ReadAt(buf, start); err != nil {
+		return nil, err
+	}
+	data := buf[entryHeaderSize:]
+	if crc32.Checksum(data, crcTable) != binary.BigEndian.Uint32(buf[4:8]) {
+		return nil, fmt.Errorf("%w: entry %d in segment %s", ErrCorrupt, index, s.path)
+	}
+	return data, nil
+}
+
+// findSegment returns the position of the segment containing index
+func (l *Log) findSegment(index uint64) int {
+	return sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].index > index
+	}) - 1
+}
+
+func (l *Log) FirstIndex() (uint64, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.closed {
+		return 0, ErrClosed
+	}
+	return l.first, nil
+}
+
+func (l *Log) LastIndex() (uint64, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.closed {
+		return 0, ErrClosed
+	}
+	return l.last, nil
+}
+
+// TruncateFront removes the entries before index, index becomes the first entry
+func (l *Log) TruncateFront(index uint64) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	if l.first == 0 || index < l.first || index > l.last {
+		return ErrOutOfRange
+	}
+	if index == l.first {
+		return nil
+	}
+	// persist the first index before removing any segment, so that a crash in between never
+	// exposes the removed entries again
+	tmp := path.Join(l.path, firstIndexFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(index, 10)), l.options.FilePerms); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path.Join(l.path, firstIndexFile)); err != nil {
+		return err
+	}
+	l.first = index
+	return l.removeSegmentsBefore(index)
+}
+
+// removeSegmentsBefore removes the segments whose entries are all before index, it must be called
+// with lock held
+func (l *Log) removeSegmentsBefore(index uint64) error {
+	keep := l.findSegment(index)
+	for _, s := range l.segments[:keep] {
+		_ = s.file.Close()
+		if err := os.Remove(s.path); err != nil {
+			return err
+		}
+	}
+	l.segments = l.segments[keep:]
+	return nil
+}
+
+// TruncateBack removes the entries after index, index becomes the last entry
+func (l *Log) TruncateBack(index uint64) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	if l.first == 0 || index < l.first || index > l.last {
+		return ErrOutOfRange
+	}
+	if index == l.last {
+		return nil
+	}
+	keep := l.findSegment(index)
+	for _, s := range l.segments[keep+1:] {
+		_ = s.file.Close()
+		if err := os.Remove(s.path); err != nil {
+			return err
+		}
+	}
+	l.segments = l.segments[:keep+1]
+	tail := l.segments[keep]
+	i := index - tail.index + 1
+	size := tail.size
+	if i < uint64(len(tail.offsets)) {
+		size = tail.offsets[i]
+	}
+	if err := tail.file.Truncate(size); err != nil {
+		return err
+	}
+	tail.offsets = tail.offsets[:i]
+	tail.size = size
+	l.last = index
+	l.syncLock.Lock()
+	if l.synced > index {
+		l.synced = index
+	}
+	l.syncLock.Unlock()
+	return nil
+}
+
+// SegmentStats returns the statistics of the segment files in order
+func (l *Log) SegmentStats() []log.SegmentStat {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	stats := make([]log.SegmentStat, 0, len(l.segments))
+	for _, s := range l.segments {
+		stat := log.SegmentStat{Path: s.path, Size: s.size}
+		if len(s.offsets) > 0 {
+			stat.FirstIndex = s.index
+			if stat.FirstIndex < l.first {
+				stat.FirstIndex = l.first
+			}
+			stat.LastIndex = s.index + uint64(len(s.offsets)) - 1
+			stat.Entries = stat.LastIndex - stat.FirstIndex + 1
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+func (l *Log) Close() error {
+	l.lock.Lock()
+	if l.closed {
+		l.lock.Unlock()
+		return ErrClosed
+	}
+	l.closed = true
+	l.lock.Unlock()
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+	}
+	var err error
+	if !l.options.NoSync && len(l.segments) > 0 {
+		err = l.segments[len(l.segments)-1].file.Sync()
+	}
+	l.closeFiles()
+	return err
+}
+
+func (l *Log) closeFiles() {
+	for _, s := range l.segments {
+		if s.file != nil {
+			_ = s.file.Close()
+		}
+	}
+}
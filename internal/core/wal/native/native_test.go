@@ -0,0 +1,128 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package native
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testOptions() *Options {
+	return &Options{SegmentSize: 256, DirPerms: 0750, FilePerms: 0640}
+}
+
+func TestLog(t *testing.T) {
+	t.Run("test_write_read", func(t *testing.T) {
+		l, err := Open(t.TempDir(), testOptions())
+		assert.NoError(t, err)
+		defer l.Close()
+		first, _ := l.FirstIndex()
+		last, _ := l.LastIndex()
+		assert.Equal(t, uint64(0), first)
+		assert.Equal(t, uint64(0), last)
+		for i := 1; i <= 100; i++ {
+			assert.NoError(t, l.Write([]byte(fmt.Sprintf("entry-%d", i))))
+		}
+		last, err = l.BWrite([][]byte{[]byte("entry-101"), []byte("entry-102")})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(102), last)
+		for i := 1; i <= 102; i++ {
+			data, err := l.Read(uint64(i))
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("entry-%d", i), string(data))
+		}
+		_, err = l.Read(103)
+		assert.ErrorIs(t, err, ErrNotFound)
+		// the small segment size makes the log roll
+		stats := l.SegmentStats()
+		assert.Greater(t, len(stats), 1)
+		entries := uint64(0)
+		for _, stat := range stats {
+			entries += stat.Entries
+		}
+		assert.Equal(t, uint64(102), entries)
+	})
+
+	t.Run("test_group_commit", func(t *testing.T) {
+		l, err := Open(t.TempDir(), testOptions())
+		assert.NoError(t, err)
+		defer l.Close()
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := l.BWrite([][]byte{[]byte("entry")})
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+		last, _ := l.LastIndex()
+		assert.Equal(t, uint64(50), last)
+		assert.Equal(t, uint64(50), l.synced)
+	})
+
+	t.Run("test_truncate_and_reopen", func(t *testing.T) {
+		dir := t.TempDir()
+		l, err := Open(dir, testOptions())
+		assert.NoError(t, err)
+		for i := 1; i <= 100; i++ {
+			assert.NoError(t, l.Write([]byte(fmt.Sprintf("entry-%d", i))))
+		}
+		segments := len(l.SegmentStats())
+		assert.NoError(t, l.TruncateFront(60))
+		assert.Less(t, len(l.SegmentStats()), segments)
+		_, err = l.Read(59)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, l.TruncateBack(90))
+		assert.ErrorIs(t, l.TruncateFront(91), ErrOutOfRange)
+		assert.NoError(t, l.Close())
+
+		l, err = Open(dir, testOptions())
+		assert.NoError(t, err)
+		defer l.Close()
+		first, _ := l.FirstIndex()
+		last, _ := l.LastIndex()
+		assert.Equal(t, uint64(60), first)
+		assert.Equal(t, uint64(90), last)
+		data, err := l.Read(60)
+		assert.NoError(t, err)
+		assert.Equal(t, "entry-60", string(data))
+		last, err = l.BWrite([][]byte{[]byte("entry-91")})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(91), last)
+	})
+
+	t.Run("test_torn_write", func(t *testing.T) {
+		dir := t.TempDir()
+		l, err := Open(dir, testOptions())
+		assert.NoError(t, err)
+		for i := 1; i <= 3; i++ {
+			assert.NoError(t, l.Write([]byte(fmt.Sprintf("entry-%d", i))))
+		}
+		assert.NoError(t, l.Close())
+		// a crash leaves a partial entry at the end of the last segment
+		f, err := os.OpenFile(path.Join(dir, fmt.Sprintf("%020d", 1)), os.O_APPEND|os.O_WRONLY, 0)
+		assert.NoError(t, err)
+		_, err = f.Write([]byte{0, 0, 0, 9, 1, 2})
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+
+		l, err = Open(dir, testOptions())
+		assert.NoError(t, err)
+		defer l.Close()
+		last, _ := l.LastIndex()
+		assert.Equal(t, uint64(3), last)
+		last, err = l.BWrite([][]byte{[]byte("entry-4")})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(4), last)
+		data, err := l.Read(4)
+		assert.NoError(t, err)
+		assert.Equal(t, "entry-4", string(data))
+	})
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package wal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+// A record batches the operations of a write into one WAL entry:
+//
+//	+-----------+-------------+-----------+------------+------------------+
+//	| magic (1) | version (1) | codec (1) | crc32c (4) | payload          |
+//	+-----------+-------------+-----------+------------+------------------+
+//
+// The payload is the JSON array of the operations compressed by the codec, and the CRC-32
+// (Castagnoli) checksum covers the compressed payload.
+// The entries written by earlier versions are plain JSON, they always start with '{' and never
+// with the magic byte, so both can be told apart and read.
+const (
+	recordMagic      byte = 0xDB
+	recordVersion1   byte = 1
+	recordHeaderSize      = 7
+)
+
+// codecs of the record payload
+const (
+	codecNone   byte = 0
+	codecSnappy byte = 1
+	codecZstd   byte = 2
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+	// zstd encoders and decoders are safe for concurrent use of EncodeAll and DecodeAll
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// encodeRecord encodes the operations into a record, compressing them with the given compression
+func encodeRecord(ops []*protocol.Operation, compression string) ([]byte, error) {
+	payload, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	var codec byte
+	switch compression {
+	case consts.WalCompressionNone:
+		codec = codecNone
+	case consts.WalCompressionSnappy:
+		codec = codecSnappy
+		payload = snappy.Encode(nil, payload)
+	case consts.WalCompressionZstd:
+		codec = codecZstd
+		payload = zstdEncoder.EncodeAll(payload, nil)
+	default:
+		return nil, fmt.Errorf("unsupported wal compression: %s", compression)
+	}
+	record := make([]byte, recordHeaderSize+len(payload))
+	record[0] = recordMagic
+	record[1] = recordVersion1
+	record[2] = codec
+	binary.BigEndian.PutUint32(record[3:recordHeaderSize], crc32.Checksum(payload, crcTable))
+	copy(record[recordHeaderSize:], payload)
+	return record, nil
+}
+
+// decodeRecord decodes a WAL entry into operations, the entry is either a record or a plain JSON
+// operation (or document) written by earlier versions
+func decodeRecord(data []byte) ([]*protocol.Operation, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty wal entry")
+	}
+	if data[0] != recordMagic {
+		op, err := decodeOperation(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*protocol.Operation{op}, nil
+	}
+	if len(data) < recordHeaderSize {
+		return nil, fmt.Errorf("wal record is truncated, size: %d", len(data))
+	}
+	if data[1] != recordVersion1 {
+		return nil, fmt.Errorf("unsupported wal record version: %d", data[1])
+	}
+	payload := data[recordHeaderSize:]
+	expected := binary.BigEndian.Uint32(data[3:recordHeaderSize])
+	if actual := crc32.Checksum(payload, crcTable); actual != expected {
+		return nil, fmt.Errorf(
+			"wal record checksum mismatch, expected: %d, actual: %d",
+			expected,
+			actual,
+		)
+	}
+	var err error
+	switch data[2] {
+	case codecNone:
+	case codecSnappy:
+		payload, err = snappy.Decode(nil, payload)
+	case codecZstd:
+		payload, err = zstdDecoder.DecodeAll(payload, nil)
+	default:
+		return nil, fmt.Errorf("unsupported wal record codec: %d", data[2])
+	}
+	if err != nil {
+		return nil, err
+	}
+	ops := make([]*protocol.Operation, 0)
+	if err := json.Unmarshal(payload, &ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package wal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+func TestRecord(t *testing.T) {
+	ops := []*protocol.Operation{
+		{
+			Action:   consts.ActionCreate,
+			ID:       "1",
+			Document: protocol.Document{"_id": "1", "message": "GET /index.html 200"},
+		},
+		{
+			Action:   consts.ActionUpdate,
+			ID:       "1",
+			Document: protocol.Document{"message": "GET /index.html 404"},
+		},
+		{Action: consts.ActionDelete, ID: "2"},
+	}
+
+	t.Run("test_round_trip", func(t *testing.T) {
+		for _, compression := range []string{
+			consts.WalCompressionNone,
+			consts.WalCompressionSnappy,
+			consts.WalCompressionZstd,
+		} {
+			record, err := encodeRecord(ops, compression)
+			assert.NoError(t, err)
+			assert.Equal(t, recordMagic, record[0])
+			decoded, err := decodeRecord(record)
+			assert.NoError(t, err)
+			assert.Equal(t, ops, decoded)
+		}
+		_, err := encodeRecord(ops, "lz4")
+		assert.Error(t, err)
+	})
+
+	t.Run("test_corruption", func(t *testing.T) {
+		record, err := encodeRecord(ops, consts.WalCompressionZstd)
+		assert.NoError(t, err)
+		record[len(record)-1] ^= 0xFF
+		_, err = decodeRecord(record)
+		assert.Error(t, err)
+		_, err = decodeRecord(record[:recordHeaderSize-1])
+		assert.Error(t, err)
+	})
+
+	t.Run("test_legacy_entries", func(t *testing.T) {
+		// an operation written as plain JSON
+		data, err := json.Marshal(ops[2])
+		assert.NoError(t, err)
+		decoded, err := decodeRecord(data)
+		assert.NoError(t, err)
+		assert.Equal(t, []*protocol.Operation{ops[2]}, decoded)
+		// a document written as plain JSON
+		decoded, err = decodeRecord([]byte(`{"_id":"3","message":"hello"}`))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(decoded))
+		assert.Equal(t, consts.ActionCreate, decoded[0].Action)
+		assert.Equal(t, "hello", decoded[0].Document["message"])
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package wal
+
+import (
+	"os"
+	"path"
+	"sync"
+
+	"github.com/sourcegraph/conc/pool"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/common/utils"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"go.uber.org/zap"
+)
+
+// RecoveryStatus describes the progress of recovering the WALs left by the last run
+type RecoveryStatus struct {
+	// Total is the number of shards that have WAL to recover
+	Total int
+	// Recovered is the number of shards whose WAL has been drained
+	Recovered int
+	// Failed is the number of shards whose WAL failed to be drained
+	Failed int
+	// Done reports whether the recovery is finished
+	Done bool
+}
+
+var (
+	// recoveryStatus is done until Recover finds any WAL to recover
+	recoveryStatus = RecoveryStatus{Done: true}
+	recoveryLock   sync.RWMutex
+)
+
+// GetRecoveryStatus returns a snapshot of the recovery progress
+func GetRecoveryStatus() RecoveryStatus {
+	recoveryLock.RLock()
+	defer recoveryLock.RUnlock()
+	return recoveryStatus
+}
+
+// Recover scans the WAL directory for every shard known to metadata, then opens the WALs found
+// there and drains them in the background, so that the documents written before restarting
+// become visible without waiting for a new write to reach the same shard.
+// The progress can be viewed by GetRecoveryStatus once Recover returns.
+func Recover() {
+	shards := make([]*core.Shard, 0)
+	for _, index := range metadata.GetAllIndexes() {
+		for _, shard := range index.Shards {
+			p := path.Join(config.Cfg.GetFSPath(), consts.PathWAL, shard.GetName())
+			if _, err := os.Stat(p); err != nil {
+				if !os.IsNotExist(err) {
+					logger.Error("stat wal failed", zap.String("path", p), zap.Error(err))
+				}
+				continue
+			}
+			shards = append(shards, shard)
+		}
+	}
+	logger.Info("recover wals start", zap.Int("shards", len(shards)))
+	if len(shards) == 0 {
+		return
+	}
+	recoveryLock.Lock()
+	recoveryStatus = RecoveryStatus{Total: len(shards)}
+	recoveryLock.Unlock()
+	go recoverWALs(shards)
+}
+
+func recoverWALs(shards []*core.Shard) {
+	defer utils.Timerf("recover wals finish")()
+	p := pool.New().WithMaxGoroutines(config.Cfg.Wal.Parallel)
+	for _, shard := range shards {
+		s := shard
+		p.Go(func() {
+			err := recoverWAL(s)
+			recoveryLock.Lock()
+			if err != nil {
+				recoveryStatus.Failed++
+			} else {
+				recoveryStatus.Recovered++
+			}
+			status := recoveryStatus
+			recoveryLock.Unlock()
+			if err != nil {
+				logger.Error("recover wal failed", zap.String("name", s.GetName()), zap.Error(err))
+			}
+			logger.Info(
+				"recover wals progress",
+				zap.String("name", s.GetName()),
+				zap.Int("recovered", status.Recovered),
+				zap.Int("failed", status.Failed),
+				zap.Int("total", status.Total),
+			)
+		})
+	}
+	p.Wait()
+
+	recoveryLock.Lock()
+	recoveryStatus.Done = true
+	recoveryLock.Unlock()
+	logger.Info("recover wals success", zap.Any("status", GetRecoveryStatus()))
+}
+
+// recoverWAL opens the WAL of the shard and consumes it to the last entry
+func recoverWAL(shard *core.Shard) error {
+	wal, err := getOrOpenWAL(shard)
+	if err != nil {
+		return err
+	}
+	lastIndex, err := wal.LastIndex()
+	if err != nil {
+		return err
+	}
+	logger.Info(
+		"recover wal",
+		zap.String("name", shard.GetName()),
+		zap.Uint64("from", shard.GetWalIndex()),
+		zap.Uint64("to", lastIndex),
+	)
+	return ForceConsumeWAL(shard, lastIndex)
+}
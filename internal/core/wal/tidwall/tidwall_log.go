@@ -24,18 +24,21 @@ func (twal *TWalLog) Write(data []byte) error {
 	return twal.Log.Write(lastIndex+1, data)
 }
 
-func (twal *TWalLog) BWrite(datas [][]byte) error {
+func (twal *TWalLog) BWrite(datas [][]byte) (uint64, error) {
 	twal.Lock.Lock()
 	defer twal.Lock.Unlock()
 	lastIndex, err := twal.Log.LastIndex()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	b := new(wal.Batch)
 	for i, data := range datas {
 		b.Write(lastIndex+uint64(i+1), data)
 	}
-	return twal.Log.WriteBatch(b)
+	if err = twal.Log.WriteBatch(b); err != nil {
+		return 0, err
+	}
+	return lastIndex + uint64(len(datas)), nil
 }
 
 func (twal *TWalLog) Read(index uint64) ([]byte, error) {
@@ -16,6 +16,7 @@ import (
 
 	"github.com/tatris-io/tatris/internal/core"
 
+	"github.com/tatris-io/tatris/internal/core/wal/native"
 	"github.com/tatris-io/tatris/internal/core/wal/tidwall"
 	"github.com/tidwall/wal"
 
@@ -31,24 +32,28 @@ import (
 	"github.com/tatris-io/tatris/internal/common/log/logger"
 	"github.com/tatris-io/tatris/internal/common/utils"
 	"github.com/tatris-io/tatris/internal/core/wal/log"
+	"github.com/tatris-io/tatris/internal/indexlib"
 	"github.com/tatris-io/tatris/internal/meta/metadata"
 	"go.uber.org/zap"
 )
 
-const (
-	consumptionLimit = 5000
-)
-
 var (
 	wals *cache.Cache
 	lock sync.Mutex
+	// consumeLocks guarantees that the WAL of a shard is consumed by one goroutine at a time
+	consumeLocks sync.Map
+	// DeadLetter writes the documents rejected by the index writer into the dead-letter index of
+	// their index, it is set by the ingestion package which depends on this package
+	DeadLetter func(index *core.Index, docs []protocol.Document, rejections []error)
 )
 
 func init() {
 	wals = cache.New(cache.NoExpiration, cache.NoExpiration)
+	// consume all the WALs periodically as a fallback of the consumption signaled by writes, the
+	// interval is read each time since the config may be loaded after this package initialized
 	go func() {
-		ticker := time.NewTicker(time.Second)
-		for range ticker.C {
+		for {
+			time.Sleep(config.Cfg.Wal.ConsumeInterval)
 			ConsumeWALs()
 		}
 	}()
@@ -61,6 +66,23 @@ func OpenWAL(shard *core.Shard) (log.WalLog, error) {
 	options := config.Cfg.Wal
 	p := path.Join(config.Cfg.GetFSPath(), consts.PathWAL, name)
 	logger.Info("open wal", zap.String("name", name), zap.Any("options", options))
+	var walLog log.WalLog
+	var err error
+	if options.Type == consts.WalTypeNative {
+		walLog, err = openNativeWAL(p, options)
+	} else {
+		walLog, err = openTidwallWAL(p, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+	shard.Wal = walLog
+	wals.Set(name, walLog, cache.NoExpiration)
+	startConsumer(shard, walLog)
+	return walLog, nil
+}
+
+func openTidwallWAL(p string, options *config.Wal) (log.WalLog, error) {
 	twalLog := &tidwall.TWalLog{}
 	twalOptions := &wal.Options{}
 	twalOptions.NoSync = options.NoSync
@@ -80,44 +102,82 @@ func OpenWAL(shard *core.Shard) (log.WalLog, error) {
 		return nil, err
 	}
 	twalLog.Log = l
-	shard.Wal = twalLog
+	return twalLog, nil
+}
 
-	if err != nil {
-		return nil, err
+func openNativeWAL(p string, options *config.Wal) (log.WalLog, error) {
+	return native.Open(p, &native.Options{
+		SegmentSize:  int64(options.SegmentSize),
+		NoSync:       options.NoSync,
+		SyncInterval: options.SyncInterval,
+		DirPerms:     options.DirPerms,
+		FilePerms:    options.FilePerms,
+	})
+}
+
+// getOrOpenWAL returns the WAL of the shard, the WAL is opened if it is not open yet
+func getOrOpenWAL(shard *core.Shard) (log.WalLog, error) {
+	if wal := shard.Wal; wal != nil {
+		return wal, nil
 	}
-	wals.Set(name, twalLog, cache.NoExpiration)
-	return twalLog, nil
+	lock.Lock()
+	defer lock.Unlock()
+	if wal := shard.Wal; wal != nil {
+		return wal, nil
+	}
+	return OpenWAL(shard)
 }
 
-func ProduceWAL(shard *core.Shard, docs []protocol.Document) error {
+// ProduceWAL writes operations to the WAL of the shard and returns the index of the written entry.
+// The operations are encoded in order into one compressed record, which takes one entry.
+func ProduceWAL(shard *core.Shard, ops []*protocol.Operation) (uint64, error) {
 	name := shard.GetName()
-	defer utils.Timerf("produce wal finish, name:%s, size:%d", name, len(docs))()
-	wal := shard.Wal
-	var err error
-	if wal == nil {
-		lock.Lock()
-		wal = shard.Wal
-		if wal == nil {
-			if wal, err = OpenWAL(shard); err != nil {
-				return err
-			}
-		}
-		lock.Unlock()
+	defer utils.Timerf("produce wal finish, name:%s, size:%d", name, len(ops))()
+	wal, err := getOrOpenWAL(shard)
+	if err != nil {
+		return 0, err
 	}
-	datas := make([][]byte, 0)
-	for _, doc := range docs {
-		data, err := json.Marshal(doc)
-		if err != nil {
-			return err
-		}
-		datas = append(datas, data)
+	record, err := encodeRecord(ops, config.Cfg.Wal.Compression)
+	if err != nil {
+		return 0, err
 	}
-	return wal.BWrite(datas)
+	lastIndex, err := wal.BWrite([][]byte{record})
+	if err != nil {
+		return 0, err
+	}
+	signalConsumer(name, len(ops))
+	return lastIndex, nil
+}
+
+// rejection is the documents rejected by the index writer when the WAL of a shard is consumed
+type rejection struct {
+	index      *core.Index
+	docs       []protocol.Document
+	rejections []error
 }
 
 func ConsumeWALs() {
-	p := pool.New().WithMaxGoroutines(config.Cfg.Wal.Parallel)
 	defer utils.Timerf("consume wals finish")()
+	// the rejected documents are written into the dead-letter indexes after the lock is released,
+	// since writing them may open the WALs of the dead-letter indexes, which takes the lock
+	var rejectedLock sync.Mutex
+	rejected := make([]*rejection, 0)
+	var collect func(*core.Index, []protocol.Document, []error)
+	if DeadLetter != nil {
+		collect = func(index *core.Index, docs []protocol.Document, rejections []error) {
+			rejectedLock.Lock()
+			defer rejectedLock.Unlock()
+			rejected = append(rejected, &rejection{index, docs, rejections})
+		}
+	}
+	consumeWALs(collect)
+	for _, r := range rejected {
+		DeadLetter(r.index, r.docs, r.rejections)
+	}
+}
+
+func consumeWALs(deadLetter func(*core.Index, []protocol.Document, []error)) {
+	p := pool.New().WithMaxGoroutines(config.Cfg.Wal.Parallel)
 	lock.Lock()
 	defer lock.Unlock()
 	items := wals.Items()
@@ -142,6 +202,7 @@ func ConsumeWALs() {
 				if errs.IsIndexNotFound(err) || errs.IsShardNotFound(err) {
 					// index or shard has been deleted, clear wal
 					wals.Delete(n)
+					stopConsumer(n)
 					wallog.Close()
 					var p string
 					if errs.IsIndexNotFound(err) {
@@ -158,7 +219,7 @@ func ConsumeWALs() {
 				}
 				return
 			}
-			err = ConsumeWAL(shard, wallog)
+			err = consumeWAL(shard, wallog, deadLetter)
 			if err != nil {
 				logger.Error(
 					"consume shard wal failed",
@@ -172,10 +233,57 @@ func ConsumeWALs() {
 	p.Wait()
 }
 
+// ForceConsumeWAL consumes the WAL of the shard immediately until walIndex is consumed, rather
+// than waiting for the periodic consumption.
+func ForceConsumeWAL(shard *core.Shard, walIndex uint64) error {
+	for {
+		consumed := shard.GetWalIndex()
+		if consumed >= walIndex {
+			return nil
+		}
+		if shard.Wal == nil {
+			return fmt.Errorf("wal of shard %s is not open", shard.GetName())
+		}
+		if err := ConsumeWAL(shard, shard.Wal); err != nil {
+			return err
+		}
+		if shard.GetWalIndex() == consumed {
+			return fmt.Errorf(
+				"wal of shard %s can not be consumed to %d, stuck at %d",
+				shard.GetName(),
+				walIndex,
+				consumed,
+			)
+		}
+	}
+}
+
+// LockConsumption stops the WAL of the shard from being consumed until the returned function is
+// called, so that the segments of the shard are neither written nor deleted from meanwhile
+func LockConsumption(shard *core.Shard) func() {
+	consumeLock, _ := consumeLocks.LoadOrStore(shard.GetName(), &sync.Mutex{})
+	consumeLock.(*sync.Mutex).Lock()
+	return consumeLock.(*sync.Mutex).Unlock
+}
+
+// ConsumeWAL consumes a batch of the WAL of the shard, the documents rejected by the index writer
+// are written into the dead-letter index right away
 func ConsumeWAL(shard *core.Shard, wal log.WalLog) error {
+	return consumeWAL(shard, wal, DeadLetter)
+}
+
+func consumeWAL(
+	shard *core.Shard,
+	wal log.WalLog,
+	deadLetter func(*core.Index, []protocol.Document, []error),
+) error {
 	name := shard.GetName()
 	defer utils.Timerf("consume wal finish, name:%s", name)()
 
+	consumeLock, _ := consumeLocks.LoadOrStore(name, &sync.Mutex{})
+	consumeLock.(*sync.Mutex).Lock()
+	defer consumeLock.(*sync.Mutex).Unlock()
+
 	var err error
 
 	defer func() {
@@ -224,36 +332,34 @@ func ConsumeWAL(shard *core.Shard, wal log.WalLog) error {
 		}
 	}
 
-	// from is the last index we need to consume
-	to := lastIndex
-	if to > from+consumptionLimit-1 {
-		to = from + consumptionLimit - 1
-	}
-
-	if from > to {
+	if from > lastIndex {
 		return nil
 	}
 	logger.Info(
 		"consume shard wal start",
 		zap.String("name", name),
 		zap.Uint64("from", from),
-		zap.Uint64("to", to),
+		zap.Uint64("last", lastIndex),
 	)
-	docs := make([]protocol.Document, 0)
-	for i := from; i <= to; i++ {
-		l, err := wal.Read(i)
+	// an entry holds the operations of a write, the entries are read until the operations fill a
+	// batch, so a batch may exceed the batch size by the operations of its last entry
+	batchSize := config.Cfg.Wal.ConsumeBatchSize
+	ops := make([]*protocol.Operation, 0)
+	to := from - 1
+	for to < lastIndex && len(ops) < batchSize {
+		l, err := wal.Read(to + 1)
 		if err != nil {
 			return err
 		}
-		var doc protocol.Document
-		err = json.Unmarshal(l, &doc)
+		records, err := decodeRecord(l)
 		if err != nil {
 			return err
 		}
-		docs = append(docs, doc)
+		ops = append(ops, records...)
+		to++
 	}
 
-	err = persistDocuments(shard, docs, to)
+	err = persistDocuments(shard, ops, to, deadLetter)
 	if err != nil {
 		return err
 	}
@@ -270,12 +376,42 @@ func ConsumeWAL(shard *core.Shard, wal log.WalLog) error {
 		zap.Uint64("from", from),
 		zap.Uint64("to", to),
 		zap.Uint64("size", to-from+1),
+		zap.Int("ops", len(ops)),
 	)
 	return err
 }
 
+// decodeOperation decodes a plain JSON WAL entry into an operation.
+// The entries written by even earlier versions are plain documents, which are decoded as
+// creations.
+func decodeOperation(data []byte) (*protocol.Operation, error) {
+	op := &protocol.Operation{}
+	if err := json.Unmarshal(data, op); err != nil {
+		return nil, err
+	}
+	if op.Action != "" {
+		return op, nil
+	}
+	var doc protocol.Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	op.Action = consts.ActionCreate
+	op.Document = doc
+	return op, nil
+}
+
+// persistDocuments applies the operations to the segments of the shard.
+// Creations are inserted into the latest segment, unless the documents with the same _id exist,
+// which happens when the WAL is consumed again after a crash. Indexes, updates and deletions
+// replace or remove the documents with the same _id, wherever they are located in the segments of
+// the shard. If config.Segment.LateThreshold is set, the late documents are written into the
+// segments of their time buckets instead of the latest segment.
+// The documents rejected by the index writer are handed over to deadLetter if the index enables
+// the dead letter, rather than blocking the consumption forever.
 func persistDocuments(shard *core.Shard,
-	docs []protocol.Document, walIndex uint64) error {
+	ops []*protocol.Operation, walIndex uint64,
+	deadLetter func(*core.Index, []protocol.Document, []error)) error {
 	shard.CheckSegments()
 	segment := shard.GetLatestSegment()
 	if segment == nil {
@@ -284,15 +420,99 @@ func persistDocuments(shard *core.Shard,
 			Shard: shard.ShardID,
 		}
 	}
-	writer, err := segment.GetWriter()
+
+	// find the existing documents that are touched by the operations, the generated _ids are
+	// never touched
+	touchedIDs := make([]string, 0)
+	for _, op := range ops {
+		if !op.AutoID {
+			touchedIDs = append(touchedIDs, op.ID)
+		}
+	}
+	existing, err := shard.FindDocuments(touchedIDs)
 	if err != nil {
 		return err
 	}
-	minTime, maxTime := time.UnixMilli(math.MaxInt64), time.UnixMilli(0)
+	current := make(map[string]protocol.Document)
+	for _, docs := range existing {
+		for docID, doc := range docs {
+			current[docID] = doc
+		}
+	}
+
+	// fold the operations into the final state of each document, nil means removed
 	idDocs := make(map[string]protocol.Document)
-	for _, doc := range docs {
-		docID := doc[consts.IDField].(string)
-		docTimestamp, err := utils.ParseTime(doc[consts.TimestampField])
+	replaced := make(map[string]bool)
+	for _, op := range ops {
+		switch op.Action {
+		case consts.ActionCreate:
+			doc, ok := idDocs[op.ID]
+			if !ok {
+				doc = current[op.ID]
+			}
+			if doc != nil {
+				logger.Warn(
+					"[wal] document to create exists",
+					zap.String("shard", shard.GetName()),
+					zap.String("id", op.ID),
+				)
+				continue
+			}
+			idDocs[op.ID] = op.Document
+		case consts.ActionIndex:
+			idDocs[op.ID] = op.Document
+			replaced[op.ID] = true
+		case consts.ActionDelete:
+			idDocs[op.ID] = nil
+			replaced[op.ID] = true
+		case consts.ActionUpdate:
+			doc, ok := idDocs[op.ID]
+			if !ok {
+				doc = current[op.ID]
+			}
+			if doc != nil {
+				idDocs[op.ID] = core.MergeDocument(doc, op.Document)
+			} else if op.Upsert != nil {
+				idDocs[op.ID] = op.Upsert
+			} else {
+				logger.Warn(
+					"[wal] document to update is missing",
+					zap.String("shard", shard.GetName()),
+					zap.String("id", op.ID),
+				)
+				continue
+			}
+			replaced[op.ID] = true
+		default:
+			logger.Warn(
+				"[wal] unsupported action",
+				zap.String("shard", shard.GetName()),
+				zap.String("action", op.Action),
+			)
+		}
+	}
+
+	// group the documents by the segments to write them into
+	timestampField := shard.Index.Mappings.TimestampField()
+	var lateBefore int64
+	if threshold := config.Cfg.Segment.LateThreshold; threshold > 0 {
+		lateBefore = time.Now().Add(-threshold).UnixMilli()
+	}
+	minTime, maxTime := time.UnixMilli(math.MaxInt64), time.UnixMilli(0)
+	writes := map[*core.Segment]*segmentWrite{segment: newSegmentWrite(segment)}
+	targets := make(map[string]*core.Segment)
+	written := 0
+	for docID, doc := range idDocs {
+		if doc == nil {
+			if replaced[docID] {
+				writes[segment].deleteIDs = append(writes[segment].deleteIDs, docID)
+				writes[segment].replace = true
+				targets[docID] = segment
+			}
+			continue
+		}
+		timestamp, _ := doc.Get(timestampField)
+		docTimestamp, err := utils.ParseTime(timestamp)
 		if err != nil {
 			return err
 		}
@@ -302,26 +522,183 @@ func persistDocuments(shard *core.Shard,
 		if docTimestamp.After(maxTime) {
 			maxTime = docTimestamp
 		}
-		idDocs[docID] = doc
+		target := segment
+		if lateBefore > 0 && docTimestamp.UnixMilli() < lateBefore {
+			bucket := docTimestamp.Truncate(config.Cfg.Segment.LateBucketSpan)
+			target = shard.GetLateSegment(bucket.UnixMilli())
+		}
+		w, ok := writes[target]
+		if !ok {
+			w = newSegmentWrite(target)
+			writes[target] = w
+		}
+		w.add(docID, doc, docTimestamp, replaced[docID])
+		targets[docID] = target
+		written++
+	}
+	if written == 0 {
+		minTime = time.UnixMilli(0)
+	}
+
+	// the old documents in the target segments are replaced by their writers directly, the ones
+	// in the other segments are deleted from their own segments
+	removed := 0
+	for seg, docs := range existing {
+		inPlace := 0
+		ids := make([]string, 0, len(docs))
+		for docID := range docs {
+			if !replaced[docID] {
+				continue
+			}
+			if targets[docID] == seg {
+				inPlace++
+			} else {
+				ids = append(ids, docID)
+			}
+		}
+		removed += inPlace + len(ids)
+		if inPlace > 0 {
+			seg.UpdateStat(time.UnixMilli(0), time.UnixMilli(0), -int64(inPlace))
+		}
+		if len(ids) > 0 {
+			if err = seg.DeleteDocuments(ids); err != nil {
+				return err
+			}
+		}
+	}
+
+	enabled := deadLetter != nil && shard.Index.Settings.DeadLetterIndex(shard.Index.Name) != ""
+	rejected := make([]protocol.Document, 0)
+	rejections := make([]error, 0)
+	for _, w := range writes {
+		if err = w.persist(enabled); err != nil {
+			return err
+		}
+		rejected = append(rejected, w.rejected...)
+		rejections = append(rejections, w.rejections...)
+	}
+	if len(rejected) > 0 {
+		written -= len(rejected)
+		deadLetter(shard.Index, rejected, rejections)
+	}
+	shard.UpdateStat(minTime, maxTime, int64(written-removed), walIndex)
+	err = metadata.SaveIndex(shard.Index)
+	if err != nil {
+		return err
+	}
+	shard.ConsumeIDs(ops, walIndex)
+	return nil
+}
+
+// segmentWrite is the documents to write into a segment
+type segmentWrite struct {
+	segment   *core.Segment
+	docs      map[string]protocol.Document
+	deleteIDs []string
+	// whether the writes replace or delete the existing documents
+	replace          bool
+	minTime, maxTime time.Time
+	// the documents rejected by the writer and the reasons
+	rejected   []protocol.Document
+	rejections []error
+}
+
+func newSegmentWrite(segment *core.Segment) *segmentWrite {
+	return &segmentWrite{
+		segment:   segment,
+		docs:      make(map[string]protocol.Document),
+		deleteIDs: make([]string, 0),
+		minTime:   time.UnixMilli(math.MaxInt64),
+		maxTime:   time.UnixMilli(0),
+	}
+}
+
+func (w *segmentWrite) add(docID string, doc protocol.Document, timestamp time.Time, replace bool) {
+	w.docs[docID] = doc
+	w.replace = w.replace || replace
+	if timestamp.Before(w.minTime) {
+		w.minTime = timestamp
+	}
+	if timestamp.After(w.maxTime) {
+		w.maxTime = timestamp
+	}
+}
+
+// persist writes the documents into the segment in a batch. If deadLetter is true, the documents
+// rejected by the writer are collected rather than failing the whole batch.
+func (w *segmentWrite) persist(deadLetter bool) error {
+	if len(w.docs) == 0 && len(w.deleteIDs) == 0 {
+		return nil
+	}
+	writer, err := w.segment.GetWriter()
+	if err != nil {
+		return err
+	}
+	if len(w.docs) == 0 {
+		w.minTime = time.UnixMilli(0)
 	}
 	logger.Info(
 		"ready to persist docs",
-		zap.String("index", shard.Index.Name),
-		zap.Int("shard", shard.ShardID),
-		zap.Int("segment", segment.SegmentID),
-		zap.Int("size", len(idDocs)),
-		zap.Time("minTime", minTime),
-		zap.Time("maxTime", maxTime),
+		zap.String("segment", w.segment.GetName()),
+		zap.Bool("late", w.segment.Late),
+		zap.Int("size", len(w.docs)),
+		zap.Int("deleted", len(w.deleteIDs)),
+		zap.Time("minTime", w.minTime),
+		zap.Time("maxTime", w.maxTime),
 	)
-	err = writer.Batch(idDocs)
-	if err != nil {
-		return err
+	if w.replace {
+		err = writer.Replace(w.docs, w.deleteIDs)
+	} else {
+		err = writer.Batch(w.docs)
+	}
+	if err != nil && deadLetter && errs.IsRejection(err) {
+		err = w.persistOneByOne(writer)
 	}
-	segment.UpdateStat(minTime, maxTime, int64(len(docs)))
-	shard.UpdateStat(minTime, maxTime, int64(len(docs)), walIndex)
-	err = metadata.SaveIndex(shard.Index)
 	if err != nil {
 		return err
 	}
+	ids := make([]string, 0, len(w.docs))
+	for docID := range w.docs {
+		ids = append(ids, docID)
+	}
+	w.segment.AddIDs(ids)
+	w.segment.UpdateStat(w.minTime, w.maxTime, int64(len(w.docs)))
+	return nil
+}
+
+// persistOneByOne writes the documents one by one to find out the ones rejected by the writer,
+// the rejected documents are moved out of the write. The existing documents to be replaced by the
+// rejected ones are deleted as well, as if they were replaced.
+func (w *segmentWrite) persistOneByOne(writer indexlib.Writer) error {
+	for docID, doc := range w.docs {
+		var err error
+		single := map[string]protocol.Document{docID: doc}
+		if w.replace {
+			err = writer.Replace(single, nil)
+		} else {
+			err = writer.Batch(single)
+		}
+		if err == nil {
+			continue
+		}
+		if !errs.IsRejection(err) {
+			return err
+		}
+		logger.Warn(
+			"[wal] document is rejected",
+			zap.String("segment", w.segment.GetName()),
+			zap.String("id", docID),
+			zap.Error(err),
+		)
+		delete(w.docs, docID)
+		w.rejected = append(w.rejected, doc)
+		w.rejections = append(w.rejections, err)
+		if w.replace {
+			w.deleteIDs = append(w.deleteIDs, docID)
+		}
+	}
+	if len(w.deleteIDs) > 0 {
+		return writer.Replace(nil, w.deleteIDs)
+	}
 	return nil
 }
@@ -3,11 +3,17 @@
 package wal_test
 
 import (
+	"encoding/json"
+	"path"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/core/wal"
+	tidwall "github.com/tidwall/wal"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tatris-io/tatris/internal/core"
@@ -30,11 +36,11 @@ func TestWal(t *testing.T) {
 
 	for i := 0; i < 5; i++ {
 		// insert one doc
-		err = ingestion.IngestDocs(index, []protocol.Document{
+		_, err = ingestion.IngestDocs(index, []protocol.Document{
 			{
 				"test": "1",
 			},
-		})
+		}, "")
 		assert.NoError(t, err)
 		// sleep 2s to wait wal done
 		time.Sleep(2 * time.Second)
@@ -50,3 +56,169 @@ func TestWal(t *testing.T) {
 		assert.Equal(t, int64(i+1), resp.Hits.Total.Value)
 	}
 }
+
+func TestRecover(t *testing.T) {
+	index, err := prepare.CreateIndex(
+		strings.ReplaceAll(
+			time.Now().Format(consts.TimeFmtWithoutSeparator),
+			consts.Dot,
+			consts.Empty,
+		),
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, index)
+
+	// leave unconsumed entries in the WAL of a shard, as if the server restarted before consuming
+	shard := index.GetShard(0)
+	p := path.Join(config.Cfg.GetFSPath(), consts.PathWAL, shard.GetName())
+	l, err := tidwall.Open(p, nil)
+	assert.NoError(t, err)
+	count := 10
+	for i := 1; i <= count; i++ {
+		op := &protocol.Operation{
+			Action:   consts.ActionCreate,
+			Document: protocol.Document{"test": strconv.Itoa(i)},
+		}
+		assert.NoError(t, core.BuildOperation(index, op))
+		data, err := json.Marshal(op)
+		assert.NoError(t, err)
+		assert.NoError(t, l.Write(uint64(i), data))
+	}
+	assert.NoError(t, l.Close())
+
+	wal.Recover()
+	assert.Eventually(t, func() bool {
+		return wal.GetRecoveryStatus().Done
+	}, 10*time.Second, 100*time.Millisecond)
+	assert.Equal(t, 0, wal.GetRecoveryStatus().Failed)
+	assert.Equal(t, uint64(count), shard.GetWalIndex())
+
+	resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+		Index: index.Name,
+		Query: protocol.Query{
+			MatchAll: &protocol.MatchAll{},
+		},
+		Size: 9999,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(count), resp.Hits.Total.Value)
+}
+
+func TestSignaledConsumption(t *testing.T) {
+	index, err := prepare.CreateIndex(
+		strings.ReplaceAll(
+			time.Now().Format(consts.TimeFmtWithoutSeparator),
+			consts.Dot,
+			consts.Empty,
+		),
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, index)
+
+	for i := 0; i < 5; i++ {
+		results, err := ingestion.IngestDocs(index, []protocol.Document{
+			{
+				"test": strconv.Itoa(i),
+			},
+		}, "")
+		assert.NoError(t, err)
+		// the write signals the consumer of the shard, so the doc is consumed well before the
+		// periodic consumption
+		result := results[0]
+		assert.Eventually(t, func() bool {
+			return result.Shard.GetWalIndex() >= result.WalIndex
+		}, config.Cfg.Wal.ConsumeInterval/2, 10*time.Millisecond)
+	}
+}
+
+func TestLateSegments(t *testing.T) {
+	threshold := config.Cfg.Segment.LateThreshold
+	config.Cfg.Segment.LateThreshold = time.Hour
+	defer func() {
+		config.Cfg.Segment.LateThreshold = threshold
+	}()
+	index, err := prepare.CreateIndex(
+		strings.ReplaceAll(
+			time.Now().Format(consts.TimeFmtWithoutSeparator),
+			consts.Dot,
+			consts.Empty,
+		),
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, index)
+
+	now := time.Now()
+	late := now.Add(-72 * time.Hour).Truncate(time.Hour)
+	docs := []protocol.Document{
+		{"name": "now", consts.TimestampField: now},
+		{"name": "late_1", consts.TimestampField: late.Add(time.Minute)},
+		{"name": "late_2", consts.TimestampField: late.Add(2 * time.Minute)},
+		{"name": "later", consts.TimestampField: late.Add(-48 * time.Hour)},
+	}
+	results, err := ingestion.IngestDocs(index, docs, "")
+	assert.NoError(t, err)
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+		result := result
+		assert.Eventually(t, func() bool {
+			return result.Shard.GetWalIndex() >= result.WalIndex
+		}, 10*time.Second, 100*time.Millisecond)
+	}
+
+	// the late documents are kept apart, in the segments of their time buckets
+	lateDocs := int64(0)
+	for _, shard := range index.GetShards() {
+		for _, segment := range shard.GetSegments() {
+			if segment.Stat.DocNum == 0 {
+				continue
+			}
+			if !segment.Late {
+				assert.GreaterOrEqual(t, segment.Stat.MinTime, now.Add(-time.Hour).UnixMilli())
+				continue
+			}
+			lateDocs += segment.Stat.DocNum
+			assert.GreaterOrEqual(t, segment.Stat.MinTime, segment.LateBucket)
+			assert.Less(t, segment.Stat.MaxTime, segment.LateBucket+time.Hour.Milliseconds())
+		}
+	}
+	assert.Equal(t, int64(3), lateDocs)
+
+	// a time-range query finds the late documents
+	resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+		Index: index.Name,
+		Query: protocol.Query{
+			Range: protocol.Range{
+				consts.TimestampField: &protocol.RangeVal{
+					Gte: late.UnixMilli(),
+					Lt:  late.Add(time.Hour).UnixMilli(),
+				},
+			},
+		},
+		Size: 10,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), resp.Hits.Total.Value)
+}
+
+func TestLag(t *testing.T) {
+	index, err := prepare.CreateIndex(
+		strings.ReplaceAll(
+			time.Now().Format(consts.TimeFmtWithoutSeparator),
+			consts.Dot,
+			consts.Empty,
+		),
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, index)
+
+	results, err := ingestion.IngestDocs(index, []protocol.Document{{"test": "lag"}}, "")
+	assert.NoError(t, err)
+	result := results[0]
+	assert.NoError(t, wal.ForceConsumeWAL(result.Shard, result.WalIndex))
+
+	// the segments consumed completely do not lag even if they are still on disk
+	lag, err := wal.GetLag(result.Shard)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), lag.Entries)
+	assert.Equal(t, int64(0), lag.Bytes)
+}
@@ -14,6 +14,8 @@ import (
 
 	"github.com/tatris-io/tatris/internal/indexlib/bluge/directory/oss"
 
+	"github.com/tatris-io/tatris/internal/indexlib/bluge/directory/s3"
+
 	"github.com/blugelabs/bluge"
 	"github.com/blugelabs/bluge/index"
 )
@@ -46,3 +48,15 @@ func GetOSSConfig(
 		)
 	})
 }
+
+func GetS3Config(options *s3.Options, filename string) bluge.Config {
+	return bluge.DefaultConfigWithDirectory(func() index.Directory {
+		cacheDir := filepath.Join(
+			config.Cfg.GetFSPath(),
+			consts.PathCache,
+			filename,
+			consts.PathS3,
+		)
+		return s3.NewS3Directory(options, filename, cacheDir)
+	})
+}
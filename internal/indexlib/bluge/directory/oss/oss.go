@@ -293,3 +293,25 @@ func DeleteObjects(client *oss.Client, bucketName string, objects []string) erro
 	}
 	return nil
 }
+
+// DeleteObjectsByPrefix deletes all the objects whose keys start with the prefix
+func DeleteObjectsByPrefix(client *oss.Client, bucketName, prefix string) error {
+	objs, err := ListObjects(client, bucketName, prefix)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(objs); start += MaxKeySize {
+		end := start + MaxKeySize
+		if end > len(objs) {
+			end = len(objs)
+		}
+		keys := make([]string, 0, end-start)
+		for _, obj := range objs[start:end] {
+			keys = append(keys, obj.Key)
+		}
+		if err = DeleteObjects(client, bucketName, keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
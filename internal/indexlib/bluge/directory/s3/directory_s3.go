@@ -0,0 +1,344 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package s3 is used to implement the storage medium speaking the S3 API for the underlying data
+// and indexes, such as AWS S3, Ceph RGW and MinIO.
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/blevesearch/mmap-go"
+
+	"github.com/tatris-io/tatris/internal/common/utils"
+
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"go.uber.org/zap"
+
+	"github.com/blugelabs/bluge/index"
+	segment "github.com/blugelabs/bluge_segment_api"
+)
+
+type (
+	S3Directory struct {
+		client  *Client
+		options *Options
+		index   string
+		lock    sync.RWMutex
+		// readOnly directories load the objects into cacheDir and map them into memory
+		readOnly bool
+		// cacheDir is the local cache dir for S3. If it is empty, caching is disabled.
+		cacheDir string
+	}
+)
+
+func NewS3Directory(options *Options, index, cacheDir string) *S3Directory {
+	client, err := NewClient(options)
+	if err != nil {
+		return nil
+	}
+	return &S3Directory{
+		client:   client,
+		options:  options,
+		index:    index,
+		cacheDir: cacheDir,
+	}
+}
+
+func (d *S3Directory) Setup(readOnly bool) error {
+	d.readOnly = readOnly
+	defer utils.Timerf(
+		"[directory] method:setup, type:s3, bucket:%s, index:%s, readOnly:%t",
+		d.options.Bucket,
+		d.index,
+		readOnly,
+	)()
+	exist, err := d.client.IsBucketExist(d.options.Bucket)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		if err := d.client.CreateBucket(d.options.Bucket); err != nil {
+			return err
+		}
+	}
+
+	if d.readOnly && d.cacheDir != "" {
+		// Every index writes cache to its own dir
+		return os.MkdirAll(d.cacheDir, 0755)
+	}
+
+	return nil
+}
+
+func (d *S3Directory) List(kind string) ([]uint64, error) {
+
+	defer utils.Timerf(
+		"[directory] method:list, type:s3, bucket:%s, index:%s, kind:%s",
+		d.options.Bucket,
+		d.index,
+		kind,
+	)()
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	objects, err := d.client.ListObjects(d.options.Bucket, Path(d.index))
+	if err != nil {
+		return nil, err
+	}
+
+	var rv uint64Slice
+	for _, object := range objects {
+		if filepath.Ext(object.Key) != kind {
+			continue
+		}
+		base := filepath.Base(object.Key)
+		epoch, err := strconv.ParseUint(base[:len(base)-len(kind)], 16, 64)
+		if err != nil {
+			logger.Error(
+				"s3 list parse object fail",
+				zap.String("index", d.index),
+				zap.String("bucket", d.options.Bucket),
+				zap.String("key", object.Key),
+				zap.Error(err),
+			)
+			return nil, err
+		}
+		rv = append(rv, epoch)
+	}
+
+	sort.Sort(sort.Reverse(rv))
+
+	return rv, nil
+}
+
+func (d *S3Directory) Persist(
+	kind string,
+	id uint64,
+	w index.WriterTo,
+	closeCh chan struct{},
+) error {
+
+	filename := d.fileName(kind, id)
+	begin := time.Now()
+	size := 0
+	defer func() {
+		cost := time.Since(begin).Milliseconds()
+		logger.Infof(
+			"[directory] method:persist, type:s3, bucket:%s, index:%s, filename:%s size:%d, cost(ms)=%d",
+			d.options.Bucket,
+			d.index,
+			filename,
+			size,
+			cost,
+		)
+	}()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var buf bytes.Buffer
+	_, err := w.WriteTo(&buf, closeCh)
+	if err != nil {
+		logger.Error(
+			"s3 persist write buffer fail",
+			zap.String("index", d.index),
+			zap.String("bucket", d.options.Bucket),
+			zap.String("filename", filename),
+			zap.Error(err),
+		)
+		return err
+	}
+	size = buf.Len()
+	// the large segments are uploaded in parts
+	return d.client.Upload(
+		d.options.Bucket,
+		Key(d.index, filename),
+		buf.Bytes(),
+		d.options.PartSize,
+	)
+}
+
+func (d *S3Directory) Load(
+	kind string,
+	id uint64,
+) (ret *segment.Data, closer io.Closer, err error) {
+	filename := d.fileName(kind, id)
+	begin := time.Now()
+	defer func() {
+		size := 0
+		if ret != nil {
+			size = ret.Len()
+		}
+		milli := time.Since(begin).Milliseconds()
+		logger.Infof(
+			"[directory] method:load, type:s3, bucket:%s, index:%s, filename:%s, size:%dKB, cost(ms)=%d",
+			d.options.Bucket,
+			d.index,
+			filename,
+			size/1024,
+			milli,
+		)
+	}()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	key := Key(d.index, filename)
+
+	if d.readOnly && d.cacheDir != "" {
+		tempFile, err := os.CreateTemp(d.cacheDir, fmt.Sprintf("%s-%d-*", kind[1:], id))
+		if err != nil {
+			return nil, nil, err
+		}
+		tempFile.Close()
+
+		if err := d.client.GetObjectToFile(d.options.Bucket, key, tempFile.Name()); err != nil {
+			os.Remove(tempFile.Name())
+			return nil, nil, err
+		}
+
+		return d.mmapFileToSegmentData(tempFile.Name())
+	}
+
+	object, err := d.client.GetObject(d.options.Bucket, key, d.options.MinimumConcurrencyLoadSize)
+	if err != nil {
+		logger.Error(
+			"[directory] [s3] get object error",
+			zap.String("index", d.index),
+			zap.String("key", key),
+			zap.Error(err),
+		)
+		return nil, nil, err
+	}
+
+	return segment.NewDataBytes(object), nil, nil
+}
+
+func (d *S3Directory) Remove(kind string, id uint64) error {
+
+	filename := d.fileName(kind, id)
+	defer utils.Timerf(
+		"[directory] method:remove, type:s3, bucket:%s, index:%s, filename:%s",
+		d.options.Bucket,
+		d.index,
+		filename,
+	)()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.client.DeleteObject(d.options.Bucket, Key(d.index, filename))
+}
+
+// Lock ensures this process has exclusive access to write in this directory.
+// Like the OssDirectory, an S3Directory is accessed by at most one process at the same time
+// through the first-level shard strategy (shard).
+func (d *S3Directory) Lock() error {
+	return nil
+}
+
+// Unlock releases the lock held on this directory.
+func (d *S3Directory) Unlock() error {
+	return nil
+}
+
+func (d *S3Directory) Stats() (numFilesOnDisk, numBytesUsedDisk uint64) {
+
+	defer utils.Timerf(
+		"[directory] method:stats, type:s3, bucket:%s, index:%s",
+		d.options.Bucket,
+		d.index,
+	)()
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	objects, err := d.client.ListObjects(d.options.Bucket, Path(d.index))
+	if err != nil {
+		return 0, 0
+	}
+
+	for _, object := range objects {
+		numFilesOnDisk++
+		numBytesUsedDisk += uint64(object.Size)
+	}
+
+	return numFilesOnDisk, numBytesUsedDisk
+}
+
+func (d *S3Directory) Sync() error {
+	defer utils.Timerf(
+		"[directory] method:sync, type:s3, bucket:%s, index:%s",
+		d.options.Bucket,
+		d.index,
+	)()
+	return nil
+}
+
+func (d *S3Directory) fileName(kind string, id uint64) string {
+	return fmt.Sprintf("%012x", id) + kind
+}
+
+func (d *S3Directory) mmapFileToSegmentData(tempPath string) (*segment.Data, io.Closer, error) {
+	file, err := os.Open(tempPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, nil, err
+	}
+	mm, err := mmap.Map(file, mmap.RDONLY, 0)
+	if err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return nil, nil, err
+	}
+
+	closer := func() error {
+		err1 := mm.Unmap()
+
+		err2 := file.Close()
+
+		err3 := os.Remove(tempPath)
+
+		if err1 == nil {
+			err1 = err2
+		}
+		if err1 == nil {
+			err1 = err3
+		}
+
+		return err1
+	}
+
+	return segment.NewDataBytes(mm), closerFunc(closer), nil
+}
+
+// Path returns the prefix of the objects of the index
+func Path(index string) string {
+	return fmt.Sprintf("%s/", index)
+}
+
+// Key returns the key of the object of the index
+func Key(index, filename string) string {
+	return fmt.Sprintf("%s/%s", index, filename)
+}
+
+type uint64Slice []uint64
+
+func (e uint64Slice) Len() int           { return len(e) }
+func (e uint64Slice) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e uint64Slice) Less(i, j int) bool { return e[i] < e[j] }
+
+type closerFunc func() error
+
+func (c closerFunc) Close() error {
+	return c()
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package s3
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/blugelabs/bluge/index"
+)
+
+type bytesWriterTo []byte
+
+func (b bytesWriterTo) WriteTo(w io.Writer, _ chan struct{}) (int64, error) {
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+func TestS3Directory(t *testing.T) {
+	options, server := testOptions(t)
+	cacheDir := t.TempDir()
+
+	writer := NewS3Directory(options, "index/0/0", cacheDir)
+	assert.NotNil(t, writer)
+	assert.NoError(t, writer.Setup(false))
+
+	small := bytesWriterTo("snapshot")
+	large := bytesWriterTo(bytes.Repeat([]byte("segment"), int(options.PartSize)/3))
+	assert.NoError(t, writer.Persist(index.ItemKindSnapshot, 1, small, nil))
+	assert.NoError(t, writer.Persist(index.ItemKindSegment, 1, large, nil))
+	assert.NoError(t, writer.Persist(index.ItemKindSegment, 2, small, nil))
+	if server != nil {
+		// the large segment is uploaded in parts
+		assert.Equal(t, 1, server.MultipartUploads())
+		assert.Contains(t, server.Objects(options.Bucket), "index/0/0/000000000001.seg")
+	}
+
+	ids, err := writer.List(index.ItemKindSegment)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{2, 1}, ids)
+	files, size := writer.Stats()
+	assert.Equal(t, uint64(3), files)
+	assert.Equal(t, uint64(2*len(small)+len(large)), size)
+
+	data, closer, err := writer.Load(index.ItemKindSnapshot, 1)
+	assert.NoError(t, err)
+	assert.Nil(t, closer)
+	assert.Equal(t, len(small), data.Len())
+
+	// a read-only directory loads the objects through the cache dir
+	reader := NewS3Directory(options, "index/0/0", cacheDir)
+	assert.NoError(t, reader.Setup(true))
+	data, closer, err = reader.Load(index.ItemKindSegment, 1)
+	assert.NoError(t, err)
+	assert.NotNil(t, closer)
+	assert.Equal(t, len(large), data.Len())
+	cached, err := os.ReadDir(cacheDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(cached))
+	assert.NoError(t, closer.Close())
+	cached, err = os.ReadDir(cacheDir)
+	assert.NoError(t, err)
+	assert.Empty(t, cached)
+
+	assert.NoError(t, writer.Remove(index.ItemKindSegment, 2))
+	ids, err = writer.List(index.ItemKindSegment)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1}, ids)
+}
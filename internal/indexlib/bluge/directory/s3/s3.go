@@ -0,0 +1,546 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	MaxKeySize = 1000
+	// defaultRegion is the region where the buckets are created without a location constraint
+	defaultRegion = "us-east-1"
+)
+
+// Options are the options to access the object storage speaking the S3 API
+type Options struct {
+	// the endpoint with the scheme, such as `http://127.0.0.1:9000`
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// whether the bucket is addressed by the path of the endpoint instead of its host
+	PathStyle bool
+	// the objects larger than this are uploaded in parts of this size, 0 means never
+	PartSize int64
+	// the objects larger than this are loaded by ranges concurrently
+	MinimumConcurrencyLoadSize int
+}
+
+// Client is a minimal client of the S3 API, the requests are signed by the signature version 4
+type Client struct {
+	endpoint        *url.URL
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	pathStyle       bool
+	httpClient      *http.Client
+}
+
+// Object is an object listed from a bucket
+type Object struct {
+	Key  string `xml:"Key"`
+	Size int64  `xml:"Size"`
+}
+
+// Error is the error returned by the S3 API
+type Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf(
+		"s3 error, status: %d, code: %s, message: %s",
+		e.StatusCode,
+		e.Code,
+		e.Message,
+	)
+}
+
+// IsNotFound returns whether the error means the bucket or the object does not exist
+func IsNotFound(err error) bool {
+	var s3Err *Error
+	return errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusNotFound
+}
+
+func DefaultClient() (*Client, error) {
+	return NewClient(ToOptions(config.Cfg.Directory.S3))
+}
+
+// ToOptions converts the S3 config of the directory to the options
+func ToOptions(cfg *config.S3) *Options {
+	return &Options{
+		Endpoint:                   cfg.Endpoint,
+		Region:                     cfg.Region,
+		Bucket:                     cfg.Bucket,
+		AccessKeyID:                cfg.AccessKeyID,
+		SecretAccessKey:            cfg.SecretAccessKey,
+		PathStyle:                  cfg.PathStyle,
+		PartSize:                   cfg.PartSize,
+		MinimumConcurrencyLoadSize: cfg.MinimumConcurrencyLoadSize,
+	}
+}
+
+func NewClient(options *Options) (*Client, error) {
+	endpoint, err := url.Parse(options.Endpoint)
+	if err == nil && (endpoint.Scheme == "" || endpoint.Host == "") {
+		err = fmt.Errorf("endpoint %s should be like http://host:port", options.Endpoint)
+	}
+	if err != nil {
+		logger.Error(
+			"[s3] new client fail",
+			zap.String("endpoint", options.Endpoint),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	region := options.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	return &Client{
+		endpoint:        endpoint,
+		region:          region,
+		accessKeyID:     options.AccessKeyID,
+		secretAccessKey: options.SecretAccessKey,
+		pathStyle:       options.PathStyle,
+		httpClient:      &http.Client{},
+	}, nil
+}
+
+// IsBucketExist returns whether the bucket exists
+func (c *Client) IsBucketExist(bucket string) (bool, error) {
+	resp, err := c.do(http.MethodHead, bucket, "", nil, nil, nil)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// CreateBucket creates the bucket in the region of the client
+func (c *Client) CreateBucket(bucket string) error {
+	var body []byte
+	if c.region != defaultRegion {
+		body = []byte(fmt.Sprintf(
+			`<CreateBucketConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`+
+				`<LocationConstraint>%s</LocationConstraint></CreateBucketConfiguration>`,
+			c.region,
+		))
+	}
+	return c.discard(c.do(http.MethodPut, bucket, "", nil, nil, body))
+}
+
+// PutObject uploads the object in a single request
+func (c *Client) PutObject(bucket, key string, data []byte) error {
+	return c.discard(c.do(http.MethodPut, bucket, key, nil, nil, data))
+}
+
+// Upload uploads the object, it is uploaded in parts of partSize concurrently if it is larger than
+// partSize. The parts uploaded are aborted if any of them fails.
+func (c *Client) Upload(bucket, key string, data []byte, partSize int64) error {
+	if partSize <= 0 || int64(len(data)) <= partSize {
+		return c.PutObject(bucket, key, data)
+	}
+	uploadID, err := c.createMultipartUpload(bucket, key)
+	if err != nil {
+		return err
+	}
+	parts := make([]completedPart, (int64(len(data))+partSize-1)/partSize)
+	var eg errgroup.Group
+	eg.SetLimit(runtime.GOMAXPROCS(0))
+	for i := range parts {
+		i := i
+		start := int64(i) * partSize
+		end := int64(math.Min(float64(start+partSize), float64(len(data))))
+		eg.Go(func() error {
+			etag, err := c.uploadPart(bucket, key, uploadID, i+1, data[start:end])
+			parts[i] = completedPart{PartNumber: i + 1, ETag: etag}
+			return err
+		})
+	}
+	if err = eg.Wait(); err == nil {
+		err = c.completeMultipartUpload(bucket, key, uploadID, parts)
+	}
+	if err != nil {
+		query := url.Values{"uploadId": {uploadID}}
+		abortErr := c.discard(c.do(http.MethodDelete, bucket, key, query, nil, nil))
+		if abortErr != nil {
+			logger.Warn(
+				"[s3] abort multipart upload fail",
+				zap.String("bucket", bucket),
+				zap.String("key", key),
+				zap.Error(abortErr),
+			)
+		}
+		return err
+	}
+	return nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *Client) createMultipartUpload(bucket, key string) (string, error) {
+	result := &struct {
+		UploadID string `xml:"UploadId"`
+	}{}
+	query := url.Values{"uploads": {""}}
+	if err := c.decode(c.do(http.MethodPost, bucket, key, query, nil, nil))(result); err != nil {
+		return "", err
+	}
+	return result.UploadID, nil
+}
+
+func (c *Client) uploadPart(
+	bucket, key, uploadID string,
+	partNumber int,
+	data []byte,
+) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadID}}
+	resp, err := c.do(http.MethodPut, bucket, key, query, nil, data)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+func (c *Client) completeMultipartUpload(
+	bucket, key, uploadID string,
+	parts []completedPart,
+) error {
+	body, err := xml.Marshal(&struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	query := url.Values{"uploadId": {uploadID}}
+	resp, err := c.do(http.MethodPost, bucket, key, query, nil, body)
+	if err != nil {
+		return err
+	}
+	// the completion may fail after the response status has been sent as 200
+	return readError(resp)
+}
+
+// GetObjectSize returns the size of the object
+func (c *Client) GetObjectSize(bucket, key string) (int64, error) {
+	resp, err := c.do(http.MethodHead, bucket, key, nil, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+// GetObject loads the object, it is loaded by ranges concurrently if it is not smaller than
+// minimumConcurrencyLoadSize
+func (c *Client) GetObject(bucket, key string, minimumConcurrencyLoadSize int) ([]byte, error) {
+	size, err := c.GetObjectSize(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if size < int64(minimumConcurrencyLoadSize) || size == 0 {
+		resp, err := c.do(http.MethodGet, bucket, key, nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	}
+	content := make([]byte, size)
+	gCount := int(math.Min(float64(runtime.GOMAXPROCS(0)), float64(size)))
+	partSize := (size + int64(gCount) - 1) / int64(gCount)
+	var eg errgroup.Group
+	eg.SetLimit(gCount)
+	for start := int64(0); start < size; start += partSize {
+		start := start
+		end := int64(math.Min(float64(start+partSize), float64(size)))
+		eg.Go(func() error {
+			header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", start, end-1)}}
+			resp, err := c.do(http.MethodGet, bucket, key, nil, header, nil)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if _, err = io.ReadFull(resp.Body, content[start:end]); err != nil {
+				logger.Error(
+					"[s3] io read part object fail",
+					zap.String("bucket", bucket),
+					zap.String("key", key),
+					zap.String("range", fmt.Sprintf("%d-%d", start, end-1)),
+					zap.Error(err),
+				)
+			}
+			return err
+		})
+	}
+	return content, eg.Wait()
+}
+
+// GetObjectToFile downloads the object to the file, which is created or truncated
+func (c *Client) GetObjectToFile(bucket, key, path string) error {
+	resp, err := c.do(http.MethodGet, bucket, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ListObjects lists all the objects whose keys start with the prefix
+func (c *Client) ListObjects(bucket, prefix string) ([]Object, error) {
+	objects := make([]Object, 0)
+	continuationToken := ""
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"max-keys":  {strconv.Itoa(MaxKeySize)},
+			"prefix":    {prefix},
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		result := &struct {
+			Contents              []Object `xml:"Contents"`
+			IsTruncated           bool     `xml:"IsTruncated"`
+			NextContinuationToken string   `xml:"NextContinuationToken"`
+		}{}
+		if err := c.decode(c.do(http.MethodGet, bucket, "", query, nil, nil))(result); err != nil {
+			return nil, err
+		}
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+// DeleteObject deletes the object, it succeeds if the object does not exist
+func (c *Client) DeleteObject(bucket, key string) error {
+	return c.discard(c.do(http.MethodDelete, bucket, key, nil, nil, nil))
+}
+
+// DeleteObjects deletes at most MaxKeySize objects in a single request
+func (c *Client) DeleteObjects(bucket string, keys []string) error {
+	type object struct {
+		Key string `xml:"Key"`
+	}
+	request := &struct {
+		XMLName xml.Name `xml:"Delete"`
+		Quiet   bool     `xml:"Quiet"`
+		Objects []object `xml:"Object"`
+	}{Quiet: true}
+	for _, key := range keys {
+		request.Objects = append(request.Objects, object{Key: key})
+	}
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(body)
+	header := http.Header{"Content-MD5": {base64.StdEncoding.EncodeToString(sum[:])}}
+	result := &struct {
+		Errors []struct {
+			Key     string `xml:"Key"`
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Error"`
+	}{}
+	query := url.Values{"delete": {""}}
+	if err = c.decode(c.do(http.MethodPost, bucket, "", query, header, body))(result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		e := result.Errors[0]
+		return &Error{StatusCode: http.StatusOK, Code: e.Code, Message: e.Key + ": " + e.Message}
+	}
+	return nil
+}
+
+// DeleteObjectsByPrefix deletes all the objects whose keys start with the prefix
+func (c *Client) DeleteObjectsByPrefix(bucket, prefix string) error {
+	objs, err := c.ListObjects(bucket, prefix)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(objs); start += MaxKeySize {
+		end := int(math.Min(float64(start+MaxKeySize), float64(len(objs))))
+		keys := make([]string, 0, end-start)
+		for _, obj := range objs[start:end] {
+			keys = append(keys, obj.Key)
+		}
+		if err = c.DeleteObjects(bucket, keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// do sends the signed request, the errors responded are returned as *Error
+func (c *Client) do(
+	method, bucket, key string,
+	query url.Values,
+	header http.Header,
+	body []byte,
+) (*http.Response, error) {
+	u := *c.endpoint
+	if c.pathStyle {
+		u.Path = "/" + bucket
+		if key != "" {
+			u.Path += "/" + key
+		}
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = encodePath(u.Path)
+	u.RawQuery = encodeQuery(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	sign(req, hashHex(body), c.accessKeyID, c.secretAccessKey, c.region, time.Now())
+	resp, err := c.httpClient.Do(req)
+	if err == nil && resp.StatusCode >= http.StatusMultipleChoices {
+		err = readError(resp)
+	}
+	if err != nil {
+		// a missing object or bucket is expected by the callers, it is not logged
+		if !IsNotFound(err) {
+			logger.Error(
+				"[s3] request fail",
+				zap.String("method", method),
+				zap.String("bucket", bucket),
+				zap.String("key", key),
+				zap.Error(err),
+			)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// discard closes the response if the request succeeds
+func (c *Client) discard(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// decode returns a function decoding the XML of the response into v if the request succeeds
+func (c *Client) decode(resp *http.Response, err error) func(v any) error {
+	return func(v any) error {
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		return xml.NewDecoder(resp.Body).Decode(v)
+	}
+}
+
+// readError reads the error from the response and closes it, nil is returned if the response is
+// not an error
+func readError(resp *http.Response) error {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	s3Err := &Error{StatusCode: resp.StatusCode}
+	if len(body) > 0 && xml.Unmarshal(body, s3Err) == nil && s3Err.Code != "" {
+		return s3Err
+	}
+	if resp.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+	s3Err.Code = http.StatusText(resp.StatusCode)
+	return s3Err
+}
+
+// encodePath encodes the path by the URI encoding of S3, the slashes are kept
+func encodePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// encodeQuery encodes the query sorted by the keys as required by the canonical request
+func encodeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			pairs = append(pairs, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode encodes every byte except the unreserved characters, which differs from
+// url.QueryEscape on the spaces
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
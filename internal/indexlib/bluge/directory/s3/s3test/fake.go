@@ -0,0 +1,250 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package s3test provides an in-process fake of the S3 API for tests, it keeps the objects in
+// memory and only supports the path-style requests used by the s3 directory. The signatures are
+// not verified.
+package s3test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server is the fake S3 server, it should be closed after use
+type Server struct {
+	*httptest.Server
+	lock    sync.Mutex
+	buckets map[string]map[string][]byte
+	uploads map[string]map[int][]byte
+	nextID  int
+	// the number of the multipart uploads completed
+	multipartUploads int
+}
+
+// NewServer starts a fake S3 server
+func NewServer() *Server {
+	s := &Server{
+		buckets: make(map[string]map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// MultipartUploads returns the number of the multipart uploads completed
+func (s *Server) MultipartUploads() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.multipartUploads
+}
+
+// Objects returns the keys of the objects in the bucket
+func (s *Server) Objects(bucket string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	keys := make([]string, 0)
+	for key := range s.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=") {
+		writeError(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if key == "" {
+		s.handleBucket(w, r, bucket, body)
+		return
+	}
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.nextID++
+		uploadID := strconv.Itoa(s.nextID)
+		s.uploads[uploadID] = make(map[int][]byte)
+		writeXML(w, &struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string   `xml:"Bucket"`
+			Key      string   `xml:"Key"`
+			UploadID string   `xml:"UploadId"`
+		}{Bucket: bucket, Key: key, UploadID: uploadID})
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := s.uploads[query.Get("uploadId")]
+		partNumber, err := strconv.Atoi(query.Get("partNumber"))
+		if !ok || err != nil {
+			writeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		parts[partNumber] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, partNumber))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := s.uploads[query.Get("uploadId")]
+		request := &struct {
+			Parts []struct {
+				PartNumber int `xml:"PartNumber"`
+			} `xml:"Part"`
+		}{}
+		if !ok || xml.Unmarshal(body, request) != nil {
+			writeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		data := make([]byte, 0)
+		for _, part := range request.Parts {
+			data = append(data, parts[part.PartNumber]...)
+		}
+		objects[key] = data
+		delete(s.uploads, query.Get("uploadId"))
+		s.multipartUploads++
+		writeXML(w, &struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Key     string   `xml:"Key"`
+		}{Key: key})
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		objects[key] = body
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := objects[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		status := http.StatusOK
+		if rng := r.Header.Get("Range"); rng != "" {
+			var start, end int
+			if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil ||
+				start > end || end >= len(data) {
+				writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return
+			}
+			data = data[start : end+1]
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (s *Server) handleBucket(w http.ResponseWriter, r *http.Request, bucket string, body []byte) {
+	query := r.URL.Query()
+	objects, ok := s.buckets[bucket]
+	switch {
+	case r.Method == http.MethodPut:
+		if ok {
+			writeError(w, http.StatusConflict, "BucketAlreadyOwnedByYou")
+			return
+		}
+		s.buckets[bucket] = make(map[string][]byte)
+	case !ok:
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+	case r.Method == http.MethodHead:
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		token := query.Get("continuation-token")
+		s.list(w, objects, query.Get("prefix"), token, query.Get("max-keys"))
+	case r.Method == http.MethodPost && query.Has("delete"):
+		request := &struct {
+			Objects []struct {
+				Key string `xml:"Key"`
+			} `xml:"Object"`
+		}{}
+		if xml.Unmarshal(body, request) != nil || r.Header.Get("Content-MD5") == "" {
+			writeError(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		for _, object := range request.Objects {
+			delete(objects, object.Key)
+		}
+		writeXML(w, &struct {
+			XMLName xml.Name `xml:"DeleteResult"`
+		}{})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// list lists the objects in the order of their keys, the continuation token is the last key listed
+func (s *Server) list(
+	w http.ResponseWriter,
+	objects map[string][]byte,
+	prefix, token, maxKeys string,
+) {
+	limit, err := strconv.Atoi(maxKeys)
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	keys := make([]string, 0)
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) && key > token {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	type content struct {
+		Key  string `xml:"Key"`
+		Size int    `xml:"Size"`
+	}
+	result := &struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		Contents              []content `xml:"Contents"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+	}{}
+	if len(keys) > limit {
+		keys = keys[:limit]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[limit-1]
+	}
+	for _, key := range keys {
+		result.Contents = append(result.Contents, content{Key: key, Size: len(objects[key])})
+	}
+	writeXML(w, result)
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(&struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: code})
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	signAlgorithm = "AWS4-HMAC-SHA256"
+	signService   = "s3"
+	amzDateFormat = "20060102T150405Z"
+)
+
+// sign signs the request by the signature version 4 of AWS, the host, the range, the content-md5
+// and the x-amz-* headers are signed
+func sign(
+	req *http.Request,
+	payloadHash, accessKeyID, secretAccessKey, region string,
+	t time.Time,
+) {
+	amzDate := t.UTC().Format(amzDateFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		headers["host"] = req.Host
+	}
+	for k, v := range req.Header {
+		name := strings.ToLower(k)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" || name == "content-md5" {
+			headers[name] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, region, signService, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		signAlgorithm,
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, signService)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		signAlgorithm,
+		accessKeyID,
+		scope,
+		signedHeaders,
+		signature,
+	))
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
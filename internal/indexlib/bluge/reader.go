@@ -35,6 +35,7 @@ import (
 	"github.com/tatris-io/tatris/internal/indexlib"
 	custom_aggregations "github.com/tatris-io/tatris/internal/indexlib/bluge/aggregations"
 	"github.com/tatris-io/tatris/internal/indexlib/bluge/config"
+	"github.com/tatris-io/tatris/internal/indexlib/bluge/directory/s3"
 )
 
 type BlugeReader struct {
@@ -107,6 +108,8 @@ func (b *BlugeReader) OpenReader() error {
 				segment,
 				b.Config.OSS.MinimumConcurrencyLoadSize,
 			)
+		case consts.DirectoryS3:
+			cfg = config.GetS3Config(s3.ToOptions(b.Config.S3), segment)
 		default:
 			cfg = config.GetFSConfig(b.Config.FS.Path, segment)
 		}
@@ -284,6 +287,13 @@ func (b *BlugeReader) request(
 	if sorts != nil {
 		searchRequest.SortByCustom(sorts)
 	}
+	if after := query.GetSearchAfter(); len(after) > 0 {
+		values := make([][]byte, len(after))
+		for i, v := range after {
+			values[i] = []byte(v)
+		}
+		searchRequest.After(values)
+	}
 	if aggs := query.GetAggs(); aggs != nil {
 		blugeAggs, err := b.genAggregations(aggs)
 		if err != nil {
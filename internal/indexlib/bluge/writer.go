@@ -20,6 +20,7 @@ import (
 	"github.com/tatris-io/tatris/internal/common/consts"
 	"github.com/tatris-io/tatris/internal/indexlib"
 	"github.com/tatris-io/tatris/internal/indexlib/bluge/config"
+	"github.com/tatris-io/tatris/internal/indexlib/bluge/directory/s3"
 )
 
 type BlugeWriter struct {
@@ -54,6 +55,8 @@ func (b *BlugeWriter) OpenWriter() error {
 			b.Segment,
 			b.Config.OSS.MinimumConcurrencyLoadSize,
 		)
+	case consts.DirectoryS3:
+		cfg = config.GetS3Config(s3.ToOptions(b.Config.S3), b.Segment)
 	default:
 		cfg = config.GetFSConfig(b.Config.FS.Path, b.Segment)
 	}
@@ -94,6 +97,30 @@ func (b *BlugeWriter) Batch(
 	return b.Writer.Batch(batch)
 }
 
+func (b *BlugeWriter) Replace(
+	docs map[string]protocol.Document,
+	deleteIDs []string,
+) error {
+	defer utils.Timerf(
+		"bluge batch replace %d docs and delete %d docs finish, segment:%s",
+		len(docs),
+		len(deleteIDs),
+		b.Segment,
+	)()
+	batch := index.NewBatch()
+	for docID, doc := range docs {
+		blugeDoc, err := b.generateBlugeDoc(docID, doc, b.Mappings)
+		if err != nil {
+			return err
+		}
+		batch.Update(bluge.Identifier(docID), blugeDoc)
+	}
+	for _, docID := range deleteIDs {
+		batch.Delete(bluge.Identifier(docID))
+	}
+	return b.Writer.Batch(batch)
+}
+
 func (b *BlugeWriter) Reader() (indexlib.Reader, error) {
 	reader, err := b.Writer.Reader()
 	if err != nil {
@@ -116,27 +143,12 @@ func (b *BlugeWriter) generateBlugeDoc(
 	doc protocol.Document,
 	mappings protocol.Mappings,
 ) (segment.Document, error) {
-	ts, _ := utils.ParseTime(doc[consts.TimestampField])
+	timestampField := mappings.TimestampField()
+	timestamp, _ := doc.Get(timestampField)
+	ts, _ := utils.ParseTime(timestamp)
 	bdoc := bluge.NewDocument(docID)
-	for key, value := range doc {
-		if value == nil {
-			continue
-		}
-
-		switch v := value.(type) {
-		case []interface{}:
-			for _, v := range v {
-				err := b.addField(bdoc, key, v, mappings)
-				if err != nil {
-					return nil, err
-				}
-			}
-		default:
-			err := b.addField(bdoc, key, v, mappings)
-			if err != nil {
-				return nil, err
-			}
-		}
+	if err := b.addFields(bdoc, "", doc, mappings); err != nil {
+		return nil, err
 	}
 
 	source, err := json.Marshal(doc)
@@ -147,8 +159,9 @@ func (b *BlugeWriter) generateBlugeDoc(
 	bdoc.AddField(bluge.NewStoredOnlyField(consts.IDField, []byte(docID)))
 	bdoc.AddField(bluge.NewStoredOnlyField(consts.IndexField, []byte(b.Index)))
 	bdoc.AddField(bluge.NewStoredOnlyField(consts.SourceField, source))
+	// the event time is indexed once under its own field to be sorted and aggregated by
 	bdoc.AddField(
-		bluge.NewDateTimeField(consts.TimestampField, ts).
+		bluge.NewDateTimeField(timestampField, ts).
 			Sortable().
 			Aggregatable(),
 	)
@@ -156,6 +169,52 @@ func (b *BlugeWriter) generateBlugeDoc(
 	return bdoc, nil
 }
 
+// addFields adds the fields of a document or an object, the subfields of an object are added by
+// their dotted paths, e.g. `kubernetes.pod.name`.
+func (b *BlugeWriter) addFields(
+	bdoc *bluge.Document,
+	prefix string,
+	fields map[string]interface{},
+	mappings protocol.Mappings,
+) error {
+	for key, value := range fields {
+		if value == nil {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + consts.Dot + key
+		}
+		if key == mappings.TimestampField() {
+			continue
+		}
+		if err := b.addValue(bdoc, key, value, mappings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BlugeWriter) addValue(
+	bdoc *bluge.Document,
+	key string,
+	value interface{},
+	mappings protocol.Mappings,
+) error {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, v := range v {
+			if err := b.addValue(bdoc, key, v, mappings); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		return b.addFields(bdoc, key, v, mappings)
+	default:
+		return b.addField(bdoc, key, v, mappings)
+	}
+}
+
 func (b *BlugeWriter) addField(
 	bdoc *bluge.Document,
 	key string,
@@ -163,7 +222,7 @@ func (b *BlugeWriter) addField(
 	mappings protocol.Mappings,
 ) error {
 	var bfield *bluge.TermField
-	if p, ok := mappings.Properties[key]; ok {
+	if p, ok := mappings.GetProperty(key); ok {
 		field, err := b.addFieldByMappingType(p.Type, key, value)
 		if err != nil {
 			return err
@@ -15,6 +15,9 @@ type Config struct {
 	DirectoryType string
 	FS            *FileSystem
 	OSS           *ObjectStorageService
+	// S3 is shared with the directory config, since it is converted to the options of the s3
+	// directory as a whole
+	S3 *config.S3
 }
 
 type FileSystem struct {
@@ -36,6 +39,7 @@ func BuildConf(directory *config.Directory) *Config {
 		FS: &FileSystem{
 			Path: path.Join(directory.FS.Path, consts.PathData),
 		},
+		S3: directory.S3,
 	}
 	if directory.OSS != nil {
 		cfg.OSS = &ObjectStorageService{
@@ -48,3 +52,14 @@ func BuildConf(directory *config.Directory) *Config {
 	}
 	return cfg
 }
+
+// WithDirectory returns a copy of the config whose data is served by the directory of the type, the
+// config itself is returned if the type is empty
+func (cfg *Config) WithDirectory(directoryType string) *Config {
+	if directoryType == "" || directoryType == cfg.DirectoryType {
+		return cfg
+	}
+	c := *cfg
+	c.DirectoryType = directoryType
+	return &c
+}
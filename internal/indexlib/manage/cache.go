@@ -77,6 +77,14 @@ func (c *readerCache) Get(key string) (indexlib.Reader, bool) {
 	return nil, false
 }
 
+// Remove removes the reader with specified key, the removed reader will be closed later
+func (c *readerCache) Remove(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.cache.Delete(key)
+}
+
 func (c *readerCache) onItemEvicted(key string, i interface{}) {
 	logger.Debug("[readerCache] onItemEvicted", zap.String("key", key))
 	reader := i.(*indexlib.HookReader)
@@ -4,13 +4,24 @@
 package manage
 
 import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
 	"github.com/tatris-io/tatris/internal/common/consts"
 	"github.com/tatris-io/tatris/internal/common/errs"
 	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/core/config"
 	"github.com/tatris-io/tatris/internal/indexlib"
 	"github.com/tatris-io/tatris/internal/indexlib/bluge"
+	"github.com/tatris-io/tatris/internal/indexlib/bluge/directory/oss"
+	"github.com/tatris-io/tatris/internal/indexlib/bluge/directory/s3"
 	"github.com/tatris-io/tatris/internal/protocol"
 	"go.uber.org/zap"
+
+	"github.com/blugelabs/bluge/index"
 )
 
 var (
@@ -71,6 +82,12 @@ func GetReaderUsingCache(config *indexlib.Config, index string) (indexlib.Reader
 	return finalReader, nil
 }
 
+// EvictReaderCache evicts the cached reader of the segment, so that changes made to the segment
+// afterwards are visible to the readers opened later.
+func EvictReaderCache(segment string) {
+	defaultReaderCache.Remove(segment)
+}
+
 // GetWriter Writer’s hold an exclusive-lock on their underlying directory which prevents other
 // processes from opening a writer while this one is still open. This does not affect Readers that
 // are already open, and it does not prevent new Readers from being opened,
@@ -95,3 +112,115 @@ func GetWriter(
 		return nil, errs.ErrIndexLibNotSupport
 	}
 }
+
+// RemoveData removes the data of the segment from the directory, along with its local cache.
+// The readers and the writer of the segment should have been closed.
+func RemoveData(cfg *indexlib.Config, segment string) error {
+	cache := path.Join(config.Cfg.GetFSPath(), consts.PathCache, segment)
+	if err := os.RemoveAll(cache); err != nil {
+		return err
+	}
+	switch cfg.DirectoryType {
+	case consts.DirectoryOSS:
+		client, err := oss.NewClient(cfg.OSS.Endpoint, cfg.OSS.AccessKeyID, cfg.OSS.SecretAccessKey)
+		if err != nil {
+			return err
+		}
+		return oss.DeleteObjectsByPrefix(client, cfg.OSS.Bucket, oss.OssPath(segment))
+	case consts.DirectoryS3:
+		client, err := s3.NewClient(s3.ToOptions(cfg.S3))
+		if err != nil {
+			return err
+		}
+		return client.DeleteObjectsByPrefix(cfg.S3.Bucket, s3.Path(segment))
+	default:
+		return os.RemoveAll(path.Join(cfg.FS.Path, segment))
+	}
+}
+
+// UploadData uploads the data of the segment from the local file system to the object storage of
+// the directory type, the objects are named after the local files so that they are loaded by the
+// directory of the type as they are. The writer of the segment should have been closed.
+func UploadData(cfg *indexlib.Config, directoryType, segment string) error {
+	dir := path.Join(cfg.FS.Path, segment)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if !entry.IsDir() && (ext == index.ItemKindSegment || ext == index.ItemKindSnapshot) {
+			files = append(files, entry.Name())
+		}
+	}
+	switch directoryType {
+	case consts.DirectoryOSS:
+		return uploadOSS(cfg.OSS, dir, segment, files)
+	case consts.DirectoryS3:
+		return uploadS3(cfg.S3, dir, segment, files)
+	default:
+		return fmt.Errorf("directory type %s is not an object storage", directoryType)
+	}
+}
+
+func uploadOSS(cfg *indexlib.ObjectStorageService, dir, segment string, files []string) error {
+	client, err := oss.NewClient(cfg.Endpoint, cfg.AccessKeyID, cfg.SecretAccessKey)
+	if err != nil {
+		return err
+	}
+	exist, err := oss.IsBucketExist(client, cfg.Bucket)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		if err = oss.CreateBucket(client, cfg.Bucket); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(path.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		key := oss.OssPath(segment) + file
+		if err = oss.PutObject(client, cfg.Bucket, key, bytes.NewBuffer(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uploadS3(cfg *config.S3, dir, segment string, files []string) error {
+	client, err := s3.NewClient(s3.ToOptions(cfg))
+	if err != nil {
+		return err
+	}
+	exist, err := client.IsBucketExist(cfg.Bucket)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		if err = client.CreateBucket(cfg.Bucket); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(path.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		// the large segments are uploaded in parts like the ones persisted by the s3 directory
+		key := s3.Key(segment, file)
+		if err = client.Upload(cfg.Bucket, key, data, cfg.PartSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveLocalData removes the data of the segment from the local file system only, which is left
+// behind after the segment is uploaded to the object storage
+func RemoveLocalData(cfg *indexlib.Config, segment string) error {
+	return os.RemoveAll(path.Join(cfg.FS.Path, segment))
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package manage
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/indexlib"
+	"github.com/tatris-io/tatris/internal/indexlib/bluge/directory/s3/s3test"
+)
+
+func TestUploadData(t *testing.T) {
+	server := s3test.NewServer()
+	defer server.Close()
+	cfg := &indexlib.Config{
+		IndexLib:      consts.IndexLibBluge,
+		DirectoryType: consts.DirectoryFS,
+		FS:            &indexlib.FileSystem{Path: t.TempDir()},
+		S3: &config.S3{
+			Endpoint:        server.URL,
+			Region:          "us-east-1",
+			Bucket:          "tatris-test-upload",
+			AccessKeyID:     "tatris",
+			SecretAccessKey: "tatris",
+			PathStyle:       true,
+			PartSize:        5 * 1024 * 1024,
+		},
+	}
+	segment := "upload/0/1"
+	dir := path.Join(cfg.FS.Path, segment)
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	for _, file := range []string{"000000000001.seg", "000000000002.snp", "lock"} {
+		assert.NoError(t, os.WriteFile(path.Join(dir, file), []byte(file), 0644))
+	}
+
+	// only the segments and the snapshots are uploaded
+	assert.NoError(t, UploadData(cfg, consts.DirectoryS3, segment))
+	assert.Equal(
+		t,
+		[]string{"upload/0/1/000000000001.seg", "upload/0/1/000000000002.snp"},
+		server.Objects(cfg.S3.Bucket),
+	)
+
+	assert.Error(t, UploadData(cfg, consts.DirectoryFS, segment))
+}
@@ -9,12 +9,17 @@ type QueryRequest interface {
 	GetAggs() map[string]Aggs
 	SetSort(sort Sort)
 	GetSort() Sort
+	SetSearchAfter(after []string)
+	GetSearchAfter() []string
 }
 
 type BaseQuery struct {
 	Boost float64
 	Aggs  map[string]Aggs
 	Sort  Sort
+	// SearchAfter holds the sort values of the last hit of the previous page, only the hits sorted
+	// after it are returned
+	SearchAfter []string
 }
 
 func NewBaseQuery() *BaseQuery {
@@ -37,6 +42,14 @@ func (m *BaseQuery) GetSort() Sort {
 	return m.Sort
 }
 
+func (m *BaseQuery) SetSearchAfter(after []string) {
+	m.SearchAfter = after
+}
+
+func (m *BaseQuery) GetSearchAfter() []string {
+	return m.SearchAfter
+}
+
 type MatchAllQuery struct {
 	*BaseQuery
 }
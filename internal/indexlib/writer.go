@@ -8,6 +8,9 @@ type Writer interface {
 	OpenWriter() error
 	Insert(docID string, doc protocol.Document) error
 	Batch(docs map[string]protocol.Document) error
+	// Replace replaces the docs with the same IDs (or inserts them if they do not exist) and
+	// deletes the docs of deleteIDs in an atomic batch
+	Replace(docs map[string]protocol.Document, deleteIDs []string) error
 	Reader() (Reader, error)
 	Close()
 }
@@ -0,0 +1,137 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package ingestion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/wal"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"go.uber.org/zap"
+)
+
+// fields of the documents in the dead-letter indexes
+const (
+	DeadLetterFieldIndex  = "index"
+	DeadLetterFieldSource = "source"
+	DeadLetterFieldError  = "error"
+	DeadLetterFieldType   = "type"
+	DeadLetterFieldReason = "reason"
+)
+
+func init() {
+	// the documents rejected by the index writer are only known when the WAL is consumed
+	wal.DeadLetter = func(index *core.Index, docs []protocol.Document, rejections []error) {
+		if err := deadLetter(index, docs, rejections); err != nil {
+			logger.Error(
+				"write dead letters failed, the rejected documents are discarded",
+				zap.String("index", index.Name),
+				zap.Int("docs", len(docs)),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// deadLetter writes the rejected documents into the dead-letter index of the index, the
+// dead-letter index is created if it does not exist. The documents are written as they were when
+// rejected, i.e. after being pre-processed by the pipeline.
+func deadLetter(index *core.Index, docs []protocol.Document, rejections []error) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	name := index.Settings.DeadLetterIndex(index.Name)
+	if name == "" || name == index.Name {
+		return fmt.Errorf("dead letter is not enabled for index %s", index.Name)
+	}
+	target, err := getDeadLetterIndex(name)
+	if err != nil {
+		return err
+	}
+	letters := make([]protocol.Document, len(docs))
+	for i, doc := range docs {
+		source, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		letters[i] = protocol.Document{
+			DeadLetterFieldIndex:  index.Name,
+			DeadLetterFieldSource: string(source),
+			DeadLetterFieldError: map[string]any{
+				DeadLetterFieldType:   errorType(rejections[i]),
+				DeadLetterFieldReason: rejections[i].Error(),
+			},
+		}
+	}
+	ops := make([]*protocol.Operation, len(letters))
+	for i, letter := range letters {
+		ops[i] = &protocol.Operation{Action: consts.ActionCreate, Document: letter}
+	}
+	// the dead letters are never rejected or dead-lettered again
+	if err = core.BuildOperations(target, ops); err != nil {
+		return err
+	}
+	for _, result := range produce(target, ops) {
+		if result.Err != nil {
+			return result.Err
+		}
+	}
+	logger.Info(
+		"write dead letters",
+		zap.String("index", index.Name),
+		zap.String("target", name),
+		zap.Int("docs", len(docs)),
+	)
+	return nil
+}
+
+// getDeadLetterIndex gets the dead-letter index, or creates it with the mappings of the dead
+// letters, the unknown fields are ignored
+func getDeadLetterIndex(name string) (*core.Index, error) {
+	index, err := metadata.GetIndexExplicitly(name)
+	if err == nil || !errs.IsIndexNotFound(err) {
+		return index, err
+	}
+	index = &core.Index{Index: &protocol.Index{
+		Name: name,
+		Mappings: &protocol.Mappings{
+			Dynamic: consts.IgnoreMappingMode,
+			Properties: map[string]*protocol.Property{
+				DeadLetterFieldIndex:  {Type: consts.MappingFieldTypeKeyword},
+				DeadLetterFieldSource: {Type: consts.MappingFieldTypeText},
+				DeadLetterFieldError: {
+					Type: consts.MappingFieldTypeObject,
+					Properties: map[string]*protocol.Property{
+						DeadLetterFieldType:   {Type: consts.MappingFieldTypeKeyword},
+						DeadLetterFieldReason: {Type: consts.MappingFieldTypeText},
+					},
+				},
+			},
+		},
+	}}
+	if err = metadata.CreateIndex(index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// errorType names the error like the error types in the responses of the bulk API
+func errorType(err error) string {
+	var fieldErr *errs.InvalidFieldError
+	var fieldValErr *errs.InvalidFieldValError
+	switch {
+	case errors.As(err, &fieldErr), errors.As(err, &fieldValErr):
+		return "mapper_parsing_exception"
+	case errs.IsRejection(err):
+		return "illegal_argument_exception"
+	default:
+		return "exception"
+	}
+}
@@ -4,20 +4,208 @@
 package ingestion
 
 import (
+	"github.com/tatris-io/tatris/internal/common/consts"
 	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/common/log/logger"
 	"github.com/tatris-io/tatris/internal/core"
 	"github.com/tatris-io/tatris/internal/protocol"
+	"go.uber.org/zap"
 
 	"github.com/tatris-io/tatris/internal/core/wal"
 )
 
-func IngestDocs(index *core.Index, docs []protocol.Document) error {
-	shard := index.GetShardByRouting()
-	if shard == nil {
-		return &errs.NoShardError{Index: index.Name}
+// Result is the result of ingesting an operation
+type Result struct {
+	// Shard is the shard that the operation is routed to
+	Shard *core.Shard
+	// WalIndex is the index of the WAL entry that the operation is written to, the operations
+	// routed to the same shard in one ingestion share an entry
+	WalIndex uint64
+	// Err is the reason why the operation is rejected, nil means the operation is accepted
+	Err error
+	// Replaced means the operation of action index replaces an existing document
+	Replaced bool
+	// Dropped means the document is dropped by the pipeline, it is neither accepted nor rejected
+	Dropped bool
+	// DeadLettered means the rejected document is written into the dead-letter index
+	DeadLettered bool
+}
+
+// IngestDocs pre-processes documents by the pipeline, then ingests them as creations and returns
+// their results in order, the default pipeline of the index is used if pipeline is empty.
+// Documents are ingested all or nothing, no document is written if any of them is invalid, unless
+// the index enables the dead-letter index, into which the invalid documents are written instead.
+// However, a document whose _id exists is rejected by errs.DocumentConflictError after the
+// documents routed to the other shards are written.
+func IngestDocs(index *core.Index, docs []protocol.Document, pipeline string) ([]*Result, error) {
+	if index.GetShardNum() == 0 {
+		return nil, &errs.NoShardError{Index: index.Name}
+	}
+	results := make([]*Result, len(docs))
+	ops := make([]*protocol.Operation, 0, len(docs))
+	positions := make([]int, 0, len(docs))
+	for i, doc := range docs {
+		keep, err := preprocess(index, pipeline, doc)
+		if err != nil {
+			return nil, err
+		}
+		if !keep {
+			results[i] = &Result{Dropped: true}
+			continue
+		}
+		ops = append(ops, &protocol.Operation{Action: consts.ActionCreate, Document: doc})
+		positions = append(positions, i)
+	}
+	if index.Settings.DeadLetterIndex(index.Name) == "" {
+		if err := core.BuildOperations(index, ops); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if ops, positions, err = build(index, ops, positions, results); err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			if result != nil && result.Err != nil && !result.DeadLettered {
+				return nil, result.Err
+			}
+		}
+	}
+	for i, result := range produce(index, ops) {
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		results[positions[i]] = result
+	}
+	return results, nil
+}
+
+// IngestOperations ingests operations and returns their results in order, the documents of
+// creations and indexes are pre-processed by the pipelines of the operations first.
+// Each operation is accepted or rejected on its own, the invalid ones do not prevent the others
+// from being ingested. The rejected documents are written into the dead-letter index if the index
+// enables it, their results still carry the errors.
+func IngestOperations(index *core.Index, ops []*protocol.Operation) ([]*Result, error) {
+	if index.GetShardNum() == 0 {
+		return nil, &errs.NoShardError{Index: index.Name}
+	}
+	results := make([]*Result, len(ops))
+	kept := make([]*protocol.Operation, 0, len(ops))
+	positions := make([]int, 0, len(ops))
+	for i, op := range ops {
+		if op.Document != nil &&
+			(op.Action == consts.ActionCreate || op.Action == consts.ActionIndex) {
+			keep, err := preprocess(index, op.Pipeline, op.Document)
+			if err != nil {
+				results[i] = &Result{Err: err}
+				continue
+			}
+			if !keep {
+				results[i] = &Result{Dropped: true}
+				continue
+			}
+		}
+		kept = append(kept, op)
+		positions = append(positions, i)
+	}
+	built, positions, err := build(index, kept, positions, results)
+	if err != nil {
+		logger.Error(
+			"write dead letters failed, the rejected documents are discarded",
+			zap.String("index", index.Name),
+			zap.Error(err),
+		)
+	}
+	for i, result := range produce(index, built) {
+		results[positions[i]] = result
+	}
+	return results, nil
+}
+
+// build builds the operations one by one and fills in the results of the ones failing to be
+// built, the rejected documents are written into the dead-letter index if the index enables it.
+// It returns the operations built along with their positions.
+func build(
+	index *core.Index,
+	ops []*protocol.Operation,
+	positions []int,
+	results []*Result,
+) ([]*protocol.Operation, []int, error) {
+	enabled := index.Settings.DeadLetterIndex(index.Name) != ""
+	n := 0
+	rejected := make([]protocol.Document, 0)
+	rejections := make([]error, 0)
+	rejectedPositions := make([]int, 0)
+	for i, op := range ops {
+		err := core.BuildOperation(index, op)
+		if err == nil {
+			ops[n], positions[n] = op, positions[i]
+			n++
+			continue
+		}
+		results[positions[i]] = &Result{Err: err}
+		if enabled && errs.IsRejection(err) && op.Document != nil {
+			rejected = append(rejected, op.Document)
+			rejections = append(rejections, err)
+			rejectedPositions = append(rejectedPositions, positions[i])
+		}
+	}
+	if err := deadLetter(index, rejected, rejections); err != nil {
+		return ops[:n], positions[:n], err
+	}
+	for _, position := range rejectedPositions {
+		results[position].DeadLettered = true
+	}
+	return ops[:n], positions[:n], nil
+}
+
+// produce routes the built operations to the shards, each shard writes its own operations to its
+// own WAL.
+func produce(index *core.Index, ops []*protocol.Operation) []*Result {
+	results := make([]*Result, len(ops))
+	shardOps := make(map[*core.Shard][]*protocol.Operation)
+	shardPositions := make(map[*core.Shard][]int)
+	shards := make([]*core.Shard, 0)
+	for i, op := range ops {
+		routing := op.Routing
+		if routing == "" {
+			routing = op.ID
+		}
+		shard := index.GetShardByRouting(routing)
+		if _, ok := shardOps[shard]; !ok {
+			shards = append(shards, shard)
+		}
+		shardOps[shard] = append(shardOps[shard], op)
+		shardPositions[shard] = append(shardPositions[shard], i)
 	}
-	if err := core.BuildDocuments(index, docs); err != nil {
-		return err
+	for _, shard := range shards {
+		positions := shardPositions[shard]
+		// reject the writes to the shard if its WAL is consumed too slowly
+		err := wal.CheckLag(shard)
+		var walIndex uint64
+		replaced := make([]bool, len(positions))
+		conflicts := make([]error, len(positions))
+		if err == nil {
+			// the creations conflicting with the existing documents are rejected one by one
+			walIndex, replaced, conflicts, err = shard.WriteUnique(
+				shardOps[shard],
+				func(ops []*protocol.Operation) (uint64, error) {
+					return wal.ProduceWAL(shard, ops)
+				},
+			)
+		}
+		for i, position := range positions {
+			if err == nil && conflicts[i] != nil {
+				results[position] = &Result{Shard: shard, Err: conflicts[i]}
+			} else {
+				results[position] = &Result{
+					Shard:    shard,
+					WalIndex: walIndex,
+					Err:      err,
+					Replaced: err == nil && replaced[i],
+				}
+			}
+		}
 	}
-	return wal.ProduceWAL(shard, docs)
+	return results
 }
@@ -0,0 +1,148 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+// condition decides whether a processor runs on a document.
+// It supports a small subset of the painless conditions of Elasticsearch: comparisons of a field
+// with a literal by `==` and `!=`, truthiness tests of a field with an optional `!`, and the
+// combinations of them by `&&` and `||` (`&&` binds tighter, parentheses are not supported),
+// e.g. `ctx.level == 'debug' || ctx?.http?.status != null && !ctx.keep`.
+type condition struct {
+	// ors are OR-ed, each of which is AND-ed comparisons
+	ors [][]*comparison
+}
+
+type comparison struct {
+	field string
+	// op is one of "==", "!=", "" (truthy) and "!" (falsy)
+	op    string
+	value any
+}
+
+func compileCondition(expr string) (*condition, error) {
+	c := &condition{}
+	for _, or := range strings.Split(expr, "||") {
+		ands := make([]*comparison, 0)
+		for _, and := range strings.Split(or, "&&") {
+			cmp, err := compileComparison(strings.TrimSpace(and))
+			if err != nil {
+				return nil, fmt.Errorf("invalid condition %q: %w", expr, err)
+			}
+			ands = append(ands, cmp)
+		}
+		c.ors = append(c.ors, ands)
+	}
+	return c, nil
+}
+
+func compileComparison(expr string) (*comparison, error) {
+	for _, op := range []string{"==", "!="} {
+		if i := strings.Index(expr, op); i >= 0 {
+			field, err := compileFieldRef(strings.TrimSpace(expr[:i]))
+			if err != nil {
+				return nil, err
+			}
+			value, err := compileLiteral(strings.TrimSpace(expr[i+len(op):]))
+			if err != nil {
+				return nil, err
+			}
+			return &comparison{field: field, op: op, value: value}, nil
+		}
+	}
+	op := ""
+	if strings.HasPrefix(expr, "!") {
+		op = "!"
+		expr = strings.TrimSpace(expr[1:])
+	}
+	field, err := compileFieldRef(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &comparison{field: field, op: op}, nil
+}
+
+// compileFieldRef turns `ctx.a.b` or `ctx?.a?.b` into the field path `a.b`
+func compileFieldRef(expr string) (string, error) {
+	expr = strings.ReplaceAll(expr, "?.", ".")
+	if !strings.HasPrefix(expr, "ctx.") || len(expr) == len("ctx.") {
+		return "", fmt.Errorf("%q is not a field reference like ctx.field", expr)
+	}
+	return expr[len("ctx."):], nil
+}
+
+func compileLiteral(expr string) (any, error) {
+	switch {
+	case expr == "null":
+		return nil, nil
+	case expr == "true" || expr == "false":
+		return expr == "true", nil
+	case len(expr) >= 2 && (expr[0] == '\'' || expr[0] == '"') && expr[len(expr)-1] == expr[0]:
+		return expr[1 : len(expr)-1], nil
+	}
+	if f, err := strconv.ParseFloat(expr, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("%q is not a literal", expr)
+}
+
+func (c *condition) match(doc protocol.Document) bool {
+	for _, ands := range c.ors {
+		matched := true
+		for _, cmp := range ands {
+			if !cmp.match(doc) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (cmp *comparison) match(doc protocol.Document) bool {
+	value, _ := doc.Get(cmp.field)
+	switch cmp.op {
+	case "==":
+		return equals(value, cmp.value)
+	case "!=":
+		return !equals(value, cmp.value)
+	case "!":
+		return !truthy(value)
+	default:
+		return truthy(value)
+	}
+}
+
+func equals(value, literal any) bool {
+	if value == nil || literal == nil {
+		return value == nil && literal == nil
+	}
+	if f, ok := literal.(float64); ok {
+		v, err := toFloat(value)
+		return err == nil && v == f
+	}
+	return fmt.Sprint(value) == fmt.Sprint(literal)
+}
+
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	default:
+		return true
+	}
+}
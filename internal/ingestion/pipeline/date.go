@@ -0,0 +1,61 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/utils"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+type dateProcessor struct {
+	fieldProcessor
+	parsers  []utils.TimeParser
+	location *time.Location
+}
+
+func newDateProcessor(cfg *protocol.ProcessorConfig) (processor, error) {
+	base, err := newFieldProcessor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TargetField == "" {
+		base.target = consts.TimestampField
+	}
+	if len(cfg.Formats) == 0 {
+		return nil, errors.New("formats is required")
+	}
+	p := &dateProcessor{fieldProcessor: base, location: time.UTC}
+	if cfg.Timezone != "" {
+		if p.location = utils.ParseTimeZone(cfg.Timezone); p.location == nil {
+			return nil, fmt.Errorf("timezone [%s] is invalid", cfg.Timezone)
+		}
+	}
+	for _, format := range cfg.Formats {
+		parser, err := utils.NewTimeParser(format)
+		if err != nil {
+			return nil, err
+		}
+		p.parsers = append(p.parsers, parser)
+	}
+	return p, nil
+}
+
+func (p *dateProcessor) process(doc protocol.Document) (bool, error) {
+	value, ok, err := p.get(doc)
+	if !ok || err != nil {
+		return err == nil, err
+	}
+	s := utils.FormatTimeValue(value)
+	for _, parse := range p.parsers {
+		if t, err := parse(s, p.location); err == nil {
+			doc.Set(p.target, t)
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("unable to parse date [%s]", s)
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+var dissectRegexp = regexp.MustCompile(`%\{([^}]*)\}`)
+
+// dissectKey is a `%{key}` in the dissect pattern and the delimiter following it
+type dissectKey struct {
+	name string
+	// skip is true for `%{}` and `%{?name}`, the matched value is discarded
+	skip bool
+	// append is true for `%{+name}`, the matched value is appended to the previous ones
+	append bool
+	// padded is true for `%{name->}`, the repeated delimiters following the value are skipped
+	padded    bool
+	delimiter string
+}
+
+type dissectProcessor struct {
+	fieldProcessor
+	prefix          string
+	keys            []*dissectKey
+	appendSeparator string
+}
+
+func newDissectProcessor(cfg *protocol.ProcessorConfig) (processor, error) {
+	base, err := newFieldProcessor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Pattern == "" {
+		return nil, errors.New("pattern is required")
+	}
+	p := &dissectProcessor{fieldProcessor: base, appendSeparator: cfg.AppendSeparator}
+	matches := dissectRegexp.FindAllStringSubmatchIndex(cfg.Pattern, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("dissect pattern [%s] has no key", cfg.Pattern)
+	}
+	p.prefix = cfg.Pattern[:matches[0][0]]
+	for i, m := range matches {
+		key := &dissectKey{name: cfg.Pattern[m[2]:m[3]]}
+		if strings.HasSuffix(key.name, "->") {
+			key.padded = true
+			key.name = strings.TrimSuffix(key.name, "->")
+		}
+		switch {
+		case key.name == "":
+			key.skip = true
+		case strings.HasPrefix(key.name, "?"):
+			key.skip = true
+		case strings.HasPrefix(key.name, "+"):
+			key.append = true
+			key.name = key.name[1:]
+		}
+		end := len(cfg.Pattern)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		key.delimiter = cfg.Pattern[m[1]:end]
+		if key.delimiter == "" && i+1 < len(matches) {
+			return nil, fmt.Errorf("dissect pattern [%s] has adjacent keys", cfg.Pattern)
+		}
+		p.keys = append(p.keys, key)
+	}
+	return p, nil
+}
+
+func (p *dissectProcessor) process(doc protocol.Document) (bool, error) {
+	s, ok, err := p.getString(doc)
+	if !ok || err != nil {
+		return err == nil, err
+	}
+	if !strings.HasPrefix(s, p.prefix) {
+		return false, fmt.Errorf("field [%s] does not match the dissect pattern", p.field)
+	}
+	s = s[len(p.prefix):]
+	values := make(map[string]string)
+	order := make([]string, 0, len(p.keys))
+	for i, key := range p.keys {
+		var value string
+		if i == len(p.keys)-1 && key.delimiter == "" {
+			value, s = s, ""
+		} else {
+			end := strings.Index(s, key.delimiter)
+			if end < 0 {
+				return false, fmt.Errorf("field [%s] does not match the dissect pattern", p.field)
+			}
+			value, s = s[:end], s[end+len(key.delimiter):]
+			if key.padded {
+				for strings.HasPrefix(s, key.delimiter) {
+					s = s[len(key.delimiter):]
+				}
+			}
+		}
+		if key.skip {
+			continue
+		}
+		if previous, exist := values[key.name]; exist && key.append {
+			values[key.name] = previous + p.appendSeparator + value
+			continue
+		}
+		if _, exist := values[key.name]; !exist {
+			order = append(order, key.name)
+		}
+		values[key.name] = value
+	}
+	for _, name := range order {
+		doc.Set(name, values[name])
+	}
+	return true, nil
+}
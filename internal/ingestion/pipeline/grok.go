@@ -0,0 +1,181 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+// grokPatterns are the built-in patterns, a subset of the ones shipped with Elasticsearch
+var grokPatterns = map[string]string{
+	"USERNAME":          `[a-zA-Z0-9._-]+`,
+	"USER":              `%{USERNAME}`,
+	"INT":               `[+-]?[0-9]+`,
+	"BASE10NUM":         `[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+)`,
+	"NUMBER":            `%{BASE10NUM}`,
+	"BASE16NUM":         `[+-]?(?:0x)?[0-9A-Fa-f]+`,
+	"POSINT":            `[1-9][0-9]*`,
+	"NONNEGINT":         `[0-9]+`,
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"QUOTEDSTRING":      `"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"IPV4":              `(?:(?:25[0-5]|2[0-4][0-9]|[01]?[0-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|[01]?[0-9]?[0-9])`,
+	"IPV6":              `[0-9A-Fa-f:]*:[0-9A-Fa-f:.]+`,
+	"IP":                `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?\b`,
+	"IPORHOST":          `(?:%{IP}|%{HOSTNAME})`,
+	"HOSTPORT":          `%{IPORHOST}:%{POSINT}`,
+	"PATH":              `(?:/[^\s?#]*)+`,
+	"URIPROTO":          `[A-Za-z][A-Za-z0-9+.-]+`,
+	"URIPATHPARAM":      `\S+`,
+	"URI":               `%{URIPROTO}://\S+`,
+	"LOGLEVEL":          `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|severe|emerg(?:ency)?|alert)`,
+	"MONTH":             `\b(?:[Jj]an(?:uary)?|[Ff]eb(?:ruary)?|[Mm]ar(?:ch)?|[Aa]pr(?:il)?|[Mm]ay|[Jj]une?|[Jj]uly?|[Aa]ug(?:ust)?|[Ss]ep(?:tember)?|[Oo]ct(?:ober)?|[Nn]ov(?:ember)?|[Dd]ec(?:ember)?)\b`,
+	"MONTHNUM":          `(?:0?[1-9]|1[0-2])`,
+	"MONTHDAY":          `(?:(?:0[1-9])|(?:[12][0-9])|(?:3[01])|[1-9])`,
+	"DAY":               `(?:Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?)`,
+	"YEAR":              `\d\d(?:\d\d)?`,
+	"HOUR":              `(?:2[0123]|[01]?[0-9])`,
+	"MINUTE":            `(?:[0-5][0-9])`,
+	"SECOND":            `(?:(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?)`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"ISO8601_TIMEZONE":  `(?:Z|[+-]%{HOUR}(?::?%{MINUTE}))`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?%{ISO8601_TIMEZONE}?`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} %{INT}`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+	"COMMONAPACHELOG":   `%{IPORHOST:clientip} %{USER:ident} %{USER:auth} \[%{HTTPDATE:timestamp}\] "(?:%{WORD:verb} %{NOTSPACE:request}(?: HTTP/%{NUMBER:httpversion})?|%{DATA:rawrequest})" %{NUMBER:response} (?:%{NUMBER:bytes}|-)`,
+	"COMBINEDAPACHELOG": `%{COMMONAPACHELOG} %{QUOTEDSTRING:referrer} %{QUOTEDSTRING:agent}`,
+}
+
+var grokRegexp = regexp.MustCompile(`%\{(\w+)(?::([\w.@\[\]-]+))?(?::(int|float))?\}`)
+
+// grokMaxDepth limits the nesting of the patterns to detect the recursive definitions
+const grokMaxDepth = 16
+
+type grokCapture struct {
+	field string
+	typ   string
+}
+
+type grokExpr struct {
+	regexp   *regexp.Regexp
+	captures map[string]*grokCapture
+}
+
+type grokProcessor struct {
+	fieldProcessor
+	exprs []*grokExpr
+}
+
+func newGrokProcessor(cfg *protocol.ProcessorConfig) (processor, error) {
+	base, err := newFieldProcessor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Patterns) == 0 {
+		return nil, errors.New("patterns is required")
+	}
+	p := &grokProcessor{fieldProcessor: base}
+	for _, pattern := range cfg.Patterns {
+		expr, err := compileGrok(pattern, cfg.PatternDefinitions)
+		if err != nil {
+			return nil, err
+		}
+		p.exprs = append(p.exprs, expr)
+	}
+	return p, nil
+}
+
+func compileGrok(pattern string, definitions map[string]string) (*grokExpr, error) {
+	expr := &grokExpr{captures: make(map[string]*grokCapture)}
+	expanded, err := expandGrok(pattern, definitions, expr.captures, 0)
+	if err != nil {
+		return nil, err
+	}
+	if expr.regexp, err = regexp.Compile(expanded); err != nil {
+		return nil, fmt.Errorf("invalid grok pattern [%s]: %w", pattern, err)
+	}
+	return expr, nil
+}
+
+// expandGrok replaces the `%{NAME:field:type}` in the pattern with the regular expressions
+// recursively, the named fields become the capture groups
+func expandGrok(
+	pattern string,
+	definitions map[string]string,
+	captures map[string]*grokCapture,
+	depth int,
+) (string, error) {
+	if depth > grokMaxDepth {
+		return "", fmt.Errorf("grok pattern [%s] is nested too deeply", pattern)
+	}
+	var err error
+	expanded := grokRegexp.ReplaceAllStringFunc(pattern, func(m string) string {
+		if err != nil {
+			return ""
+		}
+		sub := grokRegexp.FindStringSubmatch(m)
+		name, field, typ := sub[1], sub[2], sub[3]
+		definition, ok := definitions[name]
+		if !ok {
+			definition, ok = grokPatterns[name]
+		}
+		if !ok {
+			err = fmt.Errorf("unknown grok pattern [%s]", name)
+			return ""
+		}
+		var inner string
+		if inner, err = expandGrok(definition, definitions, captures, depth+1); err != nil {
+			return ""
+		}
+		if field == "" {
+			return "(?:" + inner + ")"
+		}
+		group := "g" + strconv.Itoa(len(captures))
+		captures[group] = &grokCapture{field: field, typ: typ}
+		return "(?P<" + group + ">" + inner + ")"
+	})
+	return expanded, err
+}
+
+func (p *grokProcessor) process(doc protocol.Document) (bool, error) {
+	s, ok, err := p.getString(doc)
+	if !ok || err != nil {
+		return err == nil, err
+	}
+	for _, expr := range p.exprs {
+		match := expr.regexp.FindStringSubmatchIndex(s)
+		if match == nil {
+			continue
+		}
+		for i, group := range expr.regexp.SubexpNames() {
+			capture, ok := expr.captures[group]
+			if !ok || match[2*i] < 0 {
+				continue
+			}
+			var value any = s[match[2*i]:match[2*i+1]]
+			switch capture.typ {
+			case "int":
+				if value, err = toInt(value); err != nil {
+					return false, err
+				}
+			case "float":
+				if value, err = toFloat(value); err != nil {
+					return false, err
+				}
+			}
+			doc.Set(capture.field, value)
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("field [%s] does not match any grok pattern", p.field)
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package pipeline pre-processes the documents by the ingest pipelines before they are ingested
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+// Pipeline is the compiled form of a protocol.Pipeline
+type Pipeline struct {
+	ID         string
+	processors []*wrappedProcessor
+}
+
+// processor processes a document in place, it returns false if the document should be dropped
+type processor interface {
+	process(doc protocol.Document) (bool, error)
+}
+
+// wrappedProcessor applies the options shared by all processors
+type wrappedProcessor struct {
+	name          string
+	cond          *condition
+	ignoreFailure bool
+	processor
+}
+
+// Compile validates the pipeline and compiles it for processing, an invalid processor is reported
+// as an errs.ProcessorError
+func Compile(p *protocol.Pipeline) (*Pipeline, error) {
+	pipeline := &Pipeline{ID: p.ID}
+	for i, proc := range p.Processors {
+		if len(proc) != 1 {
+			return nil, &errs.ProcessorError{
+				Processor: fmt.Sprintf("processors[%d]", i),
+				Message:   "a processor must have exactly one type",
+			}
+		}
+		for typ, cfg := range proc {
+			if cfg == nil {
+				cfg = &protocol.ProcessorConfig{}
+			}
+			wrapped, err := compileProcessor(typ, cfg)
+			if err != nil {
+				return nil, &errs.ProcessorError{
+					Processor: fmt.Sprintf("processors[%d].%s", i, typ),
+					Message:   err.Error(),
+				}
+			}
+			pipeline.processors = append(pipeline.processors, wrapped)
+		}
+	}
+	return pipeline, nil
+}
+
+func compileProcessor(typ string, cfg *protocol.ProcessorConfig) (*wrappedProcessor, error) {
+	var p processor
+	var err error
+	switch typ {
+	case consts.ProcessorSet:
+		p, err = newSetProcessor(cfg)
+	case consts.ProcessorRemove:
+		p, err = newRemoveProcessor(cfg)
+	case consts.ProcessorRename:
+		p, err = newRenameProcessor(cfg)
+	case consts.ProcessorLowercase, consts.ProcessorUppercase:
+		p, err = newCaseProcessor(cfg, typ == consts.ProcessorUppercase)
+	case consts.ProcessorConvert:
+		p, err = newConvertProcessor(cfg)
+	case consts.ProcessorDate:
+		p, err = newDateProcessor(cfg)
+	case consts.ProcessorGrok:
+		p, err = newGrokProcessor(cfg)
+	case consts.ProcessorDissect:
+		p, err = newDissectProcessor(cfg)
+	case consts.ProcessorJSON:
+		p, err = newJSONProcessor(cfg)
+	case consts.ProcessorSplit:
+		p, err = newSplitProcessor(cfg)
+	case consts.ProcessorDrop:
+		p = &dropProcessor{}
+	default:
+		return nil, fmt.Errorf("unsupported processor type %s", typ)
+	}
+	if err != nil {
+		return nil, err
+	}
+	wrapped := &wrappedProcessor{name: typ, ignoreFailure: cfg.IgnoreFailure, processor: p}
+	if cfg.Tag != "" {
+		wrapped.name = fmt.Sprintf("%s[%s]", typ, cfg.Tag)
+	}
+	if cfg.If != "" {
+		if wrapped.cond, err = compileCondition(cfg.If); err != nil {
+			return nil, err
+		}
+	}
+	return wrapped, nil
+}
+
+// Process runs the processors on the document in order, it returns false if the document is
+// dropped by a processor, or an errs.ProcessorError if a processor fails.
+func (p *Pipeline) Process(doc protocol.Document) (bool, error) {
+	for _, proc := range p.processors {
+		if proc.cond != nil && !proc.cond.match(doc) {
+			continue
+		}
+		keep, err := proc.process(doc)
+		if err != nil {
+			if proc.ignoreFailure {
+				continue
+			}
+			return false, &errs.ProcessorError{Processor: proc.name, Message: err.Error()}
+		}
+		if !keep {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package pipeline
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+func compile(t *testing.T, definition string) *Pipeline {
+	p := &protocol.Pipeline{}
+	assert.NoError(t, json.Unmarshal([]byte(definition), p))
+	pipeline, err := Compile(p)
+	assert.NoError(t, err)
+	return pipeline
+}
+
+func TestPipeline(t *testing.T) {
+	t.Run("test_field_processors", func(t *testing.T) {
+		pipeline := compile(t, `{
+			"processors": [
+				{"set": {"field": "service", "value": "{{app.name}}-{{env}}"}},
+				{"set": {"field": "env", "value": "prod", "override": false}},
+				{"rename": {"field": "msg", "target_field": "message"}},
+				{"lowercase": {"field": "level"}},
+				{"uppercase": {"field": "app.name"}},
+				{"convert": {"field": "status", "type": "integer"}},
+				{"convert": {"field": "ratios", "type": "float"}},
+				{"split": {"field": "tags", "separator": "\\s*,\\s*"}},
+				{"remove": {"field": ["tmp", "absent"], "ignore_missing": true}}
+			]
+		}`)
+		doc := protocol.Document{
+			"app":    map[string]any{"name": "shop"},
+			"env":    "test",
+			"msg":    "hello",
+			"level":  "WARN",
+			"status": "404",
+			"ratios": []any{"0.5", "1"},
+			"tags":   "a, b,c",
+			"tmp":    true,
+		}
+		keep, err := pipeline.Process(doc)
+		assert.NoError(t, err)
+		assert.True(t, keep)
+		assert.Equal(t, protocol.Document{
+			"app":     map[string]any{"name": "SHOP"},
+			"service": "shop-test",
+			"env":     "test",
+			"message": "hello",
+			"level":   "warn",
+			"status":  int64(404),
+			"ratios":  []any{0.5, 1.0},
+			"tags":    []any{"a", "b", "c"},
+		}, doc)
+	})
+
+	t.Run("test_parsing_processors", func(t *testing.T) {
+		pipeline := compile(t, `{
+			"processors": [
+				{"grok": {
+					"field": "message",
+					"patterns": ["%{IP:client} %{WORD:method} %{URIPATHPARAM:path} %{STATUS:status:int}"],
+					"pattern_definitions": {"STATUS": "[1-5][0-9]{2}"}
+				}},
+				{"dissect": {"field": "line", "pattern": "[%{ts}] %{level->} %{+ts} %{?skip}: %{msg}",
+					"append_separator": " "}},
+				{"date": {"field": "ts", "formats": ["ISO8601", "dd/MMM/yyyy:HH:mm:ss Z"]}},
+				{"json": {"field": "payload", "add_to_root": true}}
+			]
+		}`)
+		doc := protocol.Document{
+			"message": "10.0.0.1 GET /index.html 200",
+			"line":    "[26/Jan/2023:08:00:40] INFO   +0800 main: started",
+			"payload": `{"user": {"id": 1}}`,
+		}
+		keep, err := pipeline.Process(doc)
+		assert.NoError(t, err)
+		assert.True(t, keep)
+		assert.Equal(t, "10.0.0.1", doc["client"])
+		assert.Equal(t, "GET", doc["method"])
+		assert.Equal(t, "/index.html", doc["path"])
+		assert.Equal(t, int64(200), doc["status"])
+		assert.Equal(t, "INFO", doc["level"])
+		assert.Equal(t, "started", doc["msg"])
+		assert.NotContains(t, doc, "skip")
+		timestamp, ok := doc["@timestamp"].(time.Time)
+		assert.True(t, ok)
+		assert.Equal(t, int64(1674691240), timestamp.Unix())
+		assert.Equal(t, map[string]any{"id": 1.0}, doc["user"])
+	})
+
+	t.Run("test_condition_and_drop", func(t *testing.T) {
+		pipeline := compile(t, `{
+			"processors": [
+				{"drop": {"if": "ctx.level == 'debug' || ctx?.http?.status == 200 && !ctx.keep"}},
+				{"set": {"field": "kept", "value": true}}
+			]
+		}`)
+		for _, c := range []struct {
+			doc  protocol.Document
+			keep bool
+		}{
+			{protocol.Document{"level": "debug"}, false},
+			{protocol.Document{"level": "info"}, true},
+			{protocol.Document{"http": map[string]any{"status": 200.0}}, false},
+			{protocol.Document{"http": map[string]any{"status": 200.0}, "keep": true}, true},
+		} {
+			keep, err := pipeline.Process(c.doc)
+			assert.NoError(t, err)
+			assert.Equal(t, c.keep, keep)
+			if keep {
+				assert.Equal(t, true, c.doc["kept"])
+			}
+		}
+	})
+
+	t.Run("test_failure", func(t *testing.T) {
+		pipeline := compile(t, `{
+			"processors": [
+				{"convert": {"field": "a", "type": "integer", "ignore_failure": true}},
+				{"rename": {"field": "b", "target_field": "c", "tag": "rename_b"}}
+			]
+		}`)
+		_, err := pipeline.Process(protocol.Document{"a": "x", "b": 1, "c": 2})
+		assert.True(t, errs.IsProcessorError(err))
+		assert.Contains(t, err.Error(), "rename[rename_b]")
+
+		for _, definition := range []string{
+			`{"processors": [{"unknown": {}}]}`,
+			`{"processors": [{"convert": {"field": "a", "type": "bigint"}}]}`,
+			`{"processors": [{"grok": {"field": "a", "patterns": ["%{UNKNOWN:a}"]}}]}`,
+			`{"processors": [{"drop": {"if": "level == 'debug'"}}]}`,
+		} {
+			p := &protocol.Pipeline{}
+			assert.NoError(t, json.Unmarshal([]byte(definition), p))
+			_, err := Compile(p)
+			assert.True(t, errs.IsProcessorError(err), definition)
+		}
+	})
+}
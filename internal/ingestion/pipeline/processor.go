@@ -0,0 +1,396 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+// single returns the only field of the processor
+func single(cfg *protocol.ProcessorConfig) (string, error) {
+	if len(cfg.Field) != 1 || cfg.Field[0] == "" {
+		return "", errors.New("exactly one field is required")
+	}
+	return cfg.Field[0], nil
+}
+
+func targetOf(cfg *protocol.ProcessorConfig, field string) string {
+	if cfg.TargetField != "" {
+		return cfg.TargetField
+	}
+	return field
+}
+
+// fieldProcessor is the base of the processors that read a field
+type fieldProcessor struct {
+	field         string
+	target        string
+	ignoreMissing bool
+}
+
+func newFieldProcessor(cfg *protocol.ProcessorConfig) (fieldProcessor, error) {
+	field, err := single(cfg)
+	if err != nil {
+		return fieldProcessor{}, err
+	}
+	return fieldProcessor{
+		field:         field,
+		target:        targetOf(cfg, field),
+		ignoreMissing: cfg.IgnoreMissing,
+	}, nil
+}
+
+// get returns the value of the field, ok is false if the field is missing and it is ignored
+func (p *fieldProcessor) get(doc protocol.Document) (value any, ok bool, err error) {
+	value, exist := doc.Get(p.field)
+	if !exist || value == nil {
+		if p.ignoreMissing {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("field [%s] does not exist", p.field)
+	}
+	return value, true, nil
+}
+
+func (p *fieldProcessor) getString(doc protocol.Document) (string, bool, error) {
+	value, ok, err := p.get(doc)
+	if !ok || err != nil {
+		return "", ok, err
+	}
+	s, isString := value.(string)
+	if !isString {
+		return "", false, fmt.Errorf("field [%s] of type %T cannot be cast to string", p.field, value)
+	}
+	return s, true, nil
+}
+
+var templateRegexp = regexp.MustCompile(`\{\{\{?\s*([^{}\s]+)\s*\}?\}\}`)
+
+type setProcessor struct {
+	field    string
+	value    any
+	template bool
+	override bool
+}
+
+func newSetProcessor(cfg *protocol.ProcessorConfig) (processor, error) {
+	field, err := single(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Value == nil {
+		return nil, errors.New("value is required")
+	}
+	p := &setProcessor{field: field, value: cfg.Value, override: true}
+	if cfg.Override != nil {
+		p.override = *cfg.Override
+	}
+	if s, ok := cfg.Value.(string); ok {
+		p.template = templateRegexp.MatchString(s)
+	}
+	return p, nil
+}
+
+func (p *setProcessor) process(doc protocol.Document) (bool, error) {
+	if !p.override {
+		if value, ok := doc.Get(p.field); ok && value != nil {
+			return true, nil
+		}
+	}
+	value := p.value
+	if p.template {
+		value = templateRegexp.ReplaceAllStringFunc(p.value.(string), func(m string) string {
+			v, ok := doc.Get(templateRegexp.FindStringSubmatch(m)[1])
+			if !ok || v == nil {
+				return ""
+			}
+			return fmt.Sprint(v)
+		})
+	}
+	doc.Set(p.field, value)
+	return true, nil
+}
+
+type removeProcessor struct {
+	fields        []string
+	ignoreMissing bool
+}
+
+func newRemoveProcessor(cfg *protocol.ProcessorConfig) (processor, error) {
+	if len(cfg.Field) == 0 {
+		return nil, errors.New("field is required")
+	}
+	return &removeProcessor{fields: cfg.Field, ignoreMissing: cfg.IgnoreMissing}, nil
+}
+
+func (p *removeProcessor) process(doc protocol.Document) (bool, error) {
+	for _, field := range p.fields {
+		if !doc.Remove(field) && !p.ignoreMissing {
+			return false, fmt.Errorf("field [%s] does not exist", field)
+		}
+	}
+	return true, nil
+}
+
+type renameProcessor struct {
+	fieldProcessor
+}
+
+func newRenameProcessor(cfg *protocol.ProcessorConfig) (processor, error) {
+	base, err := newFieldProcessor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TargetField == "" {
+		return nil, errors.New("target_field is required")
+	}
+	return &renameProcessor{base}, nil
+}
+
+func (p *renameProcessor) process(doc protocol.Document) (bool, error) {
+	value, ok, err := p.get(doc)
+	if !ok || err != nil {
+		return err == nil, err
+	}
+	if _, exist := doc.Get(p.target); exist {
+		return false, fmt.Errorf("field [%s] already exists", p.target)
+	}
+	doc.Remove(p.field)
+	doc.Set(p.target, value)
+	return true, nil
+}
+
+type caseProcessor struct {
+	fieldProcessor
+	upper bool
+}
+
+func newCaseProcessor(cfg *protocol.ProcessorConfig, upper bool) (processor, error) {
+	base, err := newFieldProcessor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &caseProcessor{base, upper}, nil
+}
+
+func (p *caseProcessor) process(doc protocol.Document) (bool, error) {
+	s, ok, err := p.getString(doc)
+	if !ok || err != nil {
+		return err == nil, err
+	}
+	if p.upper {
+		doc.Set(p.target, strings.ToUpper(s))
+	} else {
+		doc.Set(p.target, strings.ToLower(s))
+	}
+	return true, nil
+}
+
+type convertProcessor struct {
+	fieldProcessor
+	convert func(any) (any, error)
+}
+
+func newConvertProcessor(cfg *protocol.ProcessorConfig) (processor, error) {
+	base, err := newFieldProcessor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p := &convertProcessor{fieldProcessor: base}
+	switch cfg.Type {
+	case "integer", "long":
+		p.convert = toInt
+	case "float", "double":
+		p.convert = func(v any) (any, error) { return toFloat(v) }
+	case "boolean":
+		p.convert = toBool
+	case "string":
+		p.convert = func(v any) (any, error) { return fmt.Sprint(v), nil }
+	case "auto":
+		p.convert = toAuto
+	default:
+		return nil, fmt.Errorf("type [%s] is not supported", cfg.Type)
+	}
+	return p, nil
+}
+
+func (p *convertProcessor) process(doc protocol.Document) (bool, error) {
+	value, ok, err := p.get(doc)
+	if !ok || err != nil {
+		return err == nil, err
+	}
+	if values, isArray := value.([]any); isArray {
+		converted := make([]any, len(values))
+		for i, v := range values {
+			if converted[i], err = p.convert(v); err != nil {
+				return false, err
+			}
+		}
+		doc.Set(p.target, converted)
+		return true, nil
+	}
+	if value, err = p.convert(value); err != nil {
+		return false, err
+	}
+	doc.Set(p.target, value)
+	return true, nil
+}
+
+func toInt(value any) (any, error) {
+	switch v := value.(type) {
+	case int, int32, int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case float32:
+		return int64(v), nil
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert [%s] to integer", v)
+		}
+		return i, nil
+	}
+	return nil, fmt.Errorf("unable to convert %v of type %T to integer", value, value)
+}
+
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("unable to convert [%s] to float", v)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("unable to convert %v of type %T to float", value, value)
+}
+
+func toBool(value any) (any, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to convert %v to boolean", value)
+}
+
+// toAuto converts a string to an integer, a float or a boolean if it looks like one
+func toAuto(value any) (any, error) {
+	s, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	if b, err := toBool(s); err == nil {
+		return b, nil
+	}
+	return s, nil
+}
+
+type jsonProcessor struct {
+	fieldProcessor
+	addToRoot bool
+}
+
+func newJSONProcessor(cfg *protocol.ProcessorConfig) (processor, error) {
+	base, err := newFieldProcessor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AddToRoot && cfg.TargetField != "" {
+		return nil, errors.New("target_field cannot be set when add_to_root is true")
+	}
+	return &jsonProcessor{base, cfg.AddToRoot}, nil
+}
+
+func (p *jsonProcessor) process(doc protocol.Document) (bool, error) {
+	s, ok, err := p.getString(doc)
+	if !ok || err != nil {
+		return err == nil, err
+	}
+	var value any
+	if err := json.Unmarshal([]byte(s), &value); err != nil {
+		return false, fmt.Errorf("field [%s] is not a valid JSON: %w", p.field, err)
+	}
+	if !p.addToRoot {
+		doc.Set(p.target, value)
+		return true, nil
+	}
+	obj, isObject := value.(map[string]any)
+	if !isObject {
+		return false, fmt.Errorf("field [%s] is not a JSON object to add to the root", p.field)
+	}
+	for k, v := range obj {
+		doc[k] = v
+	}
+	return true, nil
+}
+
+type splitProcessor struct {
+	fieldProcessor
+	separator *regexp.Regexp
+}
+
+func newSplitProcessor(cfg *protocol.ProcessorConfig) (processor, error) {
+	base, err := newFieldProcessor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Separator == "" {
+		return nil, errors.New("separator is required")
+	}
+	separator, err := regexp.Compile(cfg.Separator)
+	if err != nil {
+		return nil, err
+	}
+	return &splitProcessor{base, separator}, nil
+}
+
+func (p *splitProcessor) process(doc protocol.Document) (bool, error) {
+	s, ok, err := p.getString(doc)
+	if !ok || err != nil {
+		return err == nil, err
+	}
+	parts := p.separator.Split(s, -1)
+	values := make([]any, len(parts))
+	for i, part := range parts {
+		values[i] = part
+	}
+	doc.Set(p.target, values)
+	return true, nil
+}
+
+type dropProcessor struct{}
+
+func (p *dropProcessor) process(protocol.Document) (bool, error) {
+	return false, nil
+}
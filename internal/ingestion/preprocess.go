@@ -0,0 +1,56 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package ingestion
+
+import (
+	"sync"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/ingestion/pipeline"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+// compiledPipelines caches { id -> compiledPipeline }
+var compiledPipelines sync.Map
+
+type compiledPipeline struct {
+	// source is the definition that the pipeline is compiled from, the pipeline is recompiled once
+	// the definition is replaced
+	source   *protocol.Pipeline
+	pipeline *pipeline.Pipeline
+}
+
+// getPipeline returns the pipeline to pre-process the documents of the index, the default
+// pipeline of the index is used if id is empty. nil is returned if there is no pipeline.
+func getPipeline(index *core.Index, id string) (*pipeline.Pipeline, error) {
+	if id == "" && index.Settings != nil {
+		id = index.Settings.DefaultPipeline
+	}
+	if id == "" || id == consts.PipelineNone {
+		return nil, nil
+	}
+	source, err := metadata.GetPipelineExplicitly(id)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := compiledPipelines.Load(id); ok && cached.(*compiledPipeline).source == source {
+		return cached.(*compiledPipeline).pipeline, nil
+	}
+	p, err := pipeline.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	compiledPipelines.Store(id, &compiledPipeline{source: source, pipeline: p})
+	return p, nil
+}
+
+// preprocess runs the pipeline on the document, it returns false if the document is dropped
+func preprocess(index *core.Index, id string, doc protocol.Document) (bool, error) {
+	p, err := getPipeline(index, id)
+	if err != nil || p == nil {
+		return err == nil, err
+	}
+	return p.Process(doc)
+}
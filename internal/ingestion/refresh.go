@@ -0,0 +1,54 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package ingestion
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/wal"
+)
+
+// RefreshTimeout is the longest time to wait for the WAL to be consumed under RefreshWaitFor
+var RefreshTimeout = time.Minute
+
+// Refresh makes the accepted operations visible to search according to the refresh policy.
+// It returns after every affected shard has consumed its WAL to the last accepted operation.
+func Refresh(refresh string, results ...[]*Result) error {
+	switch refresh {
+	case consts.RefreshFalse:
+		return nil
+	case consts.RefreshTrue, consts.RefreshWaitFor:
+	default:
+		return &errs.InvalidFieldValError{Field: "refresh", Type: "string", Value: refresh}
+	}
+	walIndexes := make(map[*core.Shard]uint64)
+	for _, rs := range results {
+		for _, result := range rs {
+			if result == nil || result.Err != nil || result.Shard == nil {
+				continue
+			}
+			if result.WalIndex > walIndexes[result.Shard] {
+				walIndexes[result.Shard] = result.WalIndex
+			}
+		}
+	}
+	for shard, walIndex := range walIndexes {
+		if refresh == consts.RefreshTrue {
+			if err := wal.ForceConsumeWAL(shard, walIndex); err != nil {
+				return err
+			}
+		} else if !shard.WaitForWalIndex(walIndex, RefreshTimeout) {
+			return fmt.Errorf(
+				"wait for the wal of shard %s to be consumed to %d timeout after %s",
+				shard.GetName(),
+				walIndex,
+				RefreshTimeout,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package forward receives the events forwarded by Fluentd or Fluent Bit over the Fluent forward
+// protocol and ingests them as documents
+package forward
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/input"
+	"github.com/ugorji/go/codec"
+	"go.uber.org/zap"
+)
+
+// Server listens on the configured address, each message received is ingested into the index
+// named after its lowercased tag before it is acked, so that the client retries the messages which
+// are not acked when the server stops
+type Server struct {
+	options  *config.Forward
+	listener net.Listener
+	conns    sync.Map
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Start starts listening on the address in the options, the returned server should be stopped by
+// Stop
+func Start(options *config.Forward) (*Server, error) {
+	listener, err := net.Listen("tcp", options.Address)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{options: options, listener: listener, stop: make(chan struct{})}
+	s.wg.Add(1)
+	go s.serve()
+	logger.Info("forward input started", zap.String("address", options.Address))
+	return s, nil
+}
+
+// Stop closes the listener and the connections, the messages being ingested are not acked
+func (s *Server) Stop() {
+	close(s.stop)
+	s.listener.Close()
+	s.conns.Range(func(conn, _ any) bool {
+		conn.(net.Conn).Close()
+		return true
+	})
+	s.wg.Wait()
+}
+
+// Addr returns the address that the server listens on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Error("forward accept failed", zap.Error(err))
+			}
+			return
+		}
+		s.conns.Store(conn, struct{}{})
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.conns.Delete(conn)
+			defer conn.Close()
+			if err := s.readMessages(conn); err != nil && !errors.Is(err, net.ErrClosed) {
+				logger.Warn(
+					"forward connection closed",
+					zap.String("remote", conn.RemoteAddr().String()),
+					zap.Error(err),
+				)
+			}
+		}()
+	}
+}
+
+// readMessages reads the messages of a connection one by one until the connection is closed, a
+// message that cannot be decoded breaks the connection since the rest of the stream is unreadable
+func (s *Server) readMessages(conn net.Conn) error {
+	decoder := codec.NewDecoder(bufio.NewReader(conn), handle)
+	encoder := codec.NewEncoder(conn, handle)
+	for {
+		var values []any
+		if err := decoder.Decode(&values); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		m, err := decodeMessage(values)
+		if err != nil {
+			return err
+		}
+		if err = s.ingest(m); err != nil {
+			return err
+		}
+		if chunk := m.Chunk(); chunk != "" {
+			if err = encoder.Encode(map[string]any{"ack": chunk}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ingest ingests the events of the message, an error is returned only if the server stops before
+// the events are ingested
+func (s *Server) ingest(m *Message) error {
+	if len(m.Entries) == 0 {
+		return nil
+	}
+	name := strings.ToLower(m.Tag)
+	return input.IngestBlocking(name, m.Entries, s.stop)
+}
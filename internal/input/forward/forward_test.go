@@ -0,0 +1,63 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package forward
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/tatris-io/tatris/internal/query"
+	"github.com/ugorji/go/codec"
+)
+
+func TestServer(t *testing.T) {
+	version := strings.ReplaceAll(
+		time.Now().Format(consts.TimeFmtWithoutSeparator),
+		consts.Dot,
+		consts.Empty,
+	)
+	server, err := Start(&config.Forward{Enabled: true, Address: "127.0.0.1:0"})
+	assert.NoError(t, err)
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	now := time.Now()
+	entries := []any{
+		[]any{eventTime(now), map[string]any{"log": "payment failed"}},
+		[]any{now.Unix(), map[string]any{"log": "payment retried"}},
+	}
+	tag := "Forward_" + version
+	option := map[string]any{"chunk": "chunk-1"}
+	assert.NoError(t, codec.NewEncoder(conn, writeHandle).Encode([]any{tag, entries, option}))
+
+	// the ack is answered after the events are ingested
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Second)))
+	var ack map[string]any
+	assert.NoError(t, codec.NewDecoder(conn, handle).Decode(&ack))
+	assert.Equal(t, map[string]any{"ack": "chunk-1"}, ack)
+
+	// the index is named after the lowercased tag
+	name := "forward_" + version
+	assert.Eventually(t, func() bool {
+		index, err := metadata.GetIndexExplicitly(name)
+		if err != nil {
+			return false
+		}
+		resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+			Index: name,
+			Query: protocol.Query{MatchAll: &protocol.MatchAll{}},
+			Size:  0,
+		})
+		return err == nil && resp.Hits.Total.Value == 2
+	}, 10*time.Second, 100*time.Millisecond)
+}
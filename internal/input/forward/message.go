@@ -0,0 +1,196 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package forward
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/ugorji/go/codec"
+)
+
+const (
+	optionChunk      = "chunk"
+	optionCompressed = "compressed"
+	compressedGzip   = "gzip"
+	// eventTimeExt is the msgpack extension type of EventTime, which holds the seconds and the
+	// nanoseconds as two big-endian uint32
+	eventTimeExt = 0
+)
+
+// handle decodes the msgpack values of the forward protocol, maps are decoded with string keys
+// and integers are decoded as int64, as the documents of the JSON APIs are
+var handle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.RawToString = true
+	h.SignedInteger = true
+	h.MapType = reflect.TypeOf(map[string]any(nil))
+	return h
+}()
+
+// Message is a message of the forward protocol, which carries the events of a tag in one of the
+// modes: Message, Forward, PackedForward and CompressedPackedForward
+type Message struct {
+	Tag     string
+	Entries []protocol.Document
+	Option  map[string]any
+}
+
+// Chunk returns the chunk id of the message if the client asks for an ack, otherwise empty
+func (m *Message) Chunk() string {
+	chunk, _ := m.Option[optionChunk].(string)
+	return chunk
+}
+
+// decodeMessage decodes a message from the values of the msgpack array, the time of an event
+// becomes its @timestamp unless the record has one
+func decodeMessage(values []any) (*Message, error) {
+	if len(values) < 2 {
+		return nil, errors.New("invalid forward message: too few elements")
+	}
+	m := &Message{}
+	var ok bool
+	if m.Tag, ok = values[0].(string); !ok || m.Tag == "" {
+		return nil, errors.New("invalid forward message: tag should be a string")
+	}
+	// the option is the last element of the modes
+	switch entries := values[1].(type) {
+	case []any:
+		// Forward
+		if len(values) > 2 {
+			m.Option, _ = values[2].(map[string]any)
+		}
+		for _, entry := range entries {
+			doc, err := decodeEntry(entry)
+			if err != nil {
+				return nil, err
+			}
+			m.Entries = append(m.Entries, doc)
+		}
+	case string, []byte:
+		// PackedForward and CompressedPackedForward
+		if len(values) > 2 {
+			m.Option, _ = values[2].(map[string]any)
+		}
+		stream, ok := entries.([]byte)
+		if !ok {
+			stream = []byte(entries.(string))
+		}
+		docs, err := decodeStream(stream, m.Option[optionCompressed] == compressedGzip)
+		if err != nil {
+			return nil, err
+		}
+		m.Entries = docs
+	default:
+		// Message
+		if len(values) < 3 {
+			return nil, errors.New("invalid forward message: too few elements")
+		}
+		if len(values) > 3 {
+			m.Option, _ = values[3].(map[string]any)
+		}
+		doc, err := decodeEntry([]any{values[1], values[2]})
+		if err != nil {
+			return nil, err
+		}
+		m.Entries = []protocol.Document{doc}
+	}
+	return m, nil
+}
+
+// decodeStream decodes the entries concatenated in the stream of a PackedForward message
+func decodeStream(stream []byte, compressed bool) ([]protocol.Document, error) {
+	if compressed {
+		// the stream may consist of several gzip members, which are read as a whole
+		gz, err := gzip.NewReader(bytes.NewReader(stream))
+		if err != nil {
+			return nil, fmt.Errorf("invalid forward message: %w", err)
+		}
+		defer gz.Close()
+		if stream, err = io.ReadAll(gz); err != nil {
+			return nil, fmt.Errorf("invalid forward message: %w", err)
+		}
+	}
+	decoder := codec.NewDecoderBytes(stream, handle)
+	docs := make([]protocol.Document, 0)
+	for decoder.NumBytesRead() < len(stream) {
+		var entry any
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("invalid forward message: %w", err)
+		}
+		doc, err := decodeEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// decodeEntry decodes an entry in the form of [time, record]
+func decodeEntry(entry any) (protocol.Document, error) {
+	pair, ok := entry.([]any)
+	if !ok || len(pair) != 2 {
+		return nil, errors.New("invalid forward entry: should be [time, record]")
+	}
+	record, ok := pair[1].(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid forward entry: record should be a map")
+	}
+	timestamp, err := decodeTime(pair[0])
+	if err != nil {
+		return nil, err
+	}
+	doc := protocol.Document(record)
+	for k, v := range doc {
+		doc[k] = normalize(v)
+	}
+	if _, ok := doc[consts.TimestampField]; !ok {
+		doc[consts.TimestampField] = timestamp
+	}
+	return doc, nil
+}
+
+// decodeTime decodes the time of an entry, which is either the seconds or an EventTime
+func decodeTime(value any) (time.Time, error) {
+	switch t := value.(type) {
+	case int64:
+		return time.Unix(t, 0), nil
+	case float64:
+		return time.Unix(0, int64(t*float64(time.Second))), nil
+	case codec.RawExt:
+		if t.Tag == eventTimeExt && len(t.Data) == 8 {
+			seconds := binary.BigEndian.Uint32(t.Data[:4])
+			nanos := binary.BigEndian.Uint32(t.Data[4:])
+			return time.Unix(int64(seconds), int64(nanos)), nil
+		}
+	case *codec.RawExt:
+		return decodeTime(*t)
+	}
+	return time.Time{}, fmt.Errorf("invalid forward entry: unknown time %v", value)
+}
+
+// normalize converts the binaries in the record to strings
+func normalize(value any) any {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case []any:
+		for i := range v {
+			v[i] = normalize(v[i])
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = normalize(v[k])
+		}
+	}
+	return value
+}
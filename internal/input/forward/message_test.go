@@ -0,0 +1,105 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package forward
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/ugorji/go/codec"
+)
+
+// writeHandle encodes the binaries and the EventTimes as Fluent Bit does
+var writeHandle = &codec.MsgpackHandle{WriteExt: true}
+
+func encode(t *testing.T, v any) []byte {
+	var b []byte
+	assert.NoError(t, codec.NewEncoderBytes(&b, writeHandle).Encode(v))
+	return b
+}
+
+func decode(t *testing.T, b []byte) []any {
+	var values []any
+	assert.NoError(t, codec.NewDecoderBytes(b, handle).Decode(&values))
+	return values
+}
+
+func eventTime(ts time.Time) codec.RawExt {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data[:4], uint32(ts.Unix()))
+	binary.BigEndian.PutUint32(data[4:], uint32(ts.Nanosecond()))
+	return codec.RawExt{Tag: eventTimeExt, Data: data}
+}
+
+func TestDecodeMessage(t *testing.T) {
+	ts := time.Unix(1672628645, 6)
+	expected := []protocol.Document{
+		{"@timestamp": ts, "log": "payment failed", "code": int64(500)},
+		{"@timestamp": time.Unix(1672628646, 0), "log": "payment retried", "code": int64(200)},
+	}
+	entries := []any{
+		[]any{eventTime(ts), map[string]any{"log": "payment failed", "code": uint64(500)}},
+		[]any{1672628646, map[string]any{"log": []byte("payment retried"), "code": 200}},
+	}
+	option := map[string]any{"chunk": "p8n9gmxTQVC8/nh2wlKKeQ==", "size": 2}
+
+	t.Run("test_message", func(t *testing.T) {
+		values := decode(t, encode(t, []any{"App", entries[0].([]any)[0], entries[0].([]any)[1]}))
+		m, err := decodeMessage(values)
+		assert.NoError(t, err)
+		assert.Equal(t, "App", m.Tag)
+		assert.Equal(t, expected[:1], m.Entries)
+		assert.Equal(t, "", m.Chunk())
+	})
+
+	t.Run("test_forward", func(t *testing.T) {
+		m, err := decodeMessage(decode(t, encode(t, []any{"app", entries, option})))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, m.Entries)
+		assert.Equal(t, "p8n9gmxTQVC8/nh2wlKKeQ==", m.Chunk())
+	})
+
+	t.Run("test_packed_forward", func(t *testing.T) {
+		var stream []byte
+		for _, entry := range entries {
+			stream = append(stream, encode(t, entry)...)
+		}
+		m, err := decodeMessage(decode(t, encode(t, []any{"app", stream, option})))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, m.Entries)
+
+		// each entry is compressed as a gzip member
+		var compressed bytes.Buffer
+		for _, entry := range entries {
+			gz := gzip.NewWriter(&compressed)
+			_, err = gz.Write(encode(t, entry))
+			assert.NoError(t, err)
+			assert.NoError(t, gz.Close())
+		}
+		option := map[string]any{"chunk": "abc", "compressed": "gzip"}
+		m, err = decodeMessage(decode(t, encode(t, []any{"app", compressed.Bytes(), option})))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, m.Entries)
+		assert.Equal(t, "abc", m.Chunk())
+	})
+
+	t.Run("test_invalid", func(t *testing.T) {
+		invalids := []any{
+			[]any{"app"},
+			[]any{1, entries},
+			[]any{"app", []any{[]any{"now", map[string]any{}}}},
+			[]any{"app", []any{[]any{1672628646, "record"}}},
+			[]any{"app", []byte{0x92, 0x01}},
+			[]any{"app", []byte("not gzip"), map[string]any{"compressed": "gzip"}},
+		}
+		for _, invalid := range invalids {
+			_, err := decodeMessage(decode(t, encode(t, invalid)))
+			assert.Error(t, err, invalid)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package loki decodes the requests of the Loki push API, so that the logs shipped by Promtail or
+// Grafana Agent can be ingested without changing the agents
+package loki
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+const FieldMessage = "message"
+
+// PushRequest is a batch of log streams pushed to `/loki/api/v1/push`
+type PushRequest struct {
+	Streams []*Stream `json:"streams"`
+}
+
+// Stream is a series of log entries sharing the same labels
+type Stream struct {
+	Labels  map[string]string `json:"stream"`
+	Entries []*Entry          `json:"values"`
+}
+
+// Entry is a log line, Metadata holds the structured metadata attached to the line
+type Entry struct {
+	Timestamp time.Time
+	Line      string
+	Metadata  map[string]string
+}
+
+// UnmarshalJSON decodes an entry from the JSON tuple `["<unix epoch in nanoseconds>", "<line>"]`,
+// which may be followed by an object of structured metadata
+func (e *Entry) UnmarshalJSON(b []byte) error {
+	var tuple []json.RawMessage
+	if err := json.Unmarshal(b, &tuple); err != nil {
+		return err
+	}
+	if len(tuple) < 2 || len(tuple) > 3 {
+		return fmt.Errorf("invalid entry: %s", b)
+	}
+	var ts string
+	if err := json.Unmarshal(tuple[0], &ts); err != nil {
+		return err
+	}
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %s", ts)
+	}
+	e.Timestamp = time.Unix(0, nanos)
+	if err = json.Unmarshal(tuple[1], &e.Line); err != nil {
+		return err
+	}
+	if len(tuple) == 3 {
+		return json.Unmarshal(tuple[2], &e.Metadata)
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes a request in the JSON encoding of the push API
+func UnmarshalJSON(b []byte) (*PushRequest, error) {
+	req := &PushRequest{}
+	if err := json.Unmarshal(b, req); err != nil {
+		return nil, fmt.Errorf("invalid Loki push request: %w", err)
+	}
+	return req, nil
+}
+
+// Labels returns the sorted names of the labels and the structured metadata in the request, they
+// are expected to be mapped as keywords
+func (r *PushRequest) Labels() []string {
+	set := make(map[string]struct{})
+	for _, stream := range r.Streams {
+		for name := range stream.Labels {
+			set[name] = struct{}{}
+		}
+		for _, entry := range stream.Entries {
+			for name := range entry.Metadata {
+				set[name] = struct{}{}
+			}
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Group converts the entries to documents and groups them by the indexes they are ingested into.
+// The index of a stream is the lowercased value of its indexLabel, or defaultIndex if the stream
+// does not have the label. The names of the indexes are returned in the order they first appear.
+func (r *PushRequest) Group(
+	indexLabel, defaultIndex string,
+) ([]string, map[string][]protocol.Document) {
+	names := make([]string, 0)
+	groups := make(map[string][]protocol.Document)
+	for _, stream := range r.Streams {
+		name := defaultIndex
+		if value := stream.Labels[indexLabel]; indexLabel != "" && value != "" {
+			name = strings.ToLower(value)
+		}
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		for _, entry := range stream.Entries {
+			groups[name] = append(groups[name], stream.document(entry))
+		}
+	}
+	return names, groups
+}
+
+func (s *Stream) document(entry *Entry) protocol.Document {
+	doc := make(protocol.Document, len(s.Labels)+len(entry.Metadata)+2)
+	for name, value := range s.Labels {
+		doc[name] = value
+	}
+	for name, value := range entry.Metadata {
+		doc[name] = value
+	}
+	doc[consts.TimestampField] = entry.Timestamp
+	doc[FieldMessage] = entry.Line
+	return doc
+}
+
+// parseLabels parses the labels in the Prometheus format such as `{job="app", env="prod"}`
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	rest := strings.TrimSpace(s)
+	if !strings.HasPrefix(rest, "{") || !strings.HasSuffix(rest, "}") {
+		return nil, fmt.Errorf("invalid labels: %s", s)
+	}
+	rest = strings.TrimSpace(rest[1 : len(rest)-1])
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid labels: %s", s)
+		}
+		name := strings.TrimSpace(rest[:eq])
+		rest = strings.TrimSpace(rest[eq+1:])
+		value, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid labels: %s", s)
+		}
+		rest = strings.TrimSpace(rest[len(value):])
+		if labels[name], err = strconv.Unquote(value); err != nil {
+			return nil, fmt.Errorf("invalid labels: %s", s)
+		}
+		if rest == "" {
+			break
+		}
+		if rest[0] != ',' {
+			return nil, fmt.Errorf("invalid labels: %s", s)
+		}
+		rest = strings.TrimSpace(rest[1:])
+	}
+	return labels, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package loki
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const pushJSON = `{
+  "streams": [{
+    "stream": {"job": "varlogs", "index": "Payment"},
+    "values": [
+      ["1672628645000000006", "payment failed", {"trace_id": "5b8efff7"}],
+      ["1672628646000000000", "payment retried"]
+    ]
+  }, {
+    "stream": {"job": "syslog"},
+    "values": [["1672628647000000000", "disk full"]]
+  }]
+}`
+
+func expectedGroups() map[string][]protocol.Document {
+	return map[string][]protocol.Document{
+		"payment": {
+			{
+				"job":        "varlogs",
+				"index":      "Payment",
+				"trace_id":   "5b8efff7",
+				"@timestamp": time.Unix(0, 1672628645000000006),
+				"message":    "payment failed",
+			},
+			{
+				"job":        "varlogs",
+				"index":      "Payment",
+				"@timestamp": time.Unix(0, 1672628646000000000),
+				"message":    "payment retried",
+			},
+		},
+		"loki": {
+			{
+				"job":        "syslog",
+				"@timestamp": time.Unix(0, 1672628647000000000),
+				"message":    "disk full",
+			},
+		},
+	}
+}
+
+func bytesField(b []byte, num protowire.Number, value []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+func varintField(b []byte, num protowire.Number, value uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, value)
+}
+
+func entry(seconds, nanos uint64, line string, metadata ...string) []byte {
+	timestamp := varintField(varintField(nil, 1, seconds), 2, nanos)
+	b := bytesField(nil, 1, timestamp)
+	b = bytesField(b, 2, []byte(line))
+	for i := 0; i < len(metadata); i += 2 {
+		pair := bytesField(bytesField(nil, 1, []byte(metadata[i])), 2, []byte(metadata[i+1]))
+		b = bytesField(b, 3, pair)
+	}
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	t.Run("test_json", func(t *testing.T) {
+		req, err := UnmarshalJSON([]byte(pushJSON))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"index", "job", "trace_id"}, req.Labels())
+		names, groups := req.Group("index", "loki")
+		assert.Equal(t, []string{"payment", "loki"}, names)
+		assert.Equal(t, expectedGroups(), groups)
+
+		_, err = UnmarshalJSON([]byte(`{"streams": [{"values": [["now", "line"]]}]}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("test_protobuf", func(t *testing.T) {
+		first := bytesField(nil, 1, []byte(`{job="varlogs", index="Payment"}`))
+		first = bytesField(first, 2, entry(1672628645, 6, "payment failed", "trace_id", "5b8efff7"))
+		first = bytesField(first, 2, entry(1672628646, 0, "payment retried"))
+		// the hash of the labels is skipped
+		first = varintField(first, 3, 42)
+		second := bytesField(nil, 1, []byte(`{job="syslog"}`))
+		second = bytesField(second, 2, entry(1672628647, 0, "disk full"))
+		body := bytesField(bytesField(nil, 1, first), 1, second)
+
+		req, err := UnmarshalProto(snappy.Encode(nil, body))
+		assert.NoError(t, err)
+		names, groups := req.Group("index", "loki")
+		assert.Equal(t, []string{"payment", "loki"}, names)
+		assert.Equal(t, expectedGroups(), groups)
+
+		_, err = UnmarshalProto(body)
+		assert.Error(t, err)
+		_, err = UnmarshalProto(snappy.Encode(nil, body[:len(body)-1]))
+		assert.Error(t, err)
+	})
+
+	t.Run("test_labels", func(t *testing.T) {
+		labels, err := parseLabels(`{job="a\"b", env = "prod",}`)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"job": `a"b`, "env": "prod"}, labels)
+		labels, err = parseLabels(`{}`)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{}, labels)
+		for _, invalid := range []string{`job="a"`, `{job=a}`, `{job="a" env="b"}`, `{="a"}`} {
+			_, err = parseLabels(invalid)
+			assert.Error(t, err, invalid)
+		}
+	})
+}
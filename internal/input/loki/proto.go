@@ -0,0 +1,132 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package loki
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// walk decodes the fields of a protobuf message one by one, fn is only called with the
+// length-delimited and varint fields, the values of the others are skipped
+func walk(b []byte, fn func(num protowire.Number, u uint64, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var u uint64
+		var v []byte
+		switch typ {
+		case protowire.VarintType:
+			u, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			typ = -1
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ < 0 {
+			continue
+		}
+		if err := fn(num, u, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalProto decodes a request in the snappy-compressed protobuf encoding of the push API
+func UnmarshalProto(b []byte) (*PushRequest, error) {
+	decoded, err := snappy.Decode(nil, b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Loki push request: %w", err)
+	}
+	req := &PushRequest{}
+	err = walk(decoded, func(num protowire.Number, _ uint64, v []byte) error {
+		if num == 1 && v != nil {
+			stream, err := decodeStream(v)
+			if err != nil {
+				return err
+			}
+			req.Streams = append(req.Streams, stream)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Loki push request: %w", err)
+	}
+	return req, nil
+}
+
+func decodeStream(b []byte) (*Stream, error) {
+	stream := &Stream{Labels: map[string]string{}}
+	err := walk(b, func(num protowire.Number, _ uint64, v []byte) error {
+		switch num {
+		case 1:
+			labels, err := parseLabels(string(v))
+			if err != nil {
+				return err
+			}
+			stream.Labels = labels
+		case 2:
+			entry, err := decodeEntry(v)
+			if err != nil {
+				return err
+			}
+			stream.Entries = append(stream.Entries, entry)
+		}
+		return nil
+	})
+	return stream, err
+}
+
+func decodeEntry(b []byte) (*Entry, error) {
+	entry := &Entry{}
+	var seconds, nanos int64
+	err := walk(b, func(num protowire.Number, _ uint64, v []byte) error {
+		switch num {
+		case 1:
+			return walk(v, func(num protowire.Number, u uint64, _ []byte) error {
+				switch num {
+				case 1:
+					seconds = int64(u)
+				case 2:
+					nanos = int64(int32(u))
+				}
+				return nil
+			})
+		case 2:
+			entry.Line = string(v)
+		case 3:
+			var name, value string
+			err := walk(v, func(num protowire.Number, _ uint64, v []byte) error {
+				switch num {
+				case 1:
+					name = string(v)
+				case 2:
+					value = string(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if entry.Metadata == nil {
+				entry.Metadata = make(map[string]string)
+			}
+			entry.Metadata[name] = value
+		}
+		return nil
+	})
+	entry.Timestamp = time.Unix(seconds, nanos)
+	return entry, err
+}
@@ -0,0 +1,257 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package otlp decodes the OpenTelemetry logs exported over OTLP/HTTP into documents
+package otlp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+// the fields of the documents decoded from log records
+const (
+	FieldMessage        = "message"
+	FieldBody           = "body"
+	FieldSeverityText   = "severity_text"
+	FieldSeverityNumber = "severity_number"
+	FieldTraceID        = "trace_id"
+	FieldSpanID         = "span_id"
+	FieldFlags          = "flags"
+	FieldScopeName      = "scope.name"
+	FieldScopeVersion   = "scope.version"
+	// the prefixes of the flattened attributes
+	PrefixResource   = "resource."
+	PrefixScope      = "scope."
+	PrefixAttributes = "attributes."
+)
+
+// LogsRequest is the ExportLogsServiceRequest, the JSON tags follow the JSON encoding of OTLP
+type LogsRequest struct {
+	ResourceLogs []*ResourceLogs `json:"resourceLogs"`
+}
+
+type ResourceLogs struct {
+	Resource  *Resource    `json:"resource"`
+	ScopeLogs []*ScopeLogs `json:"scopeLogs"`
+}
+
+type Resource struct {
+	Attributes []*KeyValue `json:"attributes"`
+}
+
+type ScopeLogs struct {
+	Scope      *Scope       `json:"scope"`
+	LogRecords []*LogRecord `json:"logRecords"`
+}
+
+type Scope struct {
+	Name       string      `json:"name"`
+	Version    string      `json:"version"`
+	Attributes []*KeyValue `json:"attributes"`
+}
+
+type LogRecord struct {
+	TimeUnixNano         Uint64      `json:"timeUnixNano"`
+	ObservedTimeUnixNano Uint64      `json:"observedTimeUnixNano"`
+	SeverityNumber       int32       `json:"severityNumber"`
+	SeverityText         string      `json:"severityText"`
+	Body                 *AnyValue   `json:"body"`
+	Attributes           []*KeyValue `json:"attributes"`
+	Flags                uint32      `json:"flags"`
+	TraceID              HexBytes    `json:"traceId"`
+	SpanID               HexBytes    `json:"spanId"`
+}
+
+type KeyValue struct {
+	Key   string    `json:"key"`
+	Value *AnyValue `json:"value"`
+}
+
+// AnyValue holds one of the values
+type AnyValue struct {
+	StringValue *string       `json:"stringValue,omitempty"`
+	BoolValue   *bool         `json:"boolValue,omitempty"`
+	IntValue    *Int64        `json:"intValue,omitempty"`
+	DoubleValue *float64      `json:"doubleValue,omitempty"`
+	ArrayValue  *ArrayValue   `json:"arrayValue,omitempty"`
+	KvlistValue *KeyValueList `json:"kvlistValue,omitempty"`
+	BytesValue  []byte        `json:"bytesValue,omitempty"`
+}
+
+type ArrayValue struct {
+	Values []*AnyValue `json:"values"`
+}
+
+type KeyValueList struct {
+	Values []*KeyValue `json:"values"`
+}
+
+// Int64 is encoded as a decimal string or a number in JSON
+type Int64 int64
+
+// Uint64 is encoded as a decimal string or a number in JSON
+type Uint64 uint64
+
+// HexBytes is encoded as a hex string in JSON, such as trace ids and span ids
+type HexBytes []byte
+
+func (i *Int64) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseInt(unquote(data), 10, 64)
+	*i = Int64(n)
+	return err
+}
+
+func (u *Uint64) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseUint(unquote(data), 10, 64)
+	*u = Uint64(n)
+	return err
+}
+
+func (h *HexBytes) UnmarshalJSON(data []byte) error {
+	b, err := hex.DecodeString(unquote(data))
+	*h = b
+	return err
+}
+
+func unquote(data []byte) string {
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		return string(data[1 : len(data)-1])
+	}
+	return string(data)
+}
+
+// UnmarshalJSON decodes a request in the JSON encoding of OTLP
+func UnmarshalJSON(data []byte) (*LogsRequest, error) {
+	req := &LogsRequest{}
+	if err := json.Unmarshal(data, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Documents flattens the log records into documents. The attributes of the resource, the scope
+// and the record are prefixed with PrefixResource, PrefixScope and PrefixAttributes, nested
+// key-value lists are flattened by dotted keys.
+// @timestamp is the time of the record, or the observed time if it is unknown, or now at last.
+func (r *LogsRequest) Documents(now time.Time) []protocol.Document {
+	docs := make([]protocol.Document, 0)
+	for _, rl := range r.ResourceLogs {
+		if rl == nil {
+			continue
+		}
+		for _, sl := range rl.ScopeLogs {
+			if sl == nil {
+				continue
+			}
+			for _, record := range sl.LogRecords {
+				if record == nil {
+					continue
+				}
+				doc := protocol.Document{}
+				if rl.Resource != nil {
+					flatten(PrefixResource, rl.Resource.Attributes, doc)
+				}
+				if sl.Scope != nil {
+					if sl.Scope.Name != "" {
+						doc[FieldScopeName] = sl.Scope.Name
+					}
+					if sl.Scope.Version != "" {
+						doc[FieldScopeVersion] = sl.Scope.Version
+					}
+					flatten(PrefixScope, sl.Scope.Attributes, doc)
+				}
+				record.fill(doc, now)
+				docs = append(docs, doc)
+			}
+		}
+	}
+	return docs
+}
+
+func (record *LogRecord) fill(doc protocol.Document, now time.Time) {
+	switch {
+	case record.TimeUnixNano != 0:
+		doc[consts.TimestampField] = time.Unix(0, int64(record.TimeUnixNano))
+	case record.ObservedTimeUnixNano != 0:
+		doc[consts.TimestampField] = time.Unix(0, int64(record.ObservedTimeUnixNano))
+	default:
+		doc[consts.TimestampField] = now
+	}
+	if record.SeverityText != "" {
+		doc[FieldSeverityText] = record.SeverityText
+	}
+	if record.SeverityNumber != 0 {
+		doc[FieldSeverityNumber] = int64(record.SeverityNumber)
+	}
+	if body := record.Body; body != nil {
+		if body.KvlistValue != nil {
+			flatten(FieldBody+".", body.KvlistValue.Values, doc)
+		} else if value := body.value(); value != nil {
+			doc[FieldMessage] = value
+		}
+	}
+	flatten(PrefixAttributes, record.Attributes, doc)
+	if len(record.TraceID) > 0 {
+		doc[FieldTraceID] = hex.EncodeToString(record.TraceID)
+	}
+	if len(record.SpanID) > 0 {
+		doc[FieldSpanID] = hex.EncodeToString(record.SpanID)
+	}
+	if record.Flags != 0 {
+		doc[FieldFlags] = int64(record.Flags)
+	}
+}
+
+func flatten(prefix string, kvs []*KeyValue, doc protocol.Document) {
+	for _, kv := range kvs {
+		if kv == nil || kv.Value == nil {
+			continue
+		}
+		if kv.Value.KvlistValue != nil {
+			flatten(prefix+kv.Key+".", kv.Value.KvlistValue.Values, doc)
+		} else if value := kv.Value.value(); value != nil {
+			doc[prefix+kv.Key] = value
+		}
+	}
+}
+
+func (v *AnyValue) value() any {
+	switch {
+	case v == nil:
+		return nil
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return int64(*v.IntValue)
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.ArrayValue != nil:
+		values := make([]any, 0, len(v.ArrayValue.Values))
+		for _, value := range v.ArrayValue.Values {
+			if value != nil && value.KvlistValue != nil {
+				m := make(map[string]any)
+				flatten("", value.KvlistValue.Values, m)
+				values = append(values, m)
+			} else if value := value.value(); value != nil {
+				values = append(values, value)
+			}
+		}
+		return values
+	case v.KvlistValue != nil:
+		m := make(map[string]any)
+		flatten("", v.KvlistValue.Values, m)
+		return m
+	case v.BytesValue != nil:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	default:
+		return nil
+	}
+}
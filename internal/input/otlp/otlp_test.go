@@ -0,0 +1,170 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package otlp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const logsJSON = `{
+  "resourceLogs": [{
+    "resource": {"attributes": [
+      {"key": "service.name", "value": {"stringValue": "checkout"}},
+      {"key": "host", "value": {"kvlistValue": {"values": [
+        {"key": "name", "value": {"stringValue": "node-1"}}
+      ]}}}
+    ]},
+    "scopeLogs": [{
+      "scope": {"name": "logger", "version": "1.0.0"},
+      "logRecords": [{
+        "timeUnixNano": "1672628645000000006",
+        "severityNumber": 17,
+        "severityText": "ERROR",
+        "body": {"stringValue": "payment failed"},
+        "attributes": [
+          {"key": "retries", "value": {"intValue": "3"}},
+          {"key": "ratio", "value": {"doubleValue": 0.5}},
+          {"key": "tags", "value": {"arrayValue": {"values": [{"stringValue": "a"}, {"boolValue": true}]}}}
+        ],
+        "traceId": "5b8efff798038103d269b633813fc60c",
+        "spanId": "eee19b7ec3c1b174"
+      }, {
+        "observedTimeUnixNano": 1672628645000000000,
+        "body": {"kvlistValue": {"values": [{"key": "event", "value": {"stringValue": "login"}}]}}
+      }]
+    }]
+  }]
+}`
+
+func expectedDocs() []protocol.Document {
+	resource := protocol.Document{
+		"resource.service.name": "checkout",
+		"resource.host.name":    "node-1",
+		"scope.name":            "logger",
+		"scope.version":         "1.0.0",
+	}
+	first := protocol.Document{
+		"@timestamp":         time.Unix(0, 1672628645000000006),
+		"severity_number":    int64(17),
+		"severity_text":      "ERROR",
+		"message":            "payment failed",
+		"attributes.retries": int64(3),
+		"attributes.ratio":   0.5,
+		"attributes.tags":    []any{"a", true},
+		"trace_id":           "5b8efff798038103d269b633813fc60c",
+		"span_id":            "eee19b7ec3c1b174",
+	}
+	second := protocol.Document{
+		"@timestamp": time.Unix(0, 1672628645000000000),
+		"body.event": "login",
+	}
+	for k, v := range resource {
+		first[k] = v
+		second[k] = v
+	}
+	return []protocol.Document{first, second}
+}
+
+func message(fields ...func([]byte) []byte) []byte {
+	var b []byte
+	for _, f := range fields {
+		b = f(b)
+	}
+	return b
+}
+
+func bytesField(num protowire.Number, value []byte) func([]byte) []byte {
+	return func(b []byte) []byte {
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, value)
+	}
+}
+
+func stringField(num protowire.Number, value string) func([]byte) []byte {
+	return bytesField(num, []byte(value))
+}
+
+func varintField(num protowire.Number, value uint64) func([]byte) []byte {
+	return func(b []byte) []byte {
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, value)
+	}
+}
+
+func fixed64Field(num protowire.Number, value uint64) func([]byte) []byte {
+	return func(b []byte) []byte {
+		b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, value)
+	}
+}
+
+func keyValue(num protowire.Number, key string, value []byte) func([]byte) []byte {
+	return bytesField(num, message(stringField(1, key), bytesField(2, value)))
+}
+
+func TestDecode(t *testing.T) {
+	now := time.Now()
+
+	t.Run("test_json", func(t *testing.T) {
+		req, err := UnmarshalJSON([]byte(logsJSON))
+		assert.NoError(t, err)
+		assert.Equal(t, expectedDocs(), req.Documents(now))
+	})
+
+	t.Run("test_protobuf", func(t *testing.T) {
+		traceID := []byte{
+			0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03,
+			0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c,
+		}
+		spanID := []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74}
+		resource := message(
+			keyValue(1, "service.name", message(stringField(1, "checkout"))),
+			keyValue(1, "host", message(bytesField(6, message(
+				keyValue(1, "name", message(stringField(1, "node-1"))),
+			)))),
+		)
+		first := message(
+			fixed64Field(1, 1672628645000000006),
+			varintField(2, 17),
+			stringField(3, "ERROR"),
+			bytesField(5, message(stringField(1, "payment failed"))),
+			keyValue(6, "retries", message(varintField(3, 3))),
+			keyValue(6, "ratio", message(fixed64Field(4, math.Float64bits(0.5)))),
+			keyValue(6, "tags", message(bytesField(5, message(
+				bytesField(1, message(stringField(1, "a"))),
+				bytesField(1, message(varintField(2, 1))),
+			)))),
+			bytesField(9, traceID),
+			bytesField(10, spanID),
+			// an unknown field is skipped
+			stringField(100, "unknown"),
+		)
+		second := message(
+			fixed64Field(11, 1672628645000000000),
+			bytesField(5, message(bytesField(6, message(
+				keyValue(1, "event", message(stringField(1, "login"))),
+			)))),
+		)
+		scopeLogs := message(
+			bytesField(1, message(stringField(1, "logger"), stringField(2, "1.0.0"))),
+			bytesField(2, first),
+			bytesField(2, second),
+		)
+		body := message(bytesField(1, message(
+			bytesField(1, resource),
+			bytesField(2, scopeLogs),
+		)))
+		req, err := UnmarshalProto(body)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedDocs(), req.Documents(now))
+
+		_, err = UnmarshalProto(body[:len(body)-1])
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,208 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package otlp
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// field is a decoded field of a protobuf message, u holds the scalars and b holds the
+// length-delimited values
+type field struct {
+	typ protowire.Type
+	u   uint64
+	b   []byte
+}
+
+// walk decodes the fields of a protobuf message one by one, the unknown fields are expected to be
+// skipped by fn
+func walk(b []byte, fn func(num protowire.Number, f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		f := field{typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.u, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.u, n = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var u uint32
+			u, n = protowire.ConsumeFixed32(b)
+			f.u = uint64(u)
+		case protowire.BytesType:
+			f.b, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalProto decodes a request in the protobuf encoding of OTLP
+func UnmarshalProto(b []byte) (*LogsRequest, error) {
+	req := &LogsRequest{}
+	err := walk(b, func(num protowire.Number, f field) error {
+		if num == 1 && f.typ == protowire.BytesType {
+			rl, err := decodeResourceLogs(f.b)
+			if err != nil {
+				return err
+			}
+			req.ResourceLogs = append(req.ResourceLogs, rl)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP logs request: %w", err)
+	}
+	return req, nil
+}
+
+func decodeResourceLogs(b []byte) (*ResourceLogs, error) {
+	rl := &ResourceLogs{}
+	return rl, walk(b, func(num protowire.Number, f field) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			rl.Resource = &Resource{}
+			return walk(f.b, func(num protowire.Number, f field) error {
+				return appendKeyValue(&rl.Resource.Attributes, num == 1, f)
+			})
+		case 2:
+			sl, err := decodeScopeLogs(f.b)
+			rl.ScopeLogs = append(rl.ScopeLogs, sl)
+			return err
+		}
+		return nil
+	})
+}
+
+func decodeScopeLogs(b []byte) (*ScopeLogs, error) {
+	sl := &ScopeLogs{}
+	return sl, walk(b, func(num protowire.Number, f field) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			sl.Scope = &Scope{}
+			return walk(f.b, func(num protowire.Number, f field) error {
+				switch {
+				case num == 1 && f.typ == protowire.BytesType:
+					sl.Scope.Name = string(f.b)
+				case num == 2 && f.typ == protowire.BytesType:
+					sl.Scope.Version = string(f.b)
+				default:
+					return appendKeyValue(&sl.Scope.Attributes, num == 3, f)
+				}
+				return nil
+			})
+		case 2:
+			record, err := decodeLogRecord(f.b)
+			sl.LogRecords = append(sl.LogRecords, record)
+			return err
+		}
+		return nil
+	})
+}
+
+func decodeLogRecord(b []byte) (*LogRecord, error) {
+	record := &LogRecord{}
+	return record, walk(b, func(num protowire.Number, f field) error {
+		var err error
+		switch {
+		case num == 1 && f.typ == protowire.Fixed64Type:
+			record.TimeUnixNano = Uint64(f.u)
+		case num == 11 && f.typ == protowire.Fixed64Type:
+			record.ObservedTimeUnixNano = Uint64(f.u)
+		case num == 2 && f.typ == protowire.VarintType:
+			record.SeverityNumber = int32(f.u)
+		case num == 3 && f.typ == protowire.BytesType:
+			record.SeverityText = string(f.b)
+		case num == 5 && f.typ == protowire.BytesType:
+			record.Body, err = decodeAnyValue(f.b)
+		case num == 8 && f.typ == protowire.Fixed32Type:
+			record.Flags = uint32(f.u)
+		case num == 9 && f.typ == protowire.BytesType:
+			record.TraceID = f.b
+		case num == 10 && f.typ == protowire.BytesType:
+			record.SpanID = f.b
+		default:
+			err = appendKeyValue(&record.Attributes, num == 6, f)
+		}
+		return err
+	})
+}
+
+// appendKeyValue appends the field to kvs if it is a KeyValue
+func appendKeyValue(kvs *[]*KeyValue, isKeyValue bool, f field) error {
+	if !isKeyValue || f.typ != protowire.BytesType {
+		return nil
+	}
+	kv := &KeyValue{}
+	err := walk(f.b, func(num protowire.Number, f field) error {
+		var err error
+		switch {
+		case num == 1 && f.typ == protowire.BytesType:
+			kv.Key = string(f.b)
+		case num == 2 && f.typ == protowire.BytesType:
+			kv.Value, err = decodeAnyValue(f.b)
+		}
+		return err
+	})
+	*kvs = append(*kvs, kv)
+	return err
+}
+
+func decodeAnyValue(b []byte) (*AnyValue, error) {
+	v := &AnyValue{}
+	return v, walk(b, func(num protowire.Number, f field) error {
+		switch {
+		case num == 1 && f.typ == protowire.BytesType:
+			s := string(f.b)
+			v.StringValue = &s
+		case num == 2 && f.typ == protowire.VarintType:
+			b := f.u != 0
+			v.BoolValue = &b
+		case num == 3 && f.typ == protowire.VarintType:
+			i := Int64(f.u)
+			v.IntValue = &i
+		case num == 4 && f.typ == protowire.Fixed64Type:
+			d := math.Float64frombits(f.u)
+			v.DoubleValue = &d
+		case num == 5 && f.typ == protowire.BytesType:
+			v.ArrayValue = &ArrayValue{}
+			return walk(f.b, func(num protowire.Number, f field) error {
+				if num != 1 || f.typ != protowire.BytesType {
+					return nil
+				}
+				value, err := decodeAnyValue(f.b)
+				v.ArrayValue.Values = append(v.ArrayValue.Values, value)
+				return err
+			})
+		case num == 6 && f.typ == protowire.BytesType:
+			v.KvlistValue = &KeyValueList{}
+			return walk(f.b, func(num protowire.Number, f field) error {
+				return appendKeyValue(&v.KvlistValue.Values, num == 1, f)
+			})
+		case num == 7 && f.typ == protowire.BytesType:
+			v.BytesValue = f.b
+		}
+		return nil
+	})
+}
@@ -0,0 +1,253 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package input
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/ingestion"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"go.uber.org/zap"
+)
+
+// Sink batches the documents received by an input and ingests them into their target indexes.
+// Add blocks while the sink is retrying the documents not accepted by the target index, so that
+// the input reading from a stream is slowed down rather than losing documents.
+type Sink struct {
+	name          string
+	target        *Target
+	batchSize     int
+	flushInterval time.Duration
+	docs          chan protocol.Document
+	stop          chan struct{}
+	done          chan struct{}
+}
+
+// NewSink creates a sink for the input and starts it, the sink should be closed after the input
+// stops adding documents
+func NewSink(name, index string, batchSize int, flushInterval time.Duration) *Sink {
+	s := &Sink{
+		name:          name,
+		target:        NewTarget(index),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		docs:          make(chan protocol.Document, batchSize),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Add hands the document over to the sink to be ingested
+func (s *Sink) Add(doc protocol.Document) {
+	select {
+	case s.docs <- doc:
+	case <-s.stop:
+	}
+}
+
+// Close flushes the pending documents and stops the sink
+func (s *Sink) Close() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *Sink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	batch := make([]protocol.Document, 0, s.batchSize)
+	for {
+		select {
+		case doc := <-s.docs:
+			batch = append(batch, doc)
+			if len(batch) < s.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-s.stop:
+			// drain what has been added
+			for len(s.docs) > 0 {
+				batch = append(batch, <-s.docs)
+			}
+			s.flush(batch)
+			return
+		}
+		s.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush groups the documents by their target indexes and ingests each group, the documents not
+// accepted yet are discarded only if the sink is closed in the meantime
+func (s *Sink) flush(batch []protocol.Document) {
+	if len(batch) == 0 {
+		return
+	}
+	names, groups := s.target.Group(batch)
+	for _, name := range names {
+		docs := groups[name]
+		if err := IngestBlocking(name, docs, s.stop); err != nil {
+			logger.Error(
+				"input closed before the documents are ingested, they are discarded",
+				zap.String("input", s.name),
+				zap.String("index", name),
+				zap.Int("docs", len(docs)),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// maxRetryInterval caps the backoff between the retries of the documents not accepted
+const maxRetryInterval = time.Minute
+
+// IngestBlocking ingests the documents into the index like Ingest, but each document is accepted
+// or rejected on its own. The documents rejected because of their contents are written into the
+// dead-letter index if the index enables it, or discarded otherwise. The others not accepted,
+// e.g. the ones routed to the shards whose WAL lags too much, are retried with backoff until they
+// are accepted, an error is returned only if stop is closed before that.
+func IngestBlocking(name string, docs []protocol.Document, stop <-chan struct{}) error {
+	backoff := config.Cfg.Wal.RetryAfter
+	for {
+		var err error
+		if docs, err = ingestAccepted(name, docs); err == nil {
+			return nil
+		}
+		logger.Warn(
+			"input ingest failed, retry later",
+			zap.String("index", name),
+			zap.Int("docs", len(docs)),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+		select {
+		case <-time.After(backoff):
+		case <-stop:
+			return err
+		}
+		if backoff *= 2; backoff > maxRetryInterval {
+			backoff = maxRetryInterval
+		}
+	}
+}
+
+// ingestAccepted ingests the documents as creations one by one, and returns the documents to be
+// retried along with the error rejecting them
+func ingestAccepted(name string, docs []protocol.Document) ([]protocol.Document, error) {
+	index, err := getOrCreateIndex(name)
+	if err != nil {
+		return docs, err
+	}
+	stampEventTime(index, docs)
+	ops := make([]*protocol.Operation, len(docs))
+	for i, doc := range docs {
+		ops[i] = &protocol.Operation{Action: consts.ActionCreate, Document: doc}
+	}
+	results, err := ingestion.IngestOperations(index, ops)
+	if err != nil {
+		return docs, err
+	}
+	retries := make([]protocol.Document, 0)
+	var retryErr, rejection error
+	rejected := 0
+	for i, result := range results {
+		switch {
+		case result.Err == nil:
+		case errs.IsRejection(result.Err) ||
+			errs.IsDocumentConflict(result.Err) ||
+			errs.IsProcessorError(result.Err):
+			// retrying the documents never makes them accepted
+			if !result.DeadLettered {
+				rejected++
+				rejection = result.Err
+			}
+		default:
+			retries = append(retries, docs[i])
+			retryErr = result.Err
+		}
+	}
+	if rejected > 0 {
+		logger.Error(
+			"input documents are rejected and discarded",
+			zap.String("index", name),
+			zap.Int("docs", rejected),
+			zap.Error(rejection),
+		)
+	}
+	return retries, retryErr
+}
+
+// Ingest ingests the documents into the index by its default pipeline, the index is created if
+// it does not exist.
+// The keywords are mapped as keyword fields if they are not mapped yet and the index maps new
+// fields dynamically, rather than being deduced as text.
+func Ingest(name string, docs []protocol.Document, keywords ...string) error {
+	index, err := getOrCreateIndex(name)
+	if err != nil {
+		return err
+	}
+	mapKeywords(index, keywords)
+	stampEventTime(index, docs)
+	_, err = ingestion.IngestDocs(index, docs, "")
+	return err
+}
+
+// getOrCreateIndex returns the index, the index is created if it does not exist
+func getOrCreateIndex(name string) (*core.Index, error) {
+	index, err := metadata.ResolveWriteIndex(name)
+	if err != nil {
+		if !errs.IsIndexNotFound(err) {
+			return nil, err
+		}
+		index = &core.Index{Index: &protocol.Index{Name: name}}
+		if err = metadata.CreateIndex(index); err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+// stampEventTime moves the event time stamped by the inputs into the event-time field configured
+// by the index, the documents carrying the field on their own are kept as they are
+func stampEventTime(index *core.Index, docs []protocol.Document) {
+	field := index.Mappings.TimestampField()
+	if field == consts.TimestampField {
+		return
+	}
+	for _, doc := range docs {
+		timestamp, ok := doc[consts.TimestampField]
+		if !ok {
+			continue
+		}
+		delete(doc, consts.TimestampField)
+		if _, exists := doc.Get(field); !exists {
+			doc.Set(field, timestamp)
+		}
+	}
+}
+
+func mapKeywords(index *core.Index, keywords []string) {
+	mappings := index.Mappings
+	if mappings == nil || !strings.EqualFold(mappings.Dynamic, consts.DynamicMappingMode) {
+		return
+	}
+	properties := make(map[string]*protocol.Property)
+	for _, keyword := range keywords {
+		if _, ok := mappings.GetProperty(keyword); !ok {
+			properties[keyword] = &protocol.Property{
+				Type:    consts.MappingFieldTypeKeyword,
+				Dynamic: consts.DynamicMappingMode,
+			}
+		}
+	}
+	index.AddProperties(properties)
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package input
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/tatris-io/tatris/internal/query"
+)
+
+func TestIngestBlocking(t *testing.T) {
+	name := "sink_" + strings.ReplaceAll(
+		time.Now().Format(consts.TimeFmtWithoutSeparator),
+		consts.Dot,
+		consts.Empty,
+	)
+	index := &core.Index{Index: &protocol.Index{
+		Name: name,
+		Mappings: &protocol.Mappings{
+			Dynamic: consts.StrictMappingMode,
+			Properties: map[string]*protocol.Property{
+				"name": {Type: consts.MappingFieldTypeKeyword},
+			},
+		},
+	}}
+	assert.NoError(t, metadata.CreateIndex(index))
+	stop := make(chan struct{})
+	close(stop)
+
+	// the invalid document does not take the valid ones down with it
+	assert.NoError(t, IngestBlocking(name, []protocol.Document{
+		{"name": "tatris"},
+		{"name": "tatris", "lang": "Go"},
+		{"name": "bluge"},
+	}, stop))
+	assert.Eventually(t, func() bool {
+		resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+			Index: name,
+			Query: protocol.Query{MatchAll: &protocol.MatchAll{}},
+			Size:  0,
+		})
+		return err == nil && resp.Hits.Total.Value == 2
+	}, 10*time.Second, 100*time.Millisecond)
+
+	// the documents rejected by the lagging WAL are retried until the input stops
+	maxLagBytes := config.Cfg.Wal.MaxLagBytes
+	config.Cfg.Wal.MaxLagBytes = 1
+	defer func() { config.Cfg.Wal.MaxLagBytes = maxLagBytes }()
+	assert.Eventually(t, func() bool {
+		err := IngestBlocking(name, []protocol.Document{{"name": "bleve"}}, stop)
+		return errs.IsWalLagExceed(err)
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestStampEventTime(t *testing.T) {
+	name := "sink_time_" + strings.ReplaceAll(
+		time.Now().Format(consts.TimeFmtWithoutSeparator),
+		consts.Dot,
+		consts.Empty,
+	)
+	index := &core.Index{Index: &protocol.Index{
+		Name:     name,
+		Mappings: &protocol.Mappings{Timestamp: &protocol.Timestamp{Field: "event.time"}},
+	}}
+	assert.NoError(t, metadata.CreateIndex(index))
+	stop := make(chan struct{})
+	close(stop)
+
+	// the event time stamped by the input goes to the event-time field of the index
+	eventTime := time.Now().Add(-time.Hour)
+	assert.NoError(t, IngestBlocking(name, []protocol.Document{
+		{"name": "tatris", consts.TimestampField: eventTime},
+	}, stop))
+	assert.Eventually(t, func() bool {
+		resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+			Index: name,
+			Query: protocol.Query{MatchAll: &protocol.MatchAll{}},
+			Size:  1,
+		})
+		if err != nil || resp.Hits.Total.Value != 1 {
+			return false
+		}
+		if _, stamped := resp.Hits.Hits[0].Source[consts.TimestampField]; stamped {
+			return false
+		}
+		for _, shard := range index.GetShards() {
+			if shard.Stat.MinTime == eventTime.UnixMilli() {
+				return true
+			}
+		}
+		return false
+	}, 10*time.Second, 100*time.Millisecond)
+}
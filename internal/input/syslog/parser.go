@@ -0,0 +1,196 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package syslog
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+// the fields of the documents parsed from syslog messages
+const (
+	FieldHost           = "host"
+	FieldApp            = "app"
+	FieldSeverity       = "severity"
+	FieldFacility       = "facility"
+	FieldMessage        = "message"
+	FieldProcID         = "procid"
+	FieldMsgID          = "msgid"
+	FieldStructuredData = "structured_data"
+)
+
+// nilValue is the NILVALUE of RFC 5424
+const nilValue = "-"
+
+var severities = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+var facilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var errInvalidPriority = errors.New("invalid syslog priority")
+
+// Parse parses a syslog message of RFC 5424 or RFC 3164 into a document, messages without a
+// valid priority are rejected. now is the time used when the message does not carry one, and its
+// year and location complete the timestamps of RFC 3164.
+func Parse(frame []byte, now time.Time) (protocol.Document, error) {
+	msg := strings.TrimRight(string(frame), "\r\n\x00")
+	if len(msg) < 3 || msg[0] != '<' {
+		return nil, errInvalidPriority
+	}
+	end := strings.IndexByte(msg, '>')
+	if end < 2 || end > 4 {
+		return nil, errInvalidPriority
+	}
+	priority, err := strconv.Atoi(msg[1:end])
+	if err != nil || priority < 0 || priority > 191 {
+		return nil, errInvalidPriority
+	}
+	doc := protocol.Document{
+		FieldSeverity: severities[priority%8],
+		FieldFacility: facilities[priority/8],
+	}
+	msg = msg[end+1:]
+	if strings.HasPrefix(msg, "1 ") {
+		err = parse5424(msg[2:], doc)
+	} else {
+		parse3164(msg, doc, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := doc[consts.TimestampField]; !ok {
+		doc[consts.TimestampField] = now
+	}
+	return doc, nil
+}
+
+// parse5424 parses `TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]`
+func parse5424(msg string, doc protocol.Document) error {
+	headers := make([]string, 5)
+	for i := range headers {
+		var ok bool
+		if headers[i], msg, ok = strings.Cut(msg, " "); !ok && i < len(headers)-1 {
+			return fmt.Errorf("incomplete RFC 5424 header")
+		}
+	}
+	if headers[0] != nilValue {
+		timestamp, err := time.Parse(time.RFC3339Nano, headers[0])
+		if err != nil {
+			return fmt.Errorf("invalid RFC 5424 timestamp %s", headers[0])
+		}
+		doc[consts.TimestampField] = timestamp
+	}
+	for i, field := range []string{FieldHost, FieldApp, FieldProcID, FieldMsgID} {
+		if value := headers[i+1]; value != nilValue {
+			doc[field] = value
+		}
+	}
+	sd, msg, err := parseStructuredData(msg)
+	if err != nil {
+		return err
+	}
+	if len(sd) > 0 {
+		doc[FieldStructuredData] = sd
+	}
+	// a message may start with the UTF-8 BOM
+	doc[FieldMessage] = strings.TrimPrefix(strings.TrimPrefix(msg, " "), "\ufeff")
+	return nil
+}
+
+// parseStructuredData parses `-` or `[id key="value" ...]...` at the beginning of msg, and returns
+// the parsed elements keyed by their ids along with the rest of msg
+func parseStructuredData(msg string) (map[string]any, string, error) {
+	if strings.HasPrefix(msg, nilValue) {
+		return nil, msg[len(nilValue):], nil
+	}
+	sd := make(map[string]any)
+	for strings.HasPrefix(msg, "[") {
+		i := 1
+		for i < len(msg) && msg[i] != ' ' && msg[i] != ']' {
+			i++
+		}
+		id := msg[1:i]
+		params := make(map[string]any)
+		for i < len(msg) && msg[i] == ' ' {
+			eq := strings.IndexByte(msg[i:], '=')
+			if eq < 0 || i+eq+1 >= len(msg) || msg[i+eq+1] != '"' {
+				return nil, "", fmt.Errorf("invalid RFC 5424 structured data")
+			}
+			name := msg[i+1 : i+eq]
+			var value strings.Builder
+			j := i + eq + 2
+			for ; j < len(msg) && msg[j] != '"'; j++ {
+				// `"`, `\` and `]` are escaped by `\`
+				if msg[j] == '\\' && j+1 < len(msg) && strings.IndexByte(`"\]`, msg[j+1]) >= 0 {
+					j++
+				}
+				value.WriteByte(msg[j])
+			}
+			if j >= len(msg) {
+				return nil, "", fmt.Errorf("invalid RFC 5424 structured data")
+			}
+			params[name] = value.String()
+			i = j + 1
+		}
+		if i >= len(msg) || msg[i] != ']' {
+			return nil, "", fmt.Errorf("invalid RFC 5424 structured data")
+		}
+		sd[id] = params
+		msg = msg[i+1:]
+	}
+	return sd, msg, nil
+}
+
+// parse3164 parses `TIMESTAMP HOSTNAME TAG[PID]: MSG` leniently, the parts that can not be
+// recognized are left in the message
+func parse3164(msg string, doc protocol.Document, now time.Time) {
+	// Mmm dd hh:mm:ss, the day is padded by a space if it is less than 10
+	const layout = "Jan _2 15:04:05"
+	if len(msg) >= len(layout) {
+		if t, err := time.ParseInLocation(layout, msg[:len(layout)], now.Location()); err == nil {
+			t = t.AddDate(now.Year(), 0, 0)
+			// a message of December received in January is of the last year
+			if t.After(now.AddDate(0, 1, 0)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			doc[consts.TimestampField] = t
+			msg = strings.TrimPrefix(msg[len(layout):], " ")
+			if host, rest, ok := strings.Cut(msg, " "); ok && !strings.HasSuffix(host, ":") {
+				doc[FieldHost] = host
+				msg = rest
+			}
+		}
+	}
+	// TAG is up to 32 alphanumeric characters, terminated by `[`, `:` or a space
+	i := 0
+	for i < len(msg) && i <= 32 && msg[i] != '[' && msg[i] != ':' && msg[i] != ' ' {
+		i++
+	}
+	if i > 0 && i < len(msg) && (msg[i] == '[' || msg[i] == ':') {
+		app, rest := msg[:i], msg[i:]
+		if strings.HasPrefix(rest, "[") {
+			if end := strings.Index(rest, "]"); end > 0 {
+				doc[FieldProcID] = rest[1:end]
+				rest = rest[end+1:]
+			}
+		}
+		if strings.HasPrefix(rest, ":") {
+			doc[FieldApp] = app
+			msg = strings.TrimPrefix(rest[1:], " ")
+		} else {
+			delete(doc, FieldProcID)
+		}
+	}
+	doc[FieldMessage] = msg
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package syslog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name  string
+		frame string
+		doc   protocol.Document
+	}{
+		{
+			name: "rfc5424",
+			frame: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 ` +
+				`[exampleSDID@32473 iut="3" eventSource="Appli\"cation"][origin ip="10.0.0.1"] ` +
+				"\ufeffAn application event log entry...\n",
+			doc: protocol.Document{
+				"@timestamp": time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				"host":       "mymachine.example.com",
+				"app":        "evntslog",
+				"procid":     "1234",
+				"msgid":      "ID47",
+				"severity":   "notice",
+				"facility":   "local4",
+				"structured_data": map[string]any{
+					"exampleSDID@32473": map[string]any{"iut": "3", "eventSource": `Appli"cation`},
+					"origin":            map[string]any{"ip": "10.0.0.1"},
+				},
+				"message": "An application event log entry...",
+			},
+		},
+		{
+			name:  "rfc5424_nil_values",
+			frame: "<14>1 - - - - - -",
+			doc: protocol.Document{
+				"@timestamp": now,
+				"severity":   "info",
+				"facility":   "user",
+				"message":    "",
+			},
+		},
+		{
+			name:  "rfc3164",
+			frame: "<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8",
+			doc: protocol.Document{
+				"@timestamp": time.Date(2022, 10, 11, 22, 14, 15, 0, time.UTC),
+				"host":       "mymachine",
+				"app":        "su",
+				"procid":     "230",
+				"severity":   "crit",
+				"facility":   "auth",
+				"message":    "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			name:  "rfc3164_without_header",
+			frame: "<13>kernel: device eth0 entered promiscuous mode",
+			doc: protocol.Document{
+				"@timestamp": now,
+				"app":        "kernel",
+				"severity":   "notice",
+				"facility":   "user",
+				"message":    "device eth0 entered promiscuous mode",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			doc, err := Parse([]byte(c.frame), now)
+			assert.NoError(t, err)
+			assert.Equal(t, c.doc, doc)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, frame := range []string{"", "no priority", "<192>1 - - - - - -", "<1>1 bad"} {
+			_, err := Parse([]byte(frame), now)
+			assert.Error(t, err, frame)
+		}
+	})
+}
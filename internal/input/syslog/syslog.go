@@ -0,0 +1,203 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package syslog receives syslog messages over TCP and UDP and ingests them as documents
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/input"
+	"go.uber.org/zap"
+)
+
+// Server listens on the configured addresses and ingests the received messages by an
+// input.Sink
+type Server struct {
+	options     *config.Syslog
+	sink        *input.Sink
+	tcpListener net.Listener
+	udpConn     net.PacketConn
+	conns       sync.Map
+	wg          sync.WaitGroup
+}
+
+// Start starts listening on the addresses in the options, the returned server should be stopped
+// by Stop
+func Start(options *config.Syslog) (*Server, error) {
+	s := &Server{
+		options: options,
+		sink: input.NewSink(
+			"syslog",
+			options.Index,
+			options.BatchSize,
+			options.FlushInterval,
+		),
+	}
+	var err error
+	if options.TCP != "" {
+		if s.tcpListener, err = net.Listen("tcp", options.TCP); err != nil {
+			s.Stop()
+			return nil, err
+		}
+		s.wg.Add(1)
+		go s.serveTCP()
+	}
+	if options.UDP != "" {
+		if s.udpConn, err = net.ListenPacket("udp", options.UDP); err != nil {
+			s.Stop()
+			return nil, err
+		}
+		s.wg.Add(1)
+		go s.serveUDP()
+	}
+	logger.Info(
+		"syslog input started",
+		zap.String("tcp", options.TCP),
+		zap.String("udp", options.UDP),
+		zap.String("index", options.Index),
+	)
+	return s, nil
+}
+
+// Stop closes the listeners and the connections, then flushes the received messages
+func (s *Server) Stop() {
+	if s.tcpListener != nil {
+		s.tcpListener.Close()
+	}
+	if s.udpConn != nil {
+		s.udpConn.Close()
+	}
+	s.conns.Range(func(conn, _ any) bool {
+		conn.(net.Conn).Close()
+		return true
+	})
+	s.wg.Wait()
+	s.sink.Close()
+}
+
+// TCPAddr returns the address that the server listens on for TCP, nil if it does not
+func (s *Server) TCPAddr() net.Addr {
+	if s.tcpListener == nil {
+		return nil
+	}
+	return s.tcpListener.Addr()
+}
+
+// UDPAddr returns the address that the server listens on for UDP, nil if it does not
+func (s *Server) UDPAddr() net.Addr {
+	if s.udpConn == nil {
+		return nil
+	}
+	return s.udpConn.LocalAddr()
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcpListener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Error("syslog accept failed", zap.Error(err))
+			}
+			return
+		}
+		s.conns.Store(conn, struct{}{})
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.conns.Delete(conn)
+			defer conn.Close()
+			if err := s.readFrames(conn); err != nil && !errors.Is(err, net.ErrClosed) {
+				logger.Warn(
+					"syslog connection closed",
+					zap.String("remote", conn.RemoteAddr().String()),
+					zap.Error(err),
+				)
+			}
+		}()
+	}
+}
+
+// readFrames reads the frames of a TCP connection, which are prefixed with their lengths as the
+// octet-counting of RFC 6587 if they start with a digit, otherwise delimited by newlines
+func (s *Server) readFrames(conn net.Conn) error {
+	// a frame longer than the buffer is oversized
+	reader := bufio.NewReaderSize(conn, s.options.MaxMessageSize+1)
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return ignoreEOF(err)
+		}
+		var frame []byte
+		if first[0] >= '0' && first[0] <= '9' {
+			lengthStr, err := reader.ReadString(' ')
+			if err != nil {
+				return ignoreEOF(err)
+			}
+			length, err := strconv.Atoi(lengthStr[:len(lengthStr)-1])
+			if err != nil || length <= 0 || length > s.options.MaxMessageSize {
+				return errors.New("invalid octet-counting frame length " + lengthStr)
+			}
+			frame = make([]byte, length)
+			if _, err := io.ReadFull(reader, frame); err != nil {
+				return ignoreEOF(err)
+			}
+		} else {
+			frame, err = reader.ReadSlice('\n')
+			if errors.Is(err, bufio.ErrBufferFull) || len(frame) > s.options.MaxMessageSize {
+				// discard the rest of the oversized frame
+				for errors.Is(err, bufio.ErrBufferFull) {
+					_, err = reader.ReadSlice('\n')
+				}
+				continue
+			}
+			if err != nil && (!errors.Is(err, io.EOF) || len(frame) == 0) {
+				return ignoreEOF(err)
+			}
+		}
+		s.handle(frame)
+	}
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, s.options.MaxMessageSize)
+	for {
+		n, _, err := s.udpConn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Error("syslog read failed", zap.Error(err))
+			}
+			return
+		}
+		s.handle(buf[:n])
+	}
+}
+
+func (s *Server) handle(frame []byte) {
+	doc, err := Parse(frame, time.Now())
+	if err != nil {
+		logger.Warn(
+			"discard invalid syslog message",
+			zap.ByteString("message", frame),
+			zap.Error(err),
+		)
+		return
+	}
+	s.sink.Add(doc)
+}
+
+func ignoreEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
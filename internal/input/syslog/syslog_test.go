@@ -0,0 +1,70 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/tatris-io/tatris/internal/query"
+)
+
+func TestServer(t *testing.T) {
+	version := strings.ReplaceAll(
+		time.Now().Format(consts.TimeFmtWithoutSeparator),
+		consts.Dot,
+		consts.Empty,
+	)
+	server, err := Start(&config.Syslog{
+		Enabled:        true,
+		TCP:            "127.0.0.1:0",
+		UDP:            "127.0.0.1:0",
+		Index:          "syslog_" + version + "_{app}",
+		MaxMessageSize: 1024,
+		BatchSize:      10,
+		FlushInterval:  100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	// the message is recent enough to be found by the default time range of the searches
+	message := "<14>1 " + time.Now().UTC().Format(time.RFC3339) + " host App - - - message over %s"
+	tcp, err := net.Dial("tcp", server.TCPAddr().String())
+	assert.NoError(t, err)
+	// a frame delimited by newline and a frame prefixed with its length
+	_, err = fmt.Fprintf(tcp, message+"\n", "tcp")
+	assert.NoError(t, err)
+	frame := fmt.Sprintf(message, "tcp")
+	_, err = fmt.Fprintf(tcp, "%d %s", len(frame), frame)
+	assert.NoError(t, err)
+	assert.NoError(t, tcp.Close())
+	udp, err := net.Dial("udp", server.UDPAddr().String())
+	assert.NoError(t, err)
+	_, err = fmt.Fprintf(udp, message, "udp")
+	assert.NoError(t, err)
+	assert.NoError(t, udp.Close())
+
+	// the index is named after the lowercased app
+	name := "syslog_" + version + "_app"
+	assert.Eventually(t, func() bool {
+		index, err := metadata.GetIndexExplicitly(name)
+		if err != nil {
+			return false
+		}
+		resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+			Index: name,
+			Query: protocol.Query{MatchAll: &protocol.MatchAll{}},
+			Size:  0,
+		})
+		return err == nil && resp.Hits.Total.Value == 3
+	}, 10*time.Second, 100*time.Millisecond)
+	server.Stop()
+}
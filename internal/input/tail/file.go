@@ -0,0 +1,163 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package tail
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash/fnv"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// headSize is the maximum bytes of the head of a file, which is hashed to recognize the file
+const headSize = 1024
+
+// file is a tailed file, only the complete lines are read
+type file struct {
+	path string
+	// where the next read starts
+	offset int64
+	// the hash of the first headSize bytes of the file
+	head     string
+	headSize int64
+	// the multiline event waiting for its following lines
+	pending *event
+	// the offset that has been persisted
+	saved int64
+}
+
+// event is a line, or lines joined by a multiline pattern
+type event struct {
+	// where the first line starts
+	offset int64
+	lines  []string
+}
+
+func (e *event) message() string {
+	return strings.Join(e.lines, "\n")
+}
+
+// committed returns the offset before which all the lines have been read into the completed
+// events, the lines of the pending event are read again if the tailing resumes from it
+func (f *file) committed() int64 {
+	if f.pending != nil {
+		return f.pending.offset
+	}
+	return f.offset
+}
+
+// check resets the file if it has been truncated or replaced by another file with the same path,
+// and records the head of the file until the head is long enough.
+// It returns whether the file has been reset.
+func (f *file) check(r io.ReaderAt, size int64) (bool, error) {
+	reset := size < f.offset
+	if !reset && f.headSize > 0 {
+		if size < f.headSize {
+			reset = true
+		} else {
+			head, err := hashHead(r, f.headSize)
+			if err != nil {
+				return false, err
+			}
+			reset = head != f.head
+		}
+	}
+	if reset {
+		f.offset, f.pending, f.head, f.headSize = 0, nil, "", 0
+	}
+	if f.headSize < headSize && size > f.headSize {
+		n := size
+		if n > headSize {
+			n = headSize
+		}
+		head, err := hashHead(r, n)
+		if err != nil {
+			return reset, err
+		}
+		f.head, f.headSize = head, n
+	}
+	return reset, nil
+}
+
+// read reads the complete lines after the offset, at most maxReadBytes at a time, and returns the
+// events completed by them. The pending event is completed if there is nothing new to read.
+// A line longer than maxReadBytes is split.
+func (f *file) read(
+	r io.ReaderAt,
+	size int64,
+	maxReadBytes int,
+	multiline *regexp.Regexp,
+	maxEventLines int,
+) ([]*event, error) {
+	events := make([]*event, 0)
+	if f.offset >= size {
+		if f.pending != nil {
+			events = append(events, f.pending)
+			f.pending = nil
+		}
+		return events, nil
+	}
+	n := size - f.offset
+	if n > int64(maxReadBytes) {
+		n = int64(maxReadBytes)
+	}
+	buf := make([]byte, n)
+	read, err := r.ReadAt(buf, f.offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	buf = buf[:read]
+	data := buf
+	start := f.offset
+	for len(data) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else if len(buf) == maxReadBytes && start == f.offset {
+			// no line ends in the buffer
+			line, data = data, nil
+		} else {
+			break
+		}
+		offset := start
+		start = f.offset + int64(len(buf)-len(data))
+		text := strings.TrimSuffix(string(line), "\r")
+		events = f.join(events, offset, text, multiline, maxEventLines)
+	}
+	f.offset = start
+	return events, nil
+}
+
+// join makes the line a new event or joins it to the pending event
+func (f *file) join(
+	events []*event,
+	offset int64,
+	line string,
+	multiline *regexp.Regexp,
+	maxEventLines int,
+) []*event {
+	if multiline == nil {
+		return append(events, &event{offset: offset, lines: []string{line}})
+	}
+	if f.pending != nil && !multiline.MatchString(line) && len(f.pending.lines) < maxEventLines {
+		f.pending.lines = append(f.pending.lines, line)
+		return events
+	}
+	if f.pending != nil {
+		events = append(events, f.pending)
+	}
+	f.pending = &event{offset: offset, lines: []string{line}}
+	return events
+}
+
+func hashHead(r io.ReaderAt, n int64) (string, error) {
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return "", err
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(buf)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
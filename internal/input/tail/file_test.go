@@ -0,0 +1,93 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package tail
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func messages(events []*event) []string {
+	result := make([]string, len(events))
+	for i, e := range events {
+		result[i] = e.message()
+	}
+	return result
+}
+
+func TestFile(t *testing.T) {
+	t.Run("test_lines", func(t *testing.T) {
+		f := &file{}
+		content := "first\r\nsecond\nthird"
+		events, err := f.read(strings.NewReader(content), int64(len(content)), 1024, nil, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"first", "second"}, messages(events))
+		assert.Equal(t, int64(14), f.offset)
+		assert.Equal(t, int64(7), events[1].offset)
+
+		// the incomplete line waits
+		events, err = f.read(strings.NewReader(content), int64(len(content)), 1024, nil, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(events))
+		content += "\n" + strings.Repeat("x", 10) + "\n"
+		events, err = f.read(strings.NewReader(content), int64(len(content)), 6, nil, 10)
+		assert.NoError(t, err)
+		// the buffer is consumed line by line, the line longer than the buffer is split
+		assert.Equal(t, []string{"third"}, messages(events))
+		events, err = f.read(strings.NewReader(content), int64(len(content)), 6, nil, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"xxxxxx"}, messages(events))
+		assert.Equal(t, int64(26), f.committed())
+	})
+
+	t.Run("test_multiline", func(t *testing.T) {
+		f := &file{}
+		multiline := regexp.MustCompile(`^\d{4}-`)
+		content := "2023-01-02 error\n  at a\n  at b\n  at c\n2023-01-03 info\n"
+		events, err := f.read(strings.NewReader(content), int64(len(content)), 1024, multiline, 3)
+		assert.NoError(t, err)
+		// the event is split at the max lines
+		assert.Equal(t, []string{"2023-01-02 error\n  at a\n  at b", "  at c"}, messages(events))
+		// the pending event is read again after restarts
+		assert.Equal(t, int64(38), f.committed())
+		// the pending event is completed if there is nothing new
+		events, err = f.read(strings.NewReader(content), int64(len(content)), 1024, multiline, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"2023-01-03 info"}, messages(events))
+		assert.Equal(t, int64(len(content)), f.committed())
+	})
+
+	t.Run("test_check", func(t *testing.T) {
+		f := &file{}
+		content := "first\nsecond\n"
+		reset, err := f.check(strings.NewReader(content), int64(len(content)))
+		assert.NoError(t, err)
+		assert.Equal(t, false, reset)
+		assert.Equal(t, int64(len(content)), f.headSize)
+		_, err = f.read(strings.NewReader(content), int64(len(content)), 1024, nil, 10)
+		assert.NoError(t, err)
+
+		// appended
+		content += "third\n"
+		reset, err = f.check(strings.NewReader(content), int64(len(content)))
+		assert.NoError(t, err)
+		assert.Equal(t, false, reset)
+		assert.Equal(t, int64(13), f.offset)
+		// replaced by another file
+		other := "FIRST\nsecond\nthird\n"
+		reset, err = f.check(strings.NewReader(other), int64(len(other)))
+		assert.NoError(t, err)
+		assert.Equal(t, true, reset)
+		assert.Equal(t, int64(0), f.offset)
+		_, err = f.read(strings.NewReader(other), int64(len(other)), 1024, nil, 10)
+		assert.NoError(t, err)
+		// truncated
+		reset, err = f.check(strings.NewReader("FIRST\n"), 6)
+		assert.NoError(t, err)
+		assert.Equal(t, true, reset)
+		assert.Equal(t, int64(6), f.headSize)
+	})
+}
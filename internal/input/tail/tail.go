@@ -0,0 +1,219 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package tail tails the local files and ingests their lines as documents
+package tail
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/input"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"go.uber.org/zap"
+)
+
+const (
+	FieldMessage = "message"
+	FieldPath    = "path"
+)
+
+// Tailer polls the files matching the configured paths, the new lines are ingested before their
+// offsets are persisted, so that a line may be ingested again but never lost across restarts.
+// A file is recognized by its path and head, the unread lines of a file are lost if it is
+// replaced with another file between two polls.
+type Tailer struct {
+	options   *config.Tail
+	target    *input.Target
+	multiline *regexp.Regexp
+	files     map[string]*file
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// Start starts tailing the files in the options, the returned tailer should be stopped by Stop
+func Start(options *config.Tail) (*Tailer, error) {
+	t := &Tailer{
+		options: options,
+		target:  input.NewTarget(options.Index),
+		files:   make(map[string]*file),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, pattern := range options.Paths {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+	}
+	if options.MultilinePattern != "" {
+		multiline, err := regexp.Compile(options.MultilinePattern)
+		if err != nil {
+			return nil, err
+		}
+		t.multiline = multiline
+	}
+	go t.run()
+	logger.Info(
+		"tail input started",
+		zap.Strings("paths", options.Paths),
+		zap.String("index", options.Index),
+	)
+	return t, nil
+}
+
+// Stop stops tailing, the lines being ingested are read again after restarts
+func (t *Tailer) Stop() {
+	close(t.stop)
+	<-t.done
+}
+
+func (t *Tailer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		t.poll()
+		select {
+		case <-ticker.C:
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// poll tails the files matching the paths one by one, and forgets the files removed
+func (t *Tailer) poll() {
+	paths := make(map[string]struct{})
+	for _, pattern := range t.options.Paths {
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			paths[path] = struct{}{}
+		}
+	}
+	for path := range t.files {
+		if _, ok := paths[path]; !ok {
+			delete(t.files, path)
+			if err := metadata.DeleteTailOffset(path); err != nil {
+				logger.Warn("delete tail offset failed", zap.String("path", path), zap.Error(err))
+			}
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+	for _, path := range sorted {
+		select {
+		case <-t.stop:
+			return
+		default:
+		}
+		if err := t.tail(path); err != nil {
+			logger.Warn("tail file failed", zap.String("path", path), zap.Error(err))
+		}
+	}
+}
+
+// tail reads the new lines of the file until the end, and ingests them chunk by chunk
+func (t *Tailer) tail(path string) error {
+	f, err := t.file(path)
+	if err != nil {
+		return err
+	}
+	r, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	info, err := r.Stat()
+	if err != nil || info.IsDir() {
+		return err
+	}
+	size := info.Size()
+	reset, err := f.check(r, size)
+	if err != nil {
+		return err
+	}
+	if reset {
+		logger.Info("tail file from the beginning", zap.String("path", path))
+	}
+	for {
+		progressed := f.offset < size
+		events, err := f.read(r, size, t.options.MaxReadBytes, t.multiline, t.options.MaxEventLines)
+		if err != nil {
+			return err
+		}
+		if len(events) > 0 {
+			if err = t.ingest(f, events); err != nil {
+				return err
+			}
+		}
+		if committed := f.committed(); committed != f.saved {
+			if err = metadata.SaveTailOffset(&protocol.TailOffset{
+				Path:     f.path,
+				Offset:   committed,
+				Head:     f.head,
+				HeadSize: f.headSize,
+			}); err != nil {
+				return err
+			}
+			f.saved = committed
+		}
+		if !progressed || f.offset >= size {
+			return nil
+		}
+	}
+}
+
+// file returns the tailed file of the path, a file seen for the first time resumes from its
+// persisted offset
+func (t *Tailer) file(path string) (*file, error) {
+	if f, ok := t.files[path]; ok {
+		return f, nil
+	}
+	offset, err := metadata.GetTailOffset(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &file{path: path}
+	if offset != nil {
+		f = &file{
+			path:     path,
+			offset:   offset.Offset,
+			head:     offset.Head,
+			headSize: offset.HeadSize,
+			saved:    offset.Offset,
+		}
+	}
+	t.files[path] = f
+	return f, nil
+}
+
+// ingest ingests the events into their target indexes, an error is returned only if the tailer
+// stops before the events are ingested
+func (t *Tailer) ingest(f *file, events []*event) error {
+	now := time.Now()
+	docs := make([]protocol.Document, len(events))
+	for i, e := range events {
+		docs[i] = protocol.Document{
+			consts.TimestampField: now,
+			FieldMessage:          e.message(),
+			FieldPath:             f.path,
+		}
+	}
+	names, groups := t.target.Group(docs)
+	for _, name := range names {
+		// the offset is not persisted past the lines not ingested
+		if err := input.IngestBlocking(name, groups[name], t.stop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
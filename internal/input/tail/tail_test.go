@@ -0,0 +1,88 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package tail
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/tatris-io/tatris/internal/query"
+)
+
+func TestTailer(t *testing.T) {
+	version := strings.ReplaceAll(
+		time.Now().Format(consts.TimeFmtWithoutSeparator),
+		consts.Dot,
+		consts.Empty,
+	)
+	name := "tail_" + version
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	options := &config.Tail{
+		Enabled:          true,
+		Paths:            []string{filepath.Join(dir, "*.log")},
+		Index:            name,
+		MultilinePattern: `^\d{4}-`,
+		PollInterval:     100 * time.Millisecond,
+		MaxReadBytes:     1024,
+		MaxEventLines:    100,
+	}
+	write := func(content string) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+		assert.NoError(t, err)
+		_, err = f.WriteString(content)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+	}
+	count := func() int64 {
+		index, err := metadata.GetIndexExplicitly(name)
+		if err != nil {
+			return 0
+		}
+		resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+			Index: name,
+			Query: protocol.Query{MatchAll: &protocol.MatchAll{}},
+			Size:  0,
+		})
+		if err != nil {
+			return 0
+		}
+		return resp.Hits.Total.Value
+	}
+
+	write("2023-01-02 error\n  at a\n  at b\n2023-01-02 info\n")
+	tailer, err := Start(options)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return count() == 2
+	}, 10*time.Second, 100*time.Millisecond)
+	tailer.Stop()
+	offset, err := metadata.GetTailOffset(path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(47), offset.Offset)
+
+	// the tailing resumes from the persisted offset after restarts
+	write("2023-01-03 warn\n")
+	tailer, err = Start(options)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return count() == 3
+	}, 10*time.Second, 100*time.Millisecond)
+
+	// the offset is forgotten once the file is removed
+	assert.NoError(t, os.Remove(path))
+	assert.Eventually(t, func() bool {
+		offset, err := metadata.GetTailOffset(path)
+		return err == nil && offset == nil
+	}, 10*time.Second, 100*time.Millisecond)
+	tailer.Stop()
+}
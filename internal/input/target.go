@@ -0,0 +1,76 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+// Package input organizes the inputs that receive logs by protocols other than the HTTP APIs
+package input
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+var placeholderRegexp = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// dateLayouts maps the date letters in the placeholders to the Go layouts
+var dateLayouts = strings.NewReplacer(
+	"yyyy", "2006",
+	"yy", "06",
+	"MM", "01",
+	"dd", "02",
+	"HH", "15",
+)
+
+// Target decides the index that a document is ingested into by a template such as
+// `syslog-{app}-{+yyyy.MM.dd}`: `{field}` is replaced with the field of the document, and
+// `{+pattern}` is replaced with the @timestamp of the document formatted by the date pattern.
+// The rendered name is lowercased, and the missing fields are rendered as `unknown`.
+type Target struct {
+	template string
+	static   bool
+}
+
+func NewTarget(template string) *Target {
+	return &Target{template: template, static: !placeholderRegexp.MatchString(template)}
+}
+
+// Render returns the name of the index that the document should be ingested into
+func (t *Target) Render(doc protocol.Document) string {
+	if t.static {
+		return t.template
+	}
+	name := placeholderRegexp.ReplaceAllStringFunc(t.template, func(m string) string {
+		placeholder := m[1 : len(m)-1]
+		if strings.HasPrefix(placeholder, "+") {
+			timestamp, ok := doc[consts.TimestampField].(time.Time)
+			if !ok {
+				timestamp = time.Now()
+			}
+			return timestamp.UTC().Format(dateLayouts.Replace(placeholder[1:]))
+		}
+		value, ok := doc[placeholder]
+		if !ok || value == nil || value == "" {
+			return "unknown"
+		}
+		return fmt.Sprint(value)
+	})
+	return strings.ToLower(name)
+}
+
+// Group groups the documents by their target indexes, the names of the indexes are returned in
+// the order they are first rendered
+func (t *Target) Group(docs []protocol.Document) ([]string, map[string][]protocol.Document) {
+	names := make([]string, 0)
+	groups := make(map[string][]protocol.Document)
+	for _, doc := range docs {
+		name := t.Render(doc)
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], doc)
+	}
+	return names, groups
+}
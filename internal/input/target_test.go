@@ -0,0 +1,21 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package input
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+func TestTarget(t *testing.T) {
+	doc := protocol.Document{
+		"@timestamp": time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		"app":        "Nginx",
+	}
+	assert.Equal(t, "logs", NewTarget("logs").Render(doc))
+	assert.Equal(t, "logs-nginx-2023.01.02", NewTarget("logs-{app}-{+yyyy.MM.dd}").Render(doc))
+	assert.Equal(t, "logs-unknown-2023010203", NewTarget("logs-{host}-{+yyyyMMddHH}").Render(doc))
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 
 	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/core"
 
 	"github.com/bobg/go-generics/set"
 	"github.com/tatris-io/tatris/internal/common/utils"
@@ -28,6 +29,46 @@ func ResolveAliases(name string) []string {
 	return indexes.Slice()
 }
 
+// GetWriteIndex gets the index that the writes to the rollover alias go to, which is the index
+// attached to the alias by its lifecycle settings and not rolled over yet. The index being rolled
+// over keeps taking the writes until the next index is attached to the alias.
+// errs.IndexNotFoundError will be returned if there is no such index.
+func GetWriteIndex(alias string) (*core.Index, error) {
+	var latest *core.Index
+	var latestTime int64
+	for _, term := range GetAliasTerms("", alias) {
+		if term.Alias != alias {
+			continue
+		}
+		index, err := GetIndexExplicitly(term.Index)
+		if err != nil || index.Settings.RolloverAlias() != alias {
+			continue
+		}
+		lifecycle := index.GetLifecycle()
+		if lifecycle == nil || lifecycle.RolloverTime == 0 {
+			return index, nil
+		}
+		if lifecycle.RolloverTime > latestTime {
+			latest, latestTime = index, lifecycle.RolloverTime
+		}
+	}
+	if latest != nil {
+		return latest, nil
+	}
+	return nil, &errs.IndexNotFoundError{Index: alias}
+}
+
+// ResolveWriteIndex gets the index that the writes to the name go to, which is the index with the
+// name, or the write index if the name is a rollover alias.
+// errs.IndexNotFoundError will be returned if there is no such index.
+func ResolveWriteIndex(name string) (*core.Index, error) {
+	index, err := GetIndexExplicitly(name)
+	if errs.IsIndexNotFound(err) {
+		return GetWriteIndex(name)
+	}
+	return index, err
+}
+
 func AddAlias(aliasTerm *protocol.AliasTerm) error {
 
 	index := aliasTerm.Index
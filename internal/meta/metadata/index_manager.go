@@ -136,6 +136,16 @@ func GetIndexExplicitly(indexName string) (*core.Index, error) {
 	return nil, &errs.IndexNotFoundError{Index: indexName}
 }
 
+// GetAllIndexes gets all the indexes known to metadata
+func GetAllIndexes() []*core.Index {
+	items := Instance().IndexCache.Items()
+	indexes := make([]*core.Index, 0, len(items))
+	for _, item := range items {
+		indexes = append(indexes, item.Object.(*core.Index))
+	}
+	return indexes
+}
+
 func DeleteIndex(indexName string) error {
 	index, err := GetIndexExplicitly(indexName)
 	if err != nil {
@@ -196,12 +206,26 @@ func BuildIndex(index *core.Index, template *protocol.IndexTemplate) {
 					}
 				}
 				for n, p := range template.Template.Mappings.Properties {
-					mappings.Properties[n] = &protocol.Property{Type: p.Type, Dynamic: p.Dynamic}
+					mappings.Properties[n] = copyProperty(p, p.Dynamic)
+				}
+				if template.Template.Mappings.Timestamp != nil {
+					timestamp := *template.Template.Mappings.Timestamp
+					mappings.Timestamp = &timestamp
 				}
 			}
 			if template.Template.Settings != nil {
 				settings.NumberOfShards = template.Template.Settings.NumberOfShards
 				settings.NumberOfReplicas = template.Template.Settings.NumberOfReplicas
+				settings.DefaultPipeline = template.Template.Settings.DefaultPipeline
+				if template.Template.Settings.DeadLetter != nil {
+					deadLetter := *template.Template.Settings.DeadLetter
+					settings.DeadLetter = &deadLetter
+				}
+				settings.Retention = template.Template.Settings.Retention
+				if template.Template.Settings.Lifecycle != nil {
+					lifecycle := *template.Template.Settings.Lifecycle
+					settings.Lifecycle = &lifecycle
+				}
 			}
 		}
 	}
@@ -211,13 +235,11 @@ func BuildIndex(index *core.Index, template *protocol.IndexTemplate) {
 			mappings.Dynamic = index.Mappings.Dynamic
 		}
 		for n, p := range index.Mappings.Properties {
-			property := &protocol.Property{Type: p.Type}
-			if p.Dynamic != "" {
-				property.Dynamic = p.Dynamic
-			} else {
-				property.Dynamic = mappings.Dynamic
-			}
-			mappings.Properties[n] = property
+			mappings.Properties[n] = copyProperty(p, mappings.Dynamic)
+		}
+		if index.Mappings.Timestamp != nil {
+			timestamp := *index.Mappings.Timestamp
+			mappings.Timestamp = &timestamp
 		}
 	}
 	if index.Settings != nil {
@@ -227,6 +249,20 @@ func BuildIndex(index *core.Index, template *protocol.IndexTemplate) {
 		if index.Settings.NumberOfReplicas != 0 {
 			settings.NumberOfReplicas = index.Settings.NumberOfReplicas
 		}
+		if index.Settings.DefaultPipeline != "" {
+			settings.DefaultPipeline = index.Settings.DefaultPipeline
+		}
+		if index.Settings.DeadLetter != nil {
+			deadLetter := *index.Settings.DeadLetter
+			settings.DeadLetter = &deadLetter
+		}
+		if index.Settings.Retention != "" {
+			settings.Retention = index.Settings.Retention
+		}
+		if index.Settings.Lifecycle != nil {
+			lifecycle := *index.Settings.Lifecycle
+			settings.Lifecycle = &lifecycle
+		}
 	}
 	index.Mappings = mappings
 	index.Settings = settings
@@ -277,9 +313,46 @@ func CheckSettings(settings *protocol.Settings) error {
 			Right: MaxNumberOfReplicas,
 		}
 	}
+	if settings.DeadLetter != nil && settings.DeadLetter.Index != "" {
+		if err := utils.ValidateResourceName(settings.DeadLetter.Index); err != nil {
+			return err
+		}
+	}
+	if retention, err := settings.RetentionPeriod(); err != nil || retention < 0 {
+		return &errs.InvalidFieldValError{
+			Field: "settings.retention",
+			Type:  "duration",
+			Value: settings.Retention,
+		}
+	}
+	if settings.Lifecycle != nil && settings.Lifecycle.RolloverAlias != "" {
+		if err := utils.ValidateResourceName(settings.Lifecycle.RolloverAlias); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// copyProperty deeply copies a property, the property without a dynamic mode inherits the mode of
+// its parent. A property with subfields is an object field, whose type may be omitted.
+func copyProperty(p *protocol.Property, dynamic string) *protocol.Property {
+	property := &protocol.Property{Type: p.Type, Dynamic: p.Dynamic}
+	if property.Dynamic == "" {
+		property.Dynamic = dynamic
+	}
+	if (p.Properties != nil && p.Type == "") ||
+		strings.EqualFold(p.Type, consts.MappingFieldTypeObject) {
+		property.Type = consts.MappingFieldTypeObject
+	}
+	if p.Properties != nil || property.Type == consts.MappingFieldTypeObject {
+		property.Properties = make(map[string]*protocol.Property, len(p.Properties))
+		for n, sub := range p.Properties {
+			property.Properties[n] = copyProperty(sub, property.Dynamic)
+		}
+	}
+	return property
+}
+
 func CheckMappings(mappings *protocol.Mappings) error {
 	if mappings == nil {
 		return errs.ErrEmptyMappings
@@ -292,15 +365,17 @@ func CheckMappings(mappings *protocol.Mappings) error {
 			return errs.ErrEmptyMappings
 		}
 	}
-	err := checkReservedField(mappings.Properties)
+	err := checkTimestamp(mappings.Timestamp)
 	if err != nil {
 		return err
 	}
-	for _, property := range mappings.Properties {
-		err = checkMappingType(property.Type)
-		if err != nil {
-			return err
-		}
+	err = checkReservedField(mappings)
+	if err != nil {
+		return err
+	}
+	err = checkProperties(mappings.Properties)
+	if err != nil {
+		return err
 	}
 	err = checkDynamicTemplates(mappings.DynamicTemplates)
 	if err != nil {
@@ -309,7 +384,42 @@ func CheckMappings(mappings *protocol.Mappings) error {
 	return nil
 }
 
-func checkReservedField(properties map[string]*protocol.Property) error {
+// checkProperties checks the properties recursively, a property with subfields is an object field,
+// whose type may be omitted.
+func checkProperties(properties map[string]*protocol.Property) error {
+	for name, property := range properties {
+		object := strings.EqualFold(property.Type, consts.MappingFieldTypeObject)
+		if property.Properties == nil && !object {
+			if err := checkMappingType(property.Type); err != nil {
+				return err
+			}
+			continue
+		}
+		if property.Type != "" && !object {
+			return &errs.InvalidFieldError{
+				Field:   name,
+				Message: "only object fields can have properties",
+			}
+		}
+		if err := checkProperties(property.Properties); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkTimestamp(timestamp *protocol.Timestamp) error {
+	if timestamp == nil || timestamp.Format == "" {
+		return nil
+	}
+	if _, err := utils.NewTimeParser(timestamp.Format); err != nil {
+		return &errs.InvalidFieldError{Field: "_timestamp.format", Message: err.Error()}
+	}
+	return nil
+}
+
+func checkReservedField(mappings *protocol.Mappings) error {
+	properties := mappings.Properties
 	IDField, exist := properties[consts.IDField]
 	if exist {
 		if !strings.EqualFold(IDField.Type, consts.MappingFieldTypeKeyword) {
@@ -330,23 +440,25 @@ func checkReservedField(properties map[string]*protocol.Property) error {
 	}
 	IDField.Dynamic = consts.StrictMappingMode
 
-	TimestampField, exist := properties[consts.TimestampField]
+	// the event-time field may be a subfield
+	timestampField := mappings.TimestampField()
+	TimestampField, exist := protocol.GetProperty(properties, timestampField)
 	if exist {
 		if !strings.EqualFold(TimestampField.Type, consts.MappingFieldTypeDate) {
 			return &errs.InvalidFieldError{
-				Field: consts.TimestampField,
+				Field: timestampField,
 				Message: fmt.Sprintf(
 					"%s must be %s type",
-					consts.TimestampField,
+					timestampField,
 					consts.MappingFieldTypeDate,
 				),
 			}
 		}
 	} else {
-		TimestampField = &protocol.Property{
+		protocol.PutProperty(properties, timestampField, &protocol.Property{
 			Type: consts.MappingFieldTypeDate,
-		}
-		properties[consts.TimestampField] = TimestampField
+		})
+		TimestampField, _ = protocol.GetProperty(properties, timestampField)
 	}
 	TimestampField.Dynamic = consts.StrictMappingMode
 	return nil
@@ -358,8 +470,11 @@ func checkDynamicTemplates(templates []map[string]*protocol.DynamicTemplate) err
 			if dt.Mapping == nil {
 				return errs.ErrNoMappingInDynamicTemplate
 			}
-			if err := checkMappingType(dt.Mapping.Type); err != nil {
-				return err
+			// an object matched by a dynamic template is still mapped by its subfields
+			if !strings.EqualFold(dt.Mapping.Type, consts.MappingFieldTypeObject) {
+				if err := checkMappingType(dt.Mapping.Type); err != nil {
+					return err
+				}
 			}
 			if dt.MatchMappingType != "" && !consts.IsJSONFieldType(dt.MatchMappingType) {
 				return errs.ErrInvalidJSONType
@@ -35,6 +35,13 @@ func TestManager(t *testing.T) {
 		{"Res":true ,"Index":{"settings":{"number_of_shards":3,"number_of_replicas":1},"mappings":{"properties":{"name":{"type":"dAtE"}}}}},
 		{"Res":true, "Index":{}},
 		{"Res":true ,"Index":{"settings":{"number_of_shards":3,"number_of_replicas":1},"mappings":{}}},
+		{"Res":true ,"Index":{"settings":{"number_of_shards":3,"number_of_replicas":1},"mappings":{"properties":{"kubernetes":{"properties":{"pod":{"properties":{"name":{"type":"keyword"}}}}}}}}},
+		{"Res":true ,"Index":{"settings":{"number_of_shards":3,"number_of_replicas":1},"mappings":{"properties":{"kubernetes":{"type":"object"}}}}},
+		{"Res":false ,"Index":{"settings":{"number_of_shards":3,"number_of_replicas":1},"mappings":{"properties":{"kubernetes":{"type":"keyword","properties":{"pod":{"type":"keyword"}}}}}}},
+		{"Res":false ,"Index":{"settings":{"number_of_shards":3,"number_of_replicas":1},"mappings":{"properties":{"kubernetes":{"properties":{"pod":{"type":"string"}}}}}}},
+		{"Res":true ,"Index":{"settings":{"number_of_shards":3,"number_of_replicas":1},"mappings":{"_timestamp":{"field":"event.created","format":"UNIX_MS"}}}},
+		{"Res":false ,"Index":{"settings":{"number_of_shards":3,"number_of_replicas":1},"mappings":{"_timestamp":{"field":"ts"},"properties":{"ts":{"type":"keyword"}}}}},
+		{"Res":false ,"Index":{"settings":{"number_of_shards":3,"number_of_replicas":1},"mappings":{"_timestamp":{"format":"yyyy-QQ"}}}},
 		{"Res":false ,"Index":{"settings":{"number_of_shards":3,"number_of_replicas":1},"mappings":{"properties":{"name":{"type":"keyword"},"age":{"type":"string"}}}}},
 		{"Res":false ,"Index":{"settings":{"number_of_shards":3,"number_of_replicas":1},"mappings":{"properties":{"name":{"type":"bool"},"age":{"type":"int"}}}}}
 	]`
@@ -101,3 +108,27 @@ func TestDynamicMappingCheck(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildObjectProperty(t *testing.T) {
+	index := &core.Index{Index: &protocol.Index{Mappings: &protocol.Mappings{
+		Properties: map[string]*protocol.Property{
+			"kubernetes": {Properties: map[string]*protocol.Property{
+				"pod": {Type: "OBJECT"},
+			}},
+		},
+	}}}
+	original := index.Mappings
+	BuildIndex(index, nil)
+	// the object fields are normalized on the built mappings only
+	kubernetes := index.Mappings.Properties["kubernetes"]
+	assert.Equal(t, consts.MappingFieldTypeObject, kubernetes.Type)
+	assert.Equal(t, consts.MappingFieldTypeObject, kubernetes.Properties["pod"].Type)
+	assert.NotNil(t, kubernetes.Properties["pod"].Properties)
+	assert.Equal(t, "", original.Properties["kubernetes"].Type)
+	assert.Nil(t, original.Properties["kubernetes"].Properties["pod"].Properties)
+
+	// the mappings are checked as they are
+	assert.NoError(t, CheckMappings(original))
+	assert.Equal(t, "", original.Properties["kubernetes"].Type)
+	assert.Equal(t, "OBJECT", original.Properties["kubernetes"].Properties["pod"].Type)
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	cache "github.com/patrickmn/go-cache"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/common/utils"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/xhit/go-str2duration/v2"
+	"go.uber.org/zap"
+)
+
+// SaveLifecyclePolicy creates or replaces the lifecycle policy, the policy should have been checked
+// by CheckLifecyclePolicy
+func SaveLifecyclePolicy(policy *protocol.LifecyclePolicy) error {
+	if err := utils.ValidateResourceName(policy.Name); err != nil {
+		return err
+	}
+	policy.ModifiedDate = time.Now().UnixMilli()
+	json, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	logger.Info("save lifecycle policy", zap.String("policy", string(json)))
+	if err := Instance().MStore.Set(lifecyclePolicyPrefix(policy.Name), json); err != nil {
+		return err
+	}
+	Instance().LifecyclePolicyCache.Set(policy.Name, policy, cache.NoExpiration)
+	return nil
+}
+
+// ResolveLifecyclePolicies resolves the lifecycle policies by an expression, which may be a native
+// name or a wildcard.
+// errs.LifecyclePolicyNotFoundError will be returned if the expression does not match any
+// policies.
+func ResolveLifecyclePolicies(exp string) ([]*protocol.LifecyclePolicy, error) {
+	results := make([]*protocol.LifecyclePolicy, 0)
+	for name, item := range Instance().LifecyclePolicyCache.Items() {
+		if utils.WildcardMatch(exp, name) {
+			results = append(results, item.Object.(*protocol.LifecyclePolicy))
+		}
+	}
+	if len(results) == 0 {
+		return nil, &errs.LifecyclePolicyNotFoundError{Policy: exp}
+	}
+	return results, nil
+}
+
+// GetLifecyclePolicyExplicitly gets the lifecycle policy precisely by name
+func GetLifecyclePolicyExplicitly(name string) (*protocol.LifecyclePolicy, error) {
+	if cached, found := Instance().LifecyclePolicyCache.Get(name); found {
+		return cached.(*protocol.LifecyclePolicy), nil
+	}
+	return nil, &errs.LifecyclePolicyNotFoundError{Policy: name}
+}
+
+// DeleteLifecyclePolicy deletes the lifecycle policy, the indexes attached to it are left where
+// they are in the policy
+func DeleteLifecyclePolicy(name string) error {
+	if _, err := GetLifecyclePolicyExplicitly(name); err != nil {
+		return err
+	}
+	logger.Info("delete lifecycle policy", zap.String("policy", name))
+	Instance().LifecyclePolicyCache.Delete(name)
+	return Instance().MStore.Delete(lifecyclePolicyPrefix(name))
+}
+
+// CheckLifecyclePolicy checks the ages of the phases and the options of the actions
+func CheckLifecyclePolicy(policy *protocol.LifecyclePolicy) error {
+	if policy == nil || policy.Phases == nil {
+		return &errs.InvalidFieldError{Field: "policy.phases", Message: "should be specified"}
+	}
+	for _, name := range protocol.LifecyclePhaseNames {
+		phase := policy.Phase(name)
+		if phase == nil {
+			continue
+		}
+		field := fmt.Sprintf("policy.phases.%s", name)
+		if err := checkDuration(field+".min_age", phase.MinAge); err != nil {
+			return err
+		}
+		if phase.Actions == nil {
+			continue
+		}
+		if rollover := phase.Actions.Rollover; rollover != nil {
+			if name != protocol.LifecyclePhaseHot {
+				return &errs.InvalidFieldError{
+					Field:   field + ".actions.rollover",
+					Message: "is only allowed in the hot phase",
+				}
+			}
+			if rollover.MaxAge == "" && rollover.MaxDocs <= 0 {
+				return &errs.InvalidFieldError{
+					Field:   field + ".actions.rollover",
+					Message: "at least one of max_age and max_docs should be specified",
+				}
+			}
+			maxAge := field + ".actions.rollover.max_age"
+			if err := checkDuration(maxAge, rollover.MaxAge); err != nil {
+				return err
+			}
+		}
+		if phase.Actions.Migrate != nil && name == protocol.LifecyclePhaseHot {
+			return &errs.InvalidFieldError{
+				Field:   field + ".actions.migrate",
+				Message: "is not allowed in the hot phase",
+			}
+		}
+		if forceMerge := phase.Actions.ForceMerge; forceMerge != nil && forceMerge.MaxDocs < 0 {
+			return &errs.InvalidFieldValError{
+				Field: field + ".actions.forcemerge.max_docs",
+				Type:  "long",
+				Value: forceMerge.MaxDocs,
+			}
+		}
+	}
+	return nil
+}
+
+// checkDuration checks the duration like `7d`, empty means 0
+func checkDuration(field, value string) error {
+	if value == "" {
+		return nil
+	}
+	if d, err := str2duration.ParseDuration(value); err != nil || d < 0 {
+		return &errs.InvalidFieldValError{Field: field, Type: "duration", Value: value}
+	}
+	return nil
+}
+
+func lifecyclePolicyPrefix(name string) string {
+	return LifecyclePolicyPath + name
+}
@@ -19,6 +19,9 @@ import (
 const AliasPath = "/_alias/"
 const IndexPath = "/_index/"
 const IndexTemplatePath = "/_index_template/"
+const PipelinePath = "/_ingest/pipeline/"
+const TailOffsetPath = "/_input/tail/"
+const LifecyclePolicyPath = "/_ilm/policy/"
 
 type Metadata struct {
 	// MStore completes direct access to metadata physical storage
@@ -29,6 +32,10 @@ type Metadata struct {
 	AliasTermsCache *cache.Cache
 	// TemplateCache caches { name -> IndexTemplate }
 	TemplateCache *cache.Cache
+	// PipelineCache caches { id -> Pipeline }
+	PipelineCache *cache.Cache
+	// LifecyclePolicyCache caches { name -> LifecyclePolicy }
+	LifecyclePolicyCache *cache.Cache
 }
 
 var metadata *Metadata
@@ -62,6 +69,14 @@ func (m *Metadata) initMetadata() {
 		logger.Panic("load index templates failed", zap.Error(err))
 	}
 
+	if err := m.loadPipelines(); err != nil {
+		logger.Panic("load pipelines failed", zap.Error(err))
+	}
+
+	if err := m.loadLifecyclePolicies(); err != nil {
+		logger.Panic("load lifecycle policies failed", zap.Error(err))
+	}
+
 	if err := m.initialRevise(); err != nil {
 		logger.Panic("revise meta failed", zap.Error(err))
 	}
@@ -185,6 +200,44 @@ func (m *Metadata) loadIndexTemplates() error {
 	return nil
 }
 
+func (m *Metadata) loadPipelines() error {
+	m.PipelineCache = cache.New(
+		cache.NoExpiration,
+		cache.NoExpiration,
+	)
+	bytesMap, err := m.MStore.List(PipelinePath)
+	if err != nil {
+		return err
+	}
+	for _, bytes := range bytesMap {
+		pipeline := &protocol.Pipeline{}
+		if err := json.Unmarshal(bytes, pipeline); err != nil {
+			return err
+		}
+		m.PipelineCache.Set(pipeline.ID, pipeline, cache.NoExpiration)
+	}
+	return nil
+}
+
+func (m *Metadata) loadLifecyclePolicies() error {
+	m.LifecyclePolicyCache = cache.New(
+		cache.NoExpiration,
+		cache.NoExpiration,
+	)
+	bytesMap, err := m.MStore.List(LifecyclePolicyPath)
+	if err != nil {
+		return err
+	}
+	for _, bytes := range bytesMap {
+		policy := &protocol.LifecyclePolicy{}
+		if err := json.Unmarshal(bytes, policy); err != nil {
+			return err
+		}
+		m.LifecyclePolicyCache.Set(policy.Name, policy, cache.NoExpiration)
+	}
+	return nil
+}
+
 func aliasTermKey(index, alias string) string {
 	return fmt.Sprintf("%s&&%s", index, alias)
 }
@@ -0,0 +1,68 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package metadata
+
+import (
+	"encoding/json"
+
+	cache "github.com/patrickmn/go-cache"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/common/log/logger"
+	"github.com/tatris-io/tatris/internal/common/utils"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"go.uber.org/zap"
+)
+
+// SavePipeline creates or replaces the ingest pipeline, the pipeline should have been validated
+func SavePipeline(pipeline *protocol.Pipeline) error {
+	if err := utils.ValidateResourceName(pipeline.ID); err != nil {
+		return err
+	}
+	json, err := json.Marshal(pipeline)
+	if err != nil {
+		return err
+	}
+	logger.Info("save pipeline", zap.String("pipeline", string(json)))
+	if err := Instance().MStore.Set(pipelinePrefix(pipeline.ID), json); err != nil {
+		return err
+	}
+	Instance().PipelineCache.Set(pipeline.ID, pipeline, cache.NoExpiration)
+	return nil
+}
+
+// ResolvePipelines resolves the ingest pipelines by an expression, which may be a native id or a
+// wildcard.
+// errs.PipelineNotFoundError will be returned if the expression does not match any pipelines.
+func ResolvePipelines(exp string) ([]*protocol.Pipeline, error) {
+	results := make([]*protocol.Pipeline, 0)
+	for id, item := range Instance().PipelineCache.Items() {
+		if utils.WildcardMatch(exp, id) {
+			results = append(results, item.Object.(*protocol.Pipeline))
+		}
+	}
+	if len(results) == 0 {
+		return nil, &errs.PipelineNotFoundError{Pipeline: exp}
+	}
+	return results, nil
+}
+
+// GetPipelineExplicitly gets the ingest pipeline precisely by id
+func GetPipelineExplicitly(id string) (*protocol.Pipeline, error) {
+	if cached, found := Instance().PipelineCache.Get(id); found {
+		return cached.(*protocol.Pipeline), nil
+	}
+	return nil, &errs.PipelineNotFoundError{Pipeline: id}
+}
+
+func DeletePipeline(id string) error {
+	if _, err := GetPipelineExplicitly(id); err != nil {
+		return err
+	}
+	logger.Info("delete pipeline", zap.String("pipeline", id))
+	Instance().PipelineCache.Delete(id)
+	return Instance().MStore.Delete(pipelinePrefix(id))
+}
+
+func pipelinePrefix(id string) string {
+	return PipelinePath + id
+}
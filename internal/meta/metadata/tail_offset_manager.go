@@ -0,0 +1,42 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package metadata
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+// SaveTailOffset persists the offset of a tailed file
+func SaveTailOffset(offset *protocol.TailOffset) error {
+	json, err := json.Marshal(offset)
+	if err != nil {
+		return err
+	}
+	return Instance().MStore.Set(tailOffsetPrefix(offset.Path), json)
+}
+
+// GetTailOffset gets the persisted offset of a tailed file, nil if the file has not been tailed
+func GetTailOffset(path string) (*protocol.TailOffset, error) {
+	bytes, err := Instance().MStore.Get(tailOffsetPrefix(path))
+	if err != nil || bytes == nil {
+		return nil, err
+	}
+	offset := &protocol.TailOffset{}
+	if err = json.Unmarshal(bytes, offset); err != nil {
+		return nil, err
+	}
+	return offset, nil
+}
+
+func DeleteTailOffset(path string) error {
+	return Instance().MStore.Delete(tailOffsetPrefix(path))
+}
+
+// tailOffsetPrefix escapes the path of the file, whose slashes would be regarded as the levels of
+// the metadata
+func tailOffsetPrefix(path string) string {
+	return TailOffsetPath + url.PathEscape(path)
+}
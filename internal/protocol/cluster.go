@@ -18,6 +18,15 @@ type ClusterStatus struct {
 	NumberOfInFlightFetch       int     `json:"number_of_in_flight_fetch"`
 	TaskMaxWaitingInQueueMills  int64   `json:"task_max_waiting_in_queue_millis"`
 	ActiveShardsPercentAsNumber float64 `json:"active_shards_percent_as_number"`
+	// WalRecovery is the progress of recovering the WALs left by the last run
+	WalRecovery *WalRecovery `json:"wal_recovery,omitempty"`
+}
+
+type WalRecovery struct {
+	Total     int  `json:"total"`
+	Recovered int  `json:"recovered"`
+	Failed    int  `json:"failed"`
+	Done      bool `json:"done"`
 }
 
 type ClusterInfo struct {
@@ -2,4 +2,74 @@
 
 package protocol
 
+import "strings"
+
 type Document map[string]any
+
+// A field is addressed by its name, or by a dotted path through the nested objects, e.g. `a.b`
+// addresses doc["a.b"] if it exists, otherwise doc["a"]["b"].
+
+// Get returns the value of the field
+func (doc Document) Get(field string) (any, bool) {
+	if value, ok := doc[field]; ok {
+		return value, true
+	}
+	parts := strings.Split(field, ".")
+	var current map[string]any = doc
+	for i, part := range parts {
+		value, ok := current[part]
+		if !ok {
+			return nil, false
+		}
+		if i == len(parts)-1 {
+			return value, true
+		}
+		if current, ok = value.(map[string]any); !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// Set sets the field through the existing nested objects, the field is set as a whole name if
+// the path does not lead to an object
+func (doc Document) Set(field string, value any) {
+	if _, ok := doc[field]; ok || !strings.Contains(field, ".") {
+		doc[field] = value
+		return
+	}
+	if parent, name, ok := doc.parentOf(field); ok {
+		parent[name] = value
+		return
+	}
+	doc[field] = value
+}
+
+// Remove removes the field, it returns whether the field exists
+func (doc Document) Remove(field string) bool {
+	if _, ok := doc[field]; ok {
+		delete(doc, field)
+		return true
+	}
+	if parent, name, ok := doc.parentOf(field); ok {
+		if _, exist := parent[name]; exist {
+			delete(parent, name)
+			return true
+		}
+	}
+	return false
+}
+
+// parentOf returns the object holding the last part of the dotted path
+func (doc Document) parentOf(field string) (map[string]any, string, bool) {
+	parts := strings.Split(field, ".")
+	var current map[string]any = doc
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := current[part].(map[string]any)
+		if !ok {
+			return nil, "", false
+		}
+		current = child
+	}
+	return current, parts[len(parts)-1], true
+}
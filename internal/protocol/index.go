@@ -2,6 +2,13 @@
 
 package protocol
 
+import (
+	"time"
+
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/xhit/go-str2duration/v2"
+)
+
 type CreateIndexResponse struct {
 	*Response
 	ShardsAcknowledged bool   `json:"shards_acknowledged,string,omitempty"`
@@ -24,6 +31,62 @@ type Settings struct {
 	NumberOfShards int `json:"number_of_shards,omitempty"`
 	// number of replicas, default is 1 (ie one replica for each primary shard)
 	NumberOfReplicas int `json:"number_of_replicas,omitempty"`
+	// the pipeline to pre-process the ingested documents if no pipeline is specified by the
+	// request, `_none` means no pipeline
+	DefaultPipeline string `json:"default_pipeline,omitempty"`
+	// the dead-letter target of the rejected documents, the rejected documents fail their requests
+	// if it is not enabled
+	DeadLetter *DeadLetter `json:"dead_letter,omitempty"`
+	// how long the documents are retained by their event time, such as `7d`, the mature segments
+	// whose documents are all older than that are dropped, empty means forever
+	Retention string `json:"retention,omitempty"`
+	// the lifecycle policy managing the index
+	Lifecycle *Lifecycle `json:"lifecycle,omitempty"`
+}
+
+// DeadLetter specifies where to write the documents rejected by the mappings or the index writer,
+// so that the ingestion problems can be debugged after the fact. The rejected documents are
+// written with their sources as strings along with the types and reasons of the errors, and the
+// rest of the documents are still accepted.
+type DeadLetter struct {
+	Enabled bool `json:"enabled"`
+	// the index to write the rejected documents into, `<index>-dlq` by default
+	Index string `json:"index,omitempty"`
+}
+
+// DeadLetterIndex returns the dead-letter index of the index, empty if it is not enabled
+func (s *Settings) DeadLetterIndex(index string) string {
+	if s == nil || s.DeadLetter == nil || !s.DeadLetter.Enabled {
+		return ""
+	}
+	if s.DeadLetter.Index != "" {
+		return s.DeadLetter.Index
+	}
+	return index + consts.DeadLetterIndexSuffix
+}
+
+// RetentionPeriod returns how long the documents of the index are retained, 0 means forever
+func (s *Settings) RetentionPeriod() (time.Duration, error) {
+	if s == nil || s.Retention == "" {
+		return 0, nil
+	}
+	return str2duration.ParseDuration(s.Retention)
+}
+
+// LifecycleName returns the name of the lifecycle policy of the index, empty if it is not managed
+func (s *Settings) LifecycleName() string {
+	if s == nil || s.Lifecycle == nil {
+		return ""
+	}
+	return s.Lifecycle.Name
+}
+
+// RolloverAlias returns the rollover alias of the index, empty if it has none
+func (s *Settings) RolloverAlias() string {
+	if s == nil || s.Lifecycle == nil {
+		return ""
+	}
+	return s.Lifecycle.RolloverAlias
 }
 
 // Mappings is the process of defining how a document, and the fields it contains, are
@@ -44,6 +107,18 @@ type Mappings struct {
 	DynamicTemplates []map[string]*DynamicTemplate `json:"dynamic_templates,omitempty"`
 	// Type mappings, object fields and nested fields contain subfields, called properties.
 	Properties map[string]*Property `json:"properties,omitempty"`
+	// Timestamp specifies the field carrying the event time of the documents.
+	Timestamp *Timestamp `json:"_timestamp,omitempty"`
+}
+
+// Timestamp specifies the event-time field of the documents, which is used to collect the time
+// stats of segments and to prune segments by the time range of queries.
+type Timestamp struct {
+	// the field name or the dotted path to a subfield, `@timestamp` by default
+	Field string `json:"field,omitempty"`
+	// the format of the field values, which is one of `ISO8601`, `UNIX`, `UNIX_MS` or a Java-style
+	// pattern, the values are parsed automatically if it is not specified
+	Format string `json:"format,omitempty"`
 }
 
 type DynamicTemplate struct {
@@ -52,7 +127,8 @@ type DynamicTemplate struct {
 	MatchPattern     string                  `json:"match_pattern"`
 	Match            string                  `json:"match"`
 	Unmatch          string                  `json:"unmatch"`
-	// TODO: PathMatch and PathUnmatch will be enabled after nested types are supported
+	// PathMatch and PathUnmatch work like Match and Unmatch, but operate on the full dotted path
+	// to the field, not just the final name, e.g. `kubernetes.labels.*`.
 	PathMatch   string `json:"path_match"`
 	PathUnmatch string `json:"path_unmatch"`
 }
@@ -66,4 +142,81 @@ type Property struct {
 	Type string `json:"type,omitempty"`
 	// field-level mapping mode
 	Dynamic string `json:"dynamic,omitempty"`
+	// subfields of an object field, addressed by dotted paths like `kubernetes.pod.name`
+	Properties map[string]*Property `json:"properties,omitempty"`
+}
+
+// TimestampField returns the field carrying the event time of the documents
+func (m *Mappings) TimestampField() string {
+	if m != nil && m.Timestamp != nil && m.Timestamp.Field != "" {
+		return m.Timestamp.Field
+	}
+	return consts.TimestampField
+}
+
+// TimestampFormat returns the format of the event-time field, empty means any supported format
+func (m *Mappings) TimestampFormat() string {
+	if m != nil && m.Timestamp != nil {
+		return m.Timestamp.Format
+	}
+	return ""
+}
+
+// GetProperty returns the property of a field addressed by its dotted path, the subfields of
+// object fields are looked up through their nested properties.
+func (m *Mappings) GetProperty(path string) (*Property, bool) {
+	return GetProperty(m.Properties, path)
+}
+
+// GetProperty looks up the property of a field addressed by its dotted path in the properties.
+func GetProperty(properties map[string]*Property, path string) (*Property, bool) {
+	if property, ok := properties[path]; ok {
+		return property, true
+	}
+	// the field name itself may contain dots, try every prefix of the path
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		if property, ok := properties[path[:i]]; ok && property.Properties != nil {
+			if sub, ok := GetProperty(property.Properties, path[i+1:]); ok {
+				return sub, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// PutProperty puts the property of a field addressed by its dotted path into the properties, the
+// missing object properties on the path are created. The object properties on the path are copied
+// before they are changed because the mappings may be read concurrently.
+func PutProperty(properties map[string]*Property, field string, property *Property) {
+	for i := 0; i < len(field); i++ {
+		if field[i] != '.' {
+			continue
+		}
+		parent, ok := properties[field[:i]]
+		if ok && parent.Properties == nil {
+			// the prefix is a leaf field, the dot must be part of the field name
+			continue
+		}
+		object := &Property{
+			Type:       consts.MappingFieldTypeObject,
+			Dynamic:    property.Dynamic,
+			Properties: make(map[string]*Property),
+		}
+		if ok {
+			object.Type, object.Dynamic = parent.Type, parent.Dynamic
+			for name, sub := range parent.Properties {
+				object.Properties[name] = sub
+			}
+		}
+		properties[field[:i]] = object
+		PutProperty(object.Properties, field[i+1:], property)
+		return
+	}
+	properties[field] = &Property{
+		Type:    property.Type,
+		Dynamic: property.Dynamic,
+	}
 }
@@ -3,19 +3,25 @@
 package protocol
 
 type IngestResponse struct {
-	Took  int64         `json:"took,omitempty"`
-	Error bool          `json:"error,omitempty"`
-	Items []*IngestItem `json:"items,omitempty"`
+	Took int64 `json:"took,omitempty"`
+	// Error is true if any of the items failed
+	Error bool `json:"errors"`
+	// Items contains the result of each action in the order they were requested, every item is
+	// keyed by its action name
+	Items []map[string]*IngestItem `json:"items,omitempty"`
 }
 
 type IngestItem struct {
-	Index       string `json:"_index"`
-	Type        string `json:"_type"`
-	ID          string `json:"_id"`
-	Version     string `json:"_version"`
-	Shards      Shards `json:"_shards"`
-	SeqNo       int64  `json:"_seq_no"`
-	PrimaryTerm int    `json:"_primary_term"`
+	Index       string  `json:"_index"`
+	Type        string  `json:"_type"`
+	ID          string  `json:"_id"`
+	Version     string  `json:"_version,omitempty"`
+	Result      string  `json:"result,omitempty"`
+	Shards      *Shards `json:"_shards,omitempty"`
+	SeqNo       int64   `json:"_seq_no,omitempty"`
+	PrimaryTerm int     `json:"_primary_term,omitempty"`
+	Status      int     `json:"status"`
+	Error       *Err    `json:"error,omitempty"`
 }
 
 type IngestRequest struct {
@@ -26,6 +32,39 @@ type IngestRequest struct {
 type BulkAction map[string]*BulkMeta
 
 type BulkMeta struct {
-	Index string `json:"_index"`
-	ID    string `json:"_id"`
+	Index   string `json:"_index"`
+	ID      string `json:"_id"`
+	Routing string `json:"routing,omitempty"`
+	// Pipeline pre-processes the document of the action, it overrides the pipeline of the request
+	Pipeline string `json:"pipeline,omitempty"`
+}
+
+// BulkUpdate is the document line of an update action in the bulk request
+type BulkUpdate struct {
+	// Doc is the partial document to be merged into the existing document
+	Doc Document `json:"doc"`
+	// DocAsUpsert indicates to use Doc as the new document if the document does not exist
+	DocAsUpsert bool `json:"doc_as_upsert"`
+	// Upsert is the new document if the document does not exist
+	Upsert Document `json:"upsert"`
+}
+
+// Operation is an action applied to a document, it is the unit that is written to the WAL.
+type Operation struct {
+	// Action is one of create, index, update and delete
+	Action string `json:"_action"`
+	// ID is the _id of the document that the operation acts on
+	ID string `json:"_id"`
+	// Routing decides which shard the operation is routed to, use ID if it is empty
+	Routing string `json:"-"`
+	// Pipeline pre-processes the document of create and index, use the default pipeline of the
+	// index if it is empty
+	Pipeline string `json:"-"`
+	// Document is the whole document for create and index, or the partial document for update
+	Document Document `json:"_source,omitempty"`
+	// Upsert is the document to be indexed by update when the document does not exist
+	Upsert Document `json:"_upsert,omitempty"`
+	// AutoID is true if the _id of create or index is generated, such a document never conflicts
+	// with or replaces the existing ones
+	AutoID bool `json:"_auto_id,omitempty"`
 }
@@ -0,0 +1,164 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package protocol
+
+// the phases of the lifecycle policies, an index goes through them in order
+const (
+	// LifecyclePhaseNew is where an index starts before it enters the first phase of its policy
+	LifecyclePhaseNew    = "new"
+	LifecyclePhaseHot    = "hot"
+	LifecyclePhaseWarm   = "warm"
+	LifecyclePhaseDelete = "delete"
+)
+
+// LifecyclePhaseNames are the names of the phases in the order an index goes through them
+var LifecyclePhaseNames = []string{LifecyclePhaseHot, LifecyclePhaseWarm, LifecyclePhaseDelete}
+
+// the actions of the lifecycle policies, the actions of a phase are taken in order
+const (
+	LifecycleActionRollover   = "rollover"
+	LifecycleActionForceMerge = "forcemerge"
+	LifecycleActionMigrate    = "migrate"
+	LifecycleActionDelete     = "delete"
+	// LifecycleActionComplete means all the actions of the phase have been taken
+	LifecycleActionComplete = "complete"
+)
+
+// LifecyclePolicy manages the indexes attached to it through the hot, warm and delete phases, an
+// index enters a phase once it is older than the min_age of the phase and the actions of the
+// previous phase are completed
+type LifecyclePolicy struct {
+	// Name is the name of the policy, it is taken from the path of the request
+	Name   string           `json:"name,omitempty"`
+	Phases *LifecyclePhases `json:"phases"`
+	// ModifiedDate is the time when the policy is saved in milliseconds
+	ModifiedDate int64 `json:"modified_date,omitempty"`
+}
+
+type LifecyclePhases struct {
+	Hot    *LifecyclePhase `json:"hot,omitempty"`
+	Warm   *LifecyclePhase `json:"warm,omitempty"`
+	Delete *LifecyclePhase `json:"delete,omitempty"`
+}
+
+type LifecyclePhase struct {
+	// MinAge is how old an index is when it enters the phase, such as `7d`, the age of an index
+	// counts from its creation, or from its rollover if it has been rolled over
+	MinAge  string            `json:"min_age,omitempty"`
+	Actions *LifecycleActions `json:"actions,omitempty"`
+}
+
+type LifecycleActions struct {
+	Rollover   *RolloverAction   `json:"rollover,omitempty"`
+	ForceMerge *ForceMergeAction `json:"forcemerge,omitempty"`
+	Migrate    *MigrateAction    `json:"migrate,omitempty"`
+	Delete     *DeleteAction     `json:"delete,omitempty"`
+}
+
+// RolloverAction creates a new index for the rollover alias of the index once any of the
+// conditions is met, the writes to the alias go to the new index afterwards
+type RolloverAction struct {
+	// the age of the index, such as `1d`
+	MaxAge string `json:"max_age,omitempty"`
+	// the number of the documents of the index
+	MaxDocs int64 `json:"max_docs,omitempty"`
+}
+
+// ForceMergeAction merges the readonly segments of the index regardless of their number
+type ForceMergeAction struct {
+	// a merged segment holds at most this many documents, segment.merge.max_docs by default
+	MaxDocs int64 `json:"max_docs,omitempty"`
+}
+
+// MigrateAction moves the readonly segments of the index from the local file system to the object
+// storage in the way of segment.tiering, the segments matured afterwards are left to the tiering
+type MigrateAction struct{}
+
+// DeleteAction deletes the index
+type DeleteAction struct{}
+
+// Lifecycle attaches an index to a lifecycle policy
+type Lifecycle struct {
+	// the name of the policy
+	Name string `json:"name"`
+	// the alias that the writes go through, which is required by the rollover action
+	RolloverAlias string `json:"rollover_alias,omitempty"`
+}
+
+// LifecycleState is where an index is in its lifecycle policy
+type LifecycleState struct {
+	Phase     string `json:"phase"`
+	PhaseTime int64  `json:"phase_time_millis"`
+	// the action being taken, or `complete` if all the actions of the phase have been taken
+	Action     string `json:"action"`
+	ActionTime int64  `json:"action_time_millis"`
+	// the time when the index is rolled over, 0 means it is still the write index of its alias
+	RolloverTime int64 `json:"rollover_time_millis,omitempty"`
+	// the error of the last attempt of the action, the action is retried later
+	Error string `json:"error,omitempty"`
+}
+
+// LifecyclePolicyRequest is the body of `PUT /_ilm/policy/:policy`
+type LifecyclePolicyRequest struct {
+	Policy *LifecyclePolicy `json:"policy"`
+}
+
+// LifecyclePolicyResponse is the policy returned by `GET /_ilm/policy`, keyed by its name
+type LifecyclePolicyResponse struct {
+	ModifiedDate int64            `json:"modified_date_millis"`
+	Policy       *LifecyclePolicy `json:"policy"`
+}
+
+// LifecycleExplainResponse is returned by `GET /:index/_ilm/explain`
+type LifecycleExplainResponse struct {
+	Indices map[string]*LifecycleExplain `json:"indices"`
+}
+
+// LifecycleExplain is where an index is in its lifecycle policy
+type LifecycleExplain struct {
+	Index        string `json:"index"`
+	Managed      bool   `json:"managed"`
+	Policy       string `json:"policy,omitempty"`
+	CreationDate int64  `json:"index_creation_date_millis,omitempty"`
+	// the age of the index in milliseconds
+	Age int64 `json:"age_millis,omitempty"`
+	*LifecycleState
+}
+
+// Phase returns the phase of the name, nil if it is not defined
+func (p *LifecyclePolicy) Phase(name string) *LifecyclePhase {
+	if p == nil || p.Phases == nil {
+		return nil
+	}
+	switch name {
+	case LifecyclePhaseHot:
+		return p.Phases.Hot
+	case LifecyclePhaseWarm:
+		return p.Phases.Warm
+	case LifecyclePhaseDelete:
+		return p.Phases.Delete
+	default:
+		return nil
+	}
+}
+
+// ActionNames returns the names of the actions of the phase in the order they are taken
+func (p *LifecyclePhase) ActionNames() []string {
+	names := make([]string, 0)
+	if p == nil || p.Actions == nil {
+		return names
+	}
+	if p.Actions.Rollover != nil {
+		names = append(names, LifecycleActionRollover)
+	}
+	if p.Actions.ForceMerge != nil {
+		names = append(names, LifecycleActionForceMerge)
+	}
+	if p.Actions.Migrate != nil {
+		names = append(names, LifecycleActionMigrate)
+	}
+	if p.Actions.Delete != nil {
+		names = append(names, LifecycleActionDelete)
+	}
+	return names
+}
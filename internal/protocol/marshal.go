@@ -27,6 +27,40 @@ func (s *Settings) UnmarshalJSON(data []byte) error {
 	if numberOfReplicas.Exists() {
 		s.NumberOfReplicas = int(numberOfReplicas.Int())
 	}
+
+	defaultPipeline := result.Get("default_pipeline")
+	if !defaultPipeline.Exists() {
+		defaultPipeline = result.Get("index.default_pipeline")
+	}
+	if defaultPipeline.Exists() {
+		s.DefaultPipeline = defaultPipeline.String()
+	}
+
+	deadLetter := result.Get("dead_letter")
+	if !deadLetter.Exists() {
+		deadLetter = result.Get("index.dead_letter")
+	}
+	if deadLetter.Exists() {
+		s.DeadLetter = &DeadLetter{}
+		err = json.Unmarshal([]byte(deadLetter.Raw), s.DeadLetter)
+	}
+
+	retention := result.Get("retention")
+	if !retention.Exists() {
+		retention = result.Get("index.retention")
+	}
+	if retention.Exists() {
+		s.Retention = retention.String()
+	}
+
+	lifecycle := result.Get("lifecycle")
+	if !lifecycle.Exists() {
+		lifecycle = result.Get("index.lifecycle")
+	}
+	if lifecycle.Exists() && err == nil {
+		s.Lifecycle = &Lifecycle{}
+		err = json.Unmarshal([]byte(lifecycle.Raw), s.Lifecycle)
+	}
 	return err
 }
 
@@ -171,3 +205,24 @@ func (r *RangeVal) UnmarshalJSON(data []byte) error {
 	r.Lte = tmp.Lte
 	return nil
 }
+
+func (s *Strings) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = Strings{str}
+		return nil
+	}
+	var strs []string
+	if err := json.Unmarshal(data, &strs); err != nil {
+		return err
+	}
+	*s = strs
+	return nil
+}
+
+func (s Strings) MarshalJSON() ([]byte, error) {
+	if len(s) == 1 {
+		return json.Marshal(s[0])
+	}
+	return json.Marshal([]string(s))
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package protocol
+
+// Pipeline is a sequence of processors that pre-process the documents before they are ingested
+type Pipeline struct {
+	// ID is the identifier of the pipeline, it is taken from the path of the request
+	ID          string      `json:"id,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Processors  []Processor `json:"processors"`
+}
+
+// Processor is keyed by its type, e.g. `{"rename": {"field": "a", "target_field": "b"}}`
+type Processor map[string]*ProcessorConfig
+
+// ProcessorConfig is the union of the options of all the processors, each processor only reads
+// its own options
+type ProcessorConfig struct {
+	// Field is the field to be processed, only remove accepts more than one field
+	Field Strings `json:"field,omitempty"`
+	// TargetField is the field to assign the result to, it defaults to Field for most processors
+	TargetField string `json:"target_field,omitempty"`
+	// Value is the value to be set by set, `{{field}}` in a string value is replaced with the
+	// value of the field
+	Value any `json:"value,omitempty"`
+	// Override indicates whether set overrides the field with a non-null value, default is true
+	Override *bool `json:"override,omitempty"`
+	// Type is the type that convert converts to: integer, long, float, double, boolean, string
+	// or auto
+	Type string `json:"type,omitempty"`
+	// Formats are the formats tried in order by date: ISO8601, UNIX, UNIX_MS or a Java-style
+	// pattern such as `dd/MMM/yyyy:HH:mm:ss Z`
+	Formats []string `json:"formats,omitempty"`
+	// Timezone is the timezone used by date if the parsed value has no timezone
+	Timezone string `json:"timezone,omitempty"`
+	// Patterns are the grok patterns tried in order
+	Patterns []string `json:"patterns,omitempty"`
+	// PatternDefinitions defines custom grok patterns
+	PatternDefinitions map[string]string `json:"pattern_definitions,omitempty"`
+	// Pattern is the dissect pattern
+	Pattern string `json:"pattern,omitempty"`
+	// AppendSeparator joins the values appended to the same key by dissect, default is ""
+	AppendSeparator string `json:"append_separator,omitempty"`
+	// Separator is the regular expression that split splits by
+	Separator string `json:"separator,omitempty"`
+	// AddToRoot indicates that json merges the parsed object into the root of the document
+	AddToRoot bool `json:"add_to_root,omitempty"`
+	// IgnoreMissing indicates to skip the document silently if the field does not exist
+	IgnoreMissing bool `json:"ignore_missing,omitempty"`
+	// IgnoreFailure indicates to continue the pipeline if the processor fails
+	IgnoreFailure bool `json:"ignore_failure,omitempty"`
+	// If is the condition to run the processor, such as `ctx.level == 'debug'`
+	If string `json:"if,omitempty"`
+	// Tag is an identifier of the processor, for debugging only
+	Tag string `json:"tag,omitempty"`
+}
+
+// Strings is a list of strings, which is marshalled as a single string if it has one element
+type Strings []string
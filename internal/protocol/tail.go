@@ -0,0 +1,15 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package protocol
+
+// TailOffset records how far a file has been tailed, so that the tailing resumes from the offset
+// after restarts
+type TailOffset struct {
+	Path string `json:"path"`
+	// Offset is where the next read starts, the lines before it have been ingested
+	Offset int64 `json:"offset"`
+	// Head is the hash of the first HeadSize bytes of the file, a file whose head differs is
+	// regarded as a new file, e.g. after the file is rotated
+	Head     string `json:"head"`
+	HeadSize int64  `json:"head_size"`
+}
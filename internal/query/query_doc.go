@@ -38,14 +38,19 @@ func SearchDocs(
 	if request.From < 0 {
 		request.From = 0
 	}
-	start, end, err := resolveTimeRange(request.Index, request.Query)
-	if err != nil {
-		return nil, err
-	}
 	indexNames := make([]string, len(indexes))
 	var allSegments []*core.Segment
 	for i, index := range indexes {
 		indexNames[i] = index.GetName()
+		// the indexes may carry their event time in different fields
+		start, end, err := resolveTimeRange(
+			index.GetName(),
+			index.Mappings.TimestampField(),
+			request.Query,
+		)
+		if err != nil {
+			return nil, err
+		}
 		segments := index.GetSegmentsByTime(start, end)
 		allSegments = append(allSegments, segments...)
 	}
@@ -161,8 +166,12 @@ func emptyResult() *protocol.QueryResponse {
 	}
 }
 
-func resolveTimeRange(index string, query protocol.Query) (int64, int64, error) {
-	start, end, err := timeRange(query)
+func resolveTimeRange(
+	index string,
+	timestampField string,
+	query protocol.Query,
+) (int64, int64, error) {
+	start, end, err := timeRange(timestampField, query)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -192,11 +201,11 @@ func resolveTimeRange(index string, query protocol.Query) (int64, int64, error)
 	return start, end, nil
 }
 
-func timeRange(query protocol.Query) (int64, int64, error) {
+func timeRange(timestampField string, query protocol.Query) (int64, int64, error) {
 	var start, end int64
 	var err error
 	if query.Range != nil {
-		timeRange, ok := query.Range[consts.TimestampField]
+		timeRange, ok := query.Range[timestampField]
 		if ok {
 			if timeRange.Gt != nil {
 				t, err := utils.ParseTime(timeRange.Gt)
@@ -234,7 +243,7 @@ func timeRange(query protocol.Query) (int64, int64, error) {
 		subQueries = append(subQueries, query.Bool.Should...)
 		subQueries = append(subQueries, query.Bool.Filter...)
 		for _, subQuery := range subQueries {
-			start, end, err = timeRange(*subQuery)
+			start, end, err = timeRange(timestampField, *subQuery)
 			if err != nil || start > 0 || end > 0 {
 				return start, end, err
 			}
@@ -474,7 +483,7 @@ func validateAggFieldType(
 	aggName string,
 	aggType string,
 ) error {
-	if fieldType, ok := mappings.Properties[field]; ok {
+	if fieldType, ok := mappings.GetProperty(field); ok {
 		ok, lType := indexlib.ValidateMappingType(fieldType.Type)
 		if ok && lType.Type != needFieldType {
 			return &errs.InvalidAggFieldTypeError{
@@ -535,7 +544,8 @@ func transformMatch(
 	}
 	// The match query does not match when the bluge keyword field value contains uppercase letters
 	// Set KEYWORD analyzer
-	if mappings.Properties[matchQ.Field].Type == consts.LibFieldTypeKeyword {
+	if property, ok := mappings.GetProperty(matchQ.Field); ok &&
+		property.Type == consts.LibFieldTypeKeyword {
 		matchQ.Analyzer = "KEYWORD"
 	}
 	return matchQ, nil
@@ -708,7 +718,7 @@ func transformRange(
 	}
 	rangeQ := indexlib.NewRangeQuery()
 	for k, v := range rangeQuery {
-		property, found := mappings.Properties[k]
+		property, found := mappings.GetProperty(k)
 		if !found {
 			return nil, &errs.InvalidFieldError{Field: k, Message: "not found"}
 		}
@@ -6,7 +6,9 @@ package handler
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"io"
+	"net/http"
 	"strings"
 	"time"
 
@@ -24,48 +26,167 @@ import (
 // maxBytesOfLine limits the maximum bytes that can be read for each line of the bulk request
 const maxBytesOfLine = 1024 * 1024 * 4
 
+// bulkItem is an operation in the bulk request along with the index it acts on
+type bulkItem struct {
+	index string
+	op    *protocol.Operation
+}
+
+// BulkHandler handles the bulk request and reports the result of each action separately, so the
+// failure of an action does not prevent the others from being ingested.
+// The actions routed to the shards whose WAL lags too much are rejected with 429, the whole
+// request is answered with 429 if all the actions are rejected so.
 func BulkHandler(c *gin.Context) {
 	start := time.Now()
 	name := c.Param("index")
-	var index *core.Index
-	var err error
-	documents, err := divideBulk(name, c.Request.Body)
+	refresh, err := refreshPolicy(c)
 	if err != nil {
 		BadRequest(c, err.Error())
-	} else {
-		for idx, docs := range documents {
-			if index, err = metadata.GetIndexExplicitly(idx); err != nil {
-				if errs.IsIndexNotFound(err) {
-					// create the index if it does not exist
-					index = &core.Index{Index: &protocol.Index{Name: idx}}
-					err = metadata.CreateIndex(index)
-				}
-				if err != nil {
-					InternalServerError(c, err.Error())
-					return
-				}
+		return
+	}
+	items, err := divideBulk(name, c.Query("pipeline"), c.Request.Body)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	// group the operations by index, remembering their positions in the request
+	indexes := make([]string, 0)
+	positions := make(map[string][]int)
+	for i, item := range items {
+		if _, ok := positions[item.index]; !ok {
+			indexes = append(indexes, item.index)
+		}
+		positions[item.index] = append(positions[item.index], i)
+	}
+	response := protocol.IngestResponse{Items: make([]map[string]*protocol.IngestItem, len(items))}
+	allResults := make([][]*ingestion.Result, 0, len(indexes))
+	rejected := 0
+	for _, idx := range indexes {
+		ops := make([]*protocol.Operation, len(positions[idx]))
+		for i, position := range positions[idx] {
+			ops[i] = items[position].op
+		}
+		results, err := ingestOperations(idx, ops)
+		allResults = append(allResults, results)
+		for i, position := range positions[idx] {
+			op := items[position].op
+			ingestItem := &protocol.IngestItem{Index: idx, Type: "_doc", ID: op.ID}
+			resultErr := err
+			if resultErr == nil {
+				resultErr = results[i].Err
 			}
-			if err = ingestion.IngestDocs(index, docs); err != nil {
-				InternalServerError(c, err.Error())
-				return
+			if resultErr == nil && results[i].Dropped {
+				// the document is dropped by the pipeline
+				ingestItem.Status, ingestItem.Result = http.StatusOK, "noop"
+			} else if resultErr != nil {
+				if errs.IsWalLagExceed(resultErr) {
+					rejected++
+				}
+				response.Error = true
+				ingestItem.Status, ingestItem.Error = itemError(resultErr)
+			} else {
+				ingestItem.Status, ingestItem.Result = itemResult(op.Action, results[i].Replaced)
+				ingestItem.Shards = &protocol.Shards{Total: 1, Successful: 1}
+				ingestItem.SeqNo = int64(results[i].WalIndex)
+				ingestItem.PrimaryTerm = 1
 			}
+			response.Items[position] = map[string]*protocol.IngestItem{op.Action: ingestItem}
+		}
+	}
+	if err := ingestion.Refresh(refresh, allResults...); err != nil {
+		InternalServerError(c, err.Error())
+		return
+	}
+	response.Took = time.Since(start).Milliseconds()
+	if rejected > 0 {
+		retryAfter(c)
+		if rejected == len(items) {
+			c.JSON(http.StatusTooManyRequests, response)
+			return
+		}
+	}
+	OK(c, response)
+}
+
+// ingestOperations ingests operations into the index, the index is created if it does not exist
+func ingestOperations(name string, ops []*protocol.Operation) ([]*ingestion.Result, error) {
+	index, err := metadata.ResolveWriteIndex(name)
+	if err != nil {
+		if !errs.IsIndexNotFound(err) {
+			return nil, err
+		}
+		index = &core.Index{Index: &protocol.Index{Name: name}}
+		if err = metadata.CreateIndex(index); err != nil {
+			return nil, err
+		}
+	}
+	return ingestion.IngestOperations(index, ops)
+}
+
+// itemResult reports an accepted action, an index replacing an existing document is an update
+func itemResult(action string, replaced bool) (int, string) {
+	switch {
+	case action == consts.ActionUpdate, action == consts.ActionIndex && replaced:
+		return http.StatusOK, "updated"
+	case action == consts.ActionDelete:
+		return http.StatusOK, "deleted"
+	default:
+		return http.StatusCreated, "created"
+	}
+}
+
+func itemError(err error) (int, *protocol.Err) {
+	var fieldErr *errs.InvalidFieldError
+	var fieldValErr *errs.InvalidFieldValError
+	var unsupportedErr *errs.UnsupportedError
+	switch {
+	case errors.As(err, &fieldErr), errors.As(err, &fieldValErr):
+		return http.StatusBadRequest, &protocol.Err{
+			Type:   "mapper_parsing_exception",
+			Reason: err.Error(),
+		}
+	case errors.As(err, &unsupportedErr),
+		errs.IsPipelineNotFound(err),
+		errs.IsProcessorError(err):
+		return http.StatusBadRequest, &protocol.Err{
+			Type:   "illegal_argument_exception",
+			Reason: err.Error(),
+		}
+	case errs.IsDocumentConflict(err):
+		return http.StatusConflict, &protocol.Err{
+			Type:   "version_conflict_engine_exception",
+			Reason: err.Error(),
+		}
+	case errs.IsWalLagExceed(err):
+		return http.StatusTooManyRequests, &protocol.Err{
+			Type:   "es_rejected_execution_exception",
+			Reason: err.Error(),
+		}
+	case errs.IsInvalidResourceNameError(err):
+		return http.StatusBadRequest, &protocol.Err{
+			Type:   "invalid_index_name_exception",
+			Reason: err.Error(),
+		}
+	default:
+		return http.StatusInternalServerError, &protocol.Err{
+			Type:   "exception",
+			Reason: err.Error(),
 		}
 	}
-	OK(c, protocol.IngestResponse{Took: time.Since(start).Milliseconds(), Error: false})
 }
 
-// divideBulk groups the documents in the bulk request by index and returns them.
-// Note that Tatris is currently designed not to allow modification of ingested
-// documents, which means that only the operation CREATE is legal, so we do not need to consider the
-// version of the document operation. If operations INDEX, UPDATE, or DELETE are supported
-// in the future, this function needs to be redesigned.
-func divideBulk(index string, reader io.Reader) (map[string][]protocol.Document, error) {
-	documents := make(map[string][]protocol.Document)
+// divideBulk parses the operations in the bulk request and returns them in order.
+// Actions CREATE and INDEX are followed by a document line, UPDATE is followed by a line carrying
+// the partial document, and DELETE is followed by nothing.
+// The pipeline of an action defaults to the pipeline of the request.
+func divideBulk(index, pipeline string, reader io.Reader) ([]*bulkItem, error) {
+	items := make([]*bulkItem, 0)
 	sc := bufio.NewScanner(reader)
 	buf := make([]byte, maxBytesOfLine)
 	sc.Buffer(buf, maxBytesOfLine)
 	documentLine := false
-	var lastMeta *protocol.BulkMeta
+	var lastOp *protocol.Operation
+	var lastIndex string
 	for sc.Scan() {
 		bytes := sc.Bytes()
 		if len(bytes) == 0 {
@@ -73,31 +194,76 @@ func divideBulk(index string, reader io.Reader) (map[string][]protocol.Document,
 			continue
 		}
 		if documentLine {
-			document := protocol.Document{}
-			if err := json.Unmarshal(bytes, &document); err != nil {
-				return nil, &errs.InvalidBulkError{Message: sc.Text()}
-			}
-			if _, found := document[consts.IDField]; !found {
-				document[consts.IDField] = lastMeta.ID
-			}
-			if lastMeta.Index == "" {
-				lastMeta.Index = index
+			if lastOp.Action == consts.ActionUpdate {
+				update := protocol.BulkUpdate{}
+				if err := json.Unmarshal(bytes, &update); err != nil || update.Doc == nil {
+					return nil, &errs.InvalidBulkError{Message: sc.Text()}
+				}
+				lastOp.Document = update.Doc
+				if update.Upsert != nil {
+					lastOp.Upsert = update.Upsert
+				} else if update.DocAsUpsert {
+					lastOp.Upsert = make(protocol.Document, len(update.Doc))
+					for k, v := range update.Doc {
+						lastOp.Upsert[k] = v
+					}
+				}
+			} else {
+				document := protocol.Document{}
+				if err := json.Unmarshal(bytes, &document); err != nil {
+					return nil, &errs.InvalidBulkError{Message: sc.Text()}
+				}
+				if _, found := document[consts.IDField]; !found {
+					document[consts.IDField] = lastOp.ID
+				}
+				lastOp.Document = document
 			}
-			documents[lastMeta.Index] = append(documents[lastMeta.Index], document)
+			items = append(items, &bulkItem{index: lastIndex, op: lastOp})
 			documentLine = false
 		} else {
 			action := protocol.BulkAction{}
-			if err := json.Unmarshal(bytes, &action); err != nil {
+			if err := json.Unmarshal(bytes, &action); err != nil || len(action) != 1 {
 				return nil, &errs.InvalidBulkError{Message: sc.Text()}
 			}
 			for actionName, actionMeta := range action {
-				if !strings.EqualFold("create", actionName) {
+				actionName = strings.ToLower(actionName)
+				if actionMeta == nil {
+					actionMeta = &protocol.BulkMeta{}
+				}
+				switch actionName {
+				case consts.ActionCreate, consts.ActionIndex:
+				case consts.ActionUpdate, consts.ActionDelete:
+					if actionMeta.ID == "" {
+						return nil, &errs.InvalidBulkError{Message: sc.Text()}
+					}
+				default:
 					return nil, &errs.InvalidBulkError{Message: sc.Text()}
 				}
-				lastMeta = actionMeta
+				lastOp = &protocol.Operation{
+					Action:   actionName,
+					ID:       actionMeta.ID,
+					Routing:  actionMeta.Routing,
+					Pipeline: actionMeta.Pipeline,
+				}
+				if lastOp.Pipeline == "" {
+					lastOp.Pipeline = pipeline
+				}
+				lastIndex = actionMeta.Index
+				if lastIndex == "" {
+					lastIndex = index
+				}
+			}
+			if lastOp.Action == consts.ActionDelete {
+				// there is no document line following a delete action
+				items = append(items, &bulkItem{index: lastIndex, op: lastOp})
+			} else {
+				documentLine = true
 			}
-			documentLine = true
 		}
 	}
-	return documents, nil
+	if documentLine {
+		// the last action is never followed by its document line
+		return nil, &errs.InvalidBulkError{Message: "the last action is not followed by a document"}
+	}
+	return items, nil
 }
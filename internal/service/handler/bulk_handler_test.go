@@ -17,7 +17,9 @@ import (
 	"github.com/tatris-io/tatris/internal/common/consts"
 
 	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
 	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/tatris-io/tatris/internal/query"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -82,3 +84,205 @@ func TestBulkHandler(t *testing.T) {
 		assert.Equal(t, http.StatusOK, w.Code)
 	})
 }
+
+func TestBulkActions(t *testing.T) {
+	// prepare
+	index, err := prepare.CreateIndex(
+		strings.ReplaceAll(
+			time.Now().Format(consts.TimeFmtWithoutSeparator),
+			consts.Dot,
+			consts.Empty,
+		),
+	)
+	if err != nil {
+		t.Fatalf("prepare index fail: %s", err.Error())
+	}
+
+	bulk := func(refresh, body string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.ReleaseMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = &http.Request{
+			URL:    &url.URL{RawQuery: "refresh=" + refresh},
+			Header: make(http.Header),
+		}
+		c.Params = gin.Params{gin.Param{Key: "index", Value: index.Name}}
+		c.Request.Header.Set("Content-Type", "text/plain;charset=utf-8")
+		c.Request.Body = io.NopCloser(bytes.NewBufferString(body))
+		BulkHandler(c)
+		return w
+	}
+	search := func(q protocol.Query) int64 {
+		resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+			Index: index.Name,
+			Query: q,
+			Size:  100,
+		})
+		assert.NoError(t, err)
+		return resp.Hits.Total.Value
+	}
+
+	// test
+	t.Run("test_divide_bulk", func(t *testing.T) {
+		items, err := divideBulk(index.Name, "", bytes.NewBufferString(bulkActionsRequest))
+		assert.NoError(t, err)
+		assert.Equal(t, 5, len(items))
+		ops := make([]*protocol.Operation, len(items))
+		for i, item := range items {
+			assert.Equal(t, index.Name, item.index)
+			ops[i] = item.op
+		}
+		assert.Equal(t, consts.ActionIndex, ops[0].Action)
+		assert.Equal(t, consts.ActionCreate, ops[1].Action)
+		assert.Equal(t, consts.ActionUpdate, ops[2].Action)
+		assert.Equal(t, "Go", ops[2].Document["lang"])
+		assert.Nil(t, ops[2].Upsert)
+		assert.Equal(t, consts.ActionDelete, ops[3].Action)
+		assert.Equal(t, "2", ops[3].ID)
+		assert.NotNil(t, ops[4].Upsert)
+
+		_, err = divideBulk(index.Name, "", bytes.NewBufferString(`{"delete":{}}`))
+		assert.Error(t, err)
+		_, err = divideBulk(index.Name, "", bytes.NewBufferString(`{"upsert":{"_id":"1"}}`))
+		assert.Error(t, err)
+		// the last action is not followed by its document
+		_, err = divideBulk(
+			index.Name,
+			"",
+			bytes.NewBufferString("{\"delete\":{\"_id\":\"1\"}}\n{\"index\":{\"_id\":\"2\"}}\n"),
+		)
+		assert.Error(t, err)
+	})
+
+	t.Run("test_bulk_actions", func(t *testing.T) {
+		w := bulk(consts.RefreshWaitFor, bulkActionsRequest)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int64(2), search(protocol.Query{MatchAll: &protocol.MatchAll{}}))
+		assert.Equal(t, int64(1), search(protocol.Query{Term: protocol.Term{"lang": "Go"}}))
+		assert.Equal(t, int64(1), search(protocol.Query{Term: protocol.Term{"name": "bleve"}}))
+
+		// replace and delete documents persisted in previous batches
+		w = bulk(consts.RefreshWaitFor, `{"index":{"_id":"1"}}
+{"name":"bluge","lang":"Rust"}
+{"delete":{"_id":"3"}}
+`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		resp := protocol.IngestResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, http.StatusOK, resp.Items[0][consts.ActionIndex].Status)
+		assert.Equal(t, "updated", resp.Items[0][consts.ActionIndex].Result)
+		assert.Equal(t, int64(1), search(protocol.Query{MatchAll: &protocol.MatchAll{}}))
+		assert.Equal(t, int64(1), search(protocol.Query{Term: protocol.Term{"lang": "Rust"}}))
+	})
+
+	t.Run("test_bulk_partial_failure", func(t *testing.T) {
+		w := bulk(consts.RefreshWaitFor, `{"create":{"_id":"4"}}
+{"name":"tantivy","stars":"many"}
+{"create":{"_id":"5"}}
+{"name":"tantivy","stars":7485}
+{"delete":{"_id":"1"}}
+`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		resp := protocol.IngestResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.True(t, resp.Error)
+		assert.Equal(t, 3, len(resp.Items))
+		assert.Equal(t, http.StatusBadRequest, resp.Items[0][consts.ActionCreate].Status)
+		assert.NotNil(t, resp.Items[0][consts.ActionCreate].Error)
+		assert.Equal(t, http.StatusCreated, resp.Items[1][consts.ActionCreate].Status)
+		assert.Equal(t, "5", resp.Items[1][consts.ActionCreate].ID)
+		assert.Nil(t, resp.Items[1][consts.ActionCreate].Error)
+		assert.Equal(t, http.StatusOK, resp.Items[2][consts.ActionDelete].Status)
+		assert.Equal(t, int64(1), search(protocol.Query{MatchAll: &protocol.MatchAll{}}))
+		assert.Equal(t, int64(1), search(protocol.Query{Term: protocol.Term{"name": "tantivy"}}))
+	})
+
+	t.Run("test_bulk_conflict", func(t *testing.T) {
+		// _id 5 has been persisted, _id 6 is created twice in the same request
+		w := bulk(consts.RefreshFalse, `{"create":{"_id":"5"}}
+{"name":"tantivy"}
+{"create":{"_id":"6"}}
+{"name":"quickwit"}
+{"create":{"_id":"6"}}
+{"name":"quickwit"}
+{"index":{"_id":"5"}}
+{"name":"tantivy","stars":8000}
+`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		resp := protocol.IngestResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.True(t, resp.Error)
+		assert.Equal(t, http.StatusConflict, resp.Items[0][consts.ActionCreate].Status)
+		assert.Equal(
+			t,
+			"version_conflict_engine_exception",
+			resp.Items[0][consts.ActionCreate].Error.Type,
+		)
+		assert.Equal(t, http.StatusCreated, resp.Items[1][consts.ActionCreate].Status)
+		assert.Equal(t, http.StatusConflict, resp.Items[2][consts.ActionCreate].Status)
+		// _id 5 is replaced rather than created
+		assert.Equal(t, http.StatusOK, resp.Items[3][consts.ActionIndex].Status)
+		assert.Equal(t, "updated", resp.Items[3][consts.ActionIndex].Result)
+
+		// _id 6 is rejected while it is waiting to be consumed as well
+		w = bulk(consts.RefreshFalse, `{"create":{"_id":"6"}}
+{"name":"quickwit"}
+`)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, http.StatusConflict, resp.Items[0][consts.ActionCreate].Status)
+		assert.Eventually(t, func() bool {
+			return search(protocol.Query{MatchAll: &protocol.MatchAll{}}) == 2
+		}, 10*time.Second, 100*time.Millisecond)
+		assert.Equal(t, int64(1), search(protocol.Query{Term: protocol.Term{"name": "tantivy"}}))
+	})
+
+	t.Run("test_bulk_backpressure", func(t *testing.T) {
+		// every shard whose WAL has entries not consumed yet lags more than 1 byte, the writes to
+		// it are rejected until the consumption catches up
+		maxLagBytes := config.Cfg.Wal.MaxLagBytes
+		config.Cfg.Wal.MaxLagBytes = 1
+		defer func() { config.Cfg.Wal.MaxLagBytes = maxLagBytes }()
+		var w *httptest.ResponseRecorder
+		resp := protocol.IngestResponse{}
+		rejected := 0
+		batch := 0
+		assert.Eventually(t, func() bool {
+			body := ""
+			for i := 0; i < 10; i++ {
+				body += fmt.Sprintf(
+					"{\"create\":{\"_id\":\"%d\"}}\n{\"name\":\"bleve\"}\n",
+					100+batch*10+i,
+				)
+			}
+			batch++
+			w = bulk(consts.RefreshFalse, body)
+			resp = protocol.IngestResponse{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			rejected = 0
+			for _, item := range resp.Items {
+				if item[consts.ActionCreate].Status == http.StatusTooManyRequests {
+					rejected++
+				}
+			}
+			return rejected > 0
+		}, 10*time.Second, 10*time.Millisecond)
+		assert.True(t, resp.Error)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		if rejected == len(resp.Items) {
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		} else {
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+	})
+}
+
+const bulkActionsRequest = `{"index":{"_id":"1"}}
+{"name":"bluge","lang":"Java"}
+{"create":{"_id":"2"}}
+{"name":"bleve","lang":"Go"}
+{"update":{"_id":"1"}}
+{"doc":{"lang":"Go"}}
+{"delete":{"_id":"2"}}
+{"update":{"_id":"3"}}
+{"doc":{"name":"bleve"},"doc_as_upsert":true}
+`
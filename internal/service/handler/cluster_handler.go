@@ -8,29 +8,47 @@ import (
 	"github.com/google/uuid"
 	"github.com/tatris-io/tatris/internal/common/consts"
 	"github.com/tatris-io/tatris/internal/common/utils"
+	"github.com/tatris-io/tatris/internal/core/wal"
 	"github.com/tatris-io/tatris/internal/protocol"
 )
 
 // ClusterStatusHandler is used to view the status of the cluster.
-// Right now this is a pseudo-implementation that the started cluster is always considered healthy
-// until we support cluster mode.
+// Right now this is a pseudo-implementation that the started cluster is considered healthy once
+// the WALs left by the last run are recovered, until we support cluster mode.
 func ClusterStatusHandler(c *gin.Context) {
+	recovery := wal.GetRecoveryStatus()
+	status := consts.StatusGreen
+	initializing := 0
+	percent := float64(100)
+	if !recovery.Done {
+		status = consts.StatusRed
+		initializing = recovery.Total - recovery.Recovered - recovery.Failed
+		percent = float64(recovery.Recovered) * 100 / float64(recovery.Total)
+	} else if recovery.Failed > 0 {
+		status = consts.StatusYellow
+	}
 	OK(c, protocol.ClusterStatus{
 		ClusterName:                 "docker-cluster",
-		Status:                      consts.StatusGreen,
+		Status:                      status,
 		TimedOut:                    false,
 		NumberOfNodes:               1,
 		NumberOfDataNodes:           1,
 		ActivePrimaryShards:         1,
 		ActiveShards:                1,
 		RelocationShards:            0,
-		InitializingShards:          0,
+		InitializingShards:          initializing,
 		UnassignedShards:            0,
 		DelayedUnassignedShards:     0,
 		NumberOfPendingTasks:        0,
 		NumberOfInFlightFetch:       0,
 		TaskMaxWaitingInQueueMills:  0,
-		ActiveShardsPercentAsNumber: 100,
+		ActiveShardsPercentAsNumber: percent,
+		WalRecovery: &protocol.WalRecovery{
+			Total:     recovery.Total,
+			Recovered: recovery.Recovered,
+			Failed:    recovery.Failed,
+			Done:      recovery.Done,
+		},
 	})
 }
 
@@ -4,9 +4,14 @@ package handler
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/core/config"
 	"github.com/tatris-io/tatris/internal/protocol"
 )
 
@@ -48,9 +53,55 @@ func BadRequest(c *gin.Context, reason string) {
 	c.JSON(http.StatusBadRequest, response)
 }
 
+// Conflict serialize a response body carrying the reason of the version conflict into the HTTP
+// context and set the status code to 409
+func Conflict(c *gin.Context, reason string) {
+	response := &protocol.Response{
+		Error: &protocol.Error{
+			Err: &protocol.Err{Type: "version_conflict_engine_exception", Reason: reason},
+		},
+	}
+	c.JSON(http.StatusConflict, response)
+}
+
 // InternalServerError serialize a response body carrying the reason of server exception into the
 // HTTP context and set the status code to 500
 func InternalServerError(c *gin.Context, reason string) {
 	response := &protocol.Response{Error: &protocol.Error{Err: &protocol.Err{Reason: reason}}}
 	c.JSON(http.StatusInternalServerError, response)
 }
+
+// TooManyRequests serialize a response body carrying the reason for rejecting the request into the
+// HTTP context, set the status code to 429 and advise the client when to retry
+func TooManyRequests(c *gin.Context, reason string) {
+	response := &protocol.Response{
+		Error: &protocol.Error{
+			Err: &protocol.Err{Type: "es_rejected_execution_exception", Reason: reason},
+		},
+	}
+	retryAfter(c)
+	c.JSON(http.StatusTooManyRequests, response)
+}
+
+// retryAfter sets the Retry-After header in seconds to advise the client when to retry
+func retryAfter(c *gin.Context) {
+	seconds := int(math.Ceil(config.Cfg.Wal.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+}
+
+// refreshPolicy reads the refresh policy of the ingestion from the query parameter `refresh`,
+// a present but empty `refresh` means `true` as Elasticsearch does
+func refreshPolicy(c *gin.Context) (string, error) {
+	refresh, ok := c.GetQuery("refresh")
+	if !ok {
+		return consts.RefreshFalse, nil
+	}
+	switch refresh {
+	case consts.Empty, consts.RefreshTrue:
+		return consts.RefreshTrue, nil
+	case consts.RefreshFalse, consts.RefreshWaitFor:
+		return refresh, nil
+	default:
+		return "", &errs.InvalidFieldValError{Field: "refresh", Type: "string", Value: refresh}
+	}
+}
@@ -20,7 +20,7 @@ func IngestHandler(c *gin.Context) {
 	name := c.Param("index")
 	var index *core.Index
 	var err error
-	if index, err = metadata.GetIndexExplicitly(name); err != nil {
+	if index, err = metadata.ResolveWriteIndex(name); err != nil {
 		if errs.IsIndexNotFound(err) {
 			// create the index if it does not exist
 			index = &core.Index{Index: &protocol.Index{Name: name}}
@@ -29,14 +29,31 @@ func IngestHandler(c *gin.Context) {
 	}
 	if err != nil {
 		InternalServerError(c, err.Error())
+		return
+	}
+	refresh, err := refreshPolicy(c)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	ingestRequest := protocol.IngestRequest{}
+	if err = c.ShouldBind(&ingestRequest); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	results, err := ingestion.IngestDocs(index, ingestRequest.Documents, c.Query("pipeline"))
+	if err == nil {
+		err = ingestion.Refresh(refresh, results)
+	}
+	if errs.IsWalLagExceed(err) {
+		TooManyRequests(c, err.Error())
+	} else if errs.IsDocumentConflict(err) {
+		Conflict(c, err.Error())
+	} else if errs.IsPipelineNotFound(err) || errs.IsProcessorError(err) {
+		BadRequest(c, err.Error())
+	} else if err != nil {
+		InternalServerError(c, err.Error())
 	} else {
-		ingestRequest := protocol.IngestRequest{}
-		if err = c.ShouldBind(&ingestRequest); err != nil {
-			BadRequest(c, err.Error())
-		} else if err = ingestion.IngestDocs(index, ingestRequest.Documents); err != nil {
-			InternalServerError(c, err.Error())
-		} else {
-			OK(c, protocol.IngestResponse{Took: time.Since(start).Milliseconds(), Error: false})
-		}
+		OK(c, protocol.IngestResponse{Took: time.Since(start).Milliseconds(), Error: false})
 	}
 }
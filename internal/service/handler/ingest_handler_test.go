@@ -4,6 +4,7 @@ package handler
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,6 +15,10 @@ import (
 	"time"
 
 	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/tatris-io/tatris/internal/query"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -53,6 +58,104 @@ func TestIngestHandler(t *testing.T) {
 		fmt.Println(w)
 		assert.Equal(t, http.StatusOK, w.Code)
 	})
+
+	t.Run("test_ingest_refresh", func(t *testing.T) {
+		ingestReq := protocol.IngestRequest{}
+		assert.NoError(t, json.Unmarshal([]byte(ingestRequest), &ingestReq))
+		size := len(ingestReq.Documents)
+		gin.SetMode(gin.ReleaseMode)
+		for i, refresh := range []string{"true", "wait_for", "invalid"} {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				URL:    &url.URL{RawQuery: "refresh=" + refresh},
+				Header: make(http.Header),
+			}
+			c.Params = gin.Params{gin.Param{Key: "index", Value: index.Name}}
+			c.Request.Header.Set("Content-Type", "application/json;charset=utf-8")
+			c.Request.Body = io.NopCloser(bytes.NewBufferString(ingestRequest))
+			IngestHandler(c)
+			if refresh == "invalid" {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+				continue
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			// the ingested docs are visible as soon as the request returns
+			resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+				Index: index.Name,
+				Query: protocol.Query{MatchAll: &protocol.MatchAll{}},
+				Size:  0,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(size*(i+2)), resp.Hits.Total.Value)
+		}
+	})
+}
+
+func TestIngestDeadLetter(t *testing.T) {
+	name := "dead_letter_" + strings.ReplaceAll(
+		time.Now().Format(consts.TimeFmtWithoutSeparator),
+		consts.Dot,
+		consts.Empty,
+	)
+	index := &core.Index{Index: &protocol.Index{
+		Name: name,
+		Settings: &protocol.Settings{
+			DeadLetter: &protocol.DeadLetter{Enabled: true},
+		},
+		Mappings: &protocol.Mappings{
+			Dynamic: consts.StrictMappingMode,
+			Properties: map[string]*protocol.Property{
+				"name": {Type: consts.MappingFieldTypeKeyword},
+			},
+		},
+	}}
+	assert.NoError(t, metadata.CreateIndex(index))
+
+	gin.SetMode(gin.ReleaseMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = &http.Request{
+		URL:    &url.URL{RawQuery: "refresh=true"},
+		Header: make(http.Header),
+	}
+	c.Params = gin.Params{gin.Param{Key: "index", Value: name}}
+	c.Request.Header.Set("Content-Type", "application/json;charset=utf-8")
+	c.Request.Body = io.NopCloser(bytes.NewBufferString(
+		`{"documents": [{"name": "tatris"}, {"name": "tatris", "lang": "Go"}]}`,
+	))
+	IngestHandler(c)
+	// the rejected document does not fail the others
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+		Index: name,
+		Query: protocol.Query{MatchAll: &protocol.MatchAll{}},
+		Size:  0,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), resp.Hits.Total.Value)
+
+	// the rejected document is written into the dead-letter index
+	dlq := name + consts.DeadLetterIndexSuffix
+	assert.Eventually(t, func() bool {
+		dlqIndex, err := metadata.GetIndexExplicitly(dlq)
+		if err != nil {
+			return false
+		}
+		resp, err := query.SearchDocs([]*core.Index{dlqIndex}, protocol.QueryRequest{
+			Index: dlq,
+			Query: protocol.Query{
+				Term: protocol.Term{"error.type": "mapper_parsing_exception"},
+			},
+			Size: 10,
+		})
+		if err != nil || resp.Hits.Total.Value != 1 {
+			return false
+		}
+		source := resp.Hits.Hits[0].Source
+		text, ok := source["source"].(string)
+		return ok && source["index"] == name && strings.Contains(text, `"lang":"Go"`)
+	}, 10*time.Second, 100*time.Millisecond)
 }
 
 const ingestRequest = `{
@@ -0,0 +1,111 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package handler
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/core/ilm"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+// PutLifecyclePolicyHandler creates or replaces the lifecycle policy, the indexes attached to the
+// policy follow the new one from their current phases
+func PutLifecyclePolicyHandler(c *gin.Context) {
+	name := c.Param("policy")
+	request := &protocol.LifecyclePolicyRequest{}
+	if err := c.ShouldBind(request); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	if err := metadata.CheckLifecyclePolicy(request.Policy); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	request.Policy.Name = name
+	if err := metadata.SaveLifecyclePolicy(request.Policy); err != nil {
+		if errs.IsInvalidResourceNameError(err) {
+			BadRequest(c, err.Error())
+		} else {
+			InternalServerError(c, err.Error())
+		}
+	} else {
+		ACK(c)
+	}
+}
+
+// GetLifecyclePolicyHandler returns the policies matching the name, or all the policies if no name
+// is given
+func GetLifecyclePolicyHandler(c *gin.Context) {
+	name := c.Param("policy")
+	if name == "" {
+		name = consts.Asterisk
+	}
+	policies, err := metadata.ResolveLifecyclePolicies(name)
+	switch {
+	case errs.IsLifecyclePolicyNotFound(err) && name == consts.Asterisk:
+		// having no policy at all is not an error
+		OK(c, map[string]*protocol.LifecyclePolicyResponse{})
+	case errs.IsLifecyclePolicyNotFound(err):
+		NotFound(c, "lifecycle policy", name)
+	case err != nil:
+		InternalServerError(c, err.Error())
+	default:
+		response := make(map[string]*protocol.LifecyclePolicyResponse, len(policies))
+		for _, p := range policies {
+			// the name is the key of the response for compatibility with elasticsearch
+			response[p.Name] = &protocol.LifecyclePolicyResponse{
+				ModifiedDate: p.ModifiedDate,
+				Policy:       &protocol.LifecyclePolicy{Phases: p.Phases},
+			}
+		}
+		OK(c, response)
+	}
+}
+
+func DeleteLifecyclePolicyHandler(c *gin.Context) {
+	name := c.Param("policy")
+	if err := metadata.DeleteLifecyclePolicy(name); err != nil {
+		if errs.IsLifecyclePolicyNotFound(err) {
+			NotFound(c, "lifecycle policy", name)
+		} else {
+			InternalServerError(c, err.Error())
+		}
+	} else {
+		ACK(c)
+	}
+}
+
+// ExplainLifecycleHandler shows where the indexes are in their lifecycle policies
+func ExplainLifecycleHandler(c *gin.Context) {
+	name := c.Param("index")
+	indexes, err := metadata.ResolveIndexes(name)
+	if err != nil {
+		if ok, infErr := errs.IndexNotFound(err); ok {
+			NotFound(c, "index", infErr.Index)
+		} else {
+			InternalServerError(c, err.Error())
+		}
+		return
+	}
+	now := time.Now()
+	response := &protocol.LifecycleExplainResponse{
+		Indices: make(map[string]*protocol.LifecycleExplain, len(indexes)),
+	}
+	for _, index := range indexes {
+		explain := &protocol.LifecycleExplain{Index: index.Name}
+		if policy := index.Settings.LifecycleName(); policy != "" {
+			explain.Managed = true
+			explain.Policy = policy
+			explain.CreationDate = index.GetCreateTime()
+			explain.Age = ilm.Age(index, now).Milliseconds()
+			explain.LifecycleState = index.GetLifecycle()
+		}
+		response.Indices[index.Name] = explain
+	}
+	OK(c, response)
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+const lifecyclePolicyRequest = `{
+  "policy": {
+    "phases": {
+      "hot": {"actions": {"rollover": {"max_age": "1d", "max_docs": 100000}}},
+      "warm": {"min_age": "2d", "actions": {"forcemerge": {}, "migrate": {}}},
+      "delete": {"min_age": "7d", "actions": {"delete": {}}}
+    }
+  }
+}`
+
+func TestLifecycleHandler(t *testing.T) {
+	version := strings.ReplaceAll(
+		time.Now().Format(consts.TimeFmtWithoutSeparator),
+		consts.Dot,
+		consts.Empty,
+	)
+	policy := "policy_" + version
+	index := &core.Index{Index: &protocol.Index{
+		Name: "lifecycle_" + version + "-000001",
+		Settings: &protocol.Settings{
+			Lifecycle: &protocol.Lifecycle{Name: policy, RolloverAlias: "lifecycle_" + version},
+		},
+	}}
+	if err := metadata.CreateIndex(index); err != nil {
+		t.Fatalf("prepare index fail: %s", err.Error())
+	}
+	gin.SetMode(gin.ReleaseMode)
+
+	newContext := func(w *httptest.ResponseRecorder, body string) *gin.Context {
+		c, _ := gin.CreateTestContext(w)
+		c.Request = &http.Request{
+			URL:    &url.URL{},
+			Header: make(http.Header),
+		}
+		c.Params = gin.Params{
+			gin.Param{Key: "policy", Value: policy},
+			gin.Param{Key: "index", Value: index.Name},
+		}
+		c.Request.Header.Set("Content-Type", "application/json;charset=utf-8")
+		c.Request.Body = io.NopCloser(bytes.NewBufferString(body))
+		return c
+	}
+
+	t.Run("test_put_lifecycle_policy", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		PutLifecyclePolicyHandler(newContext(w, lifecyclePolicyRequest))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// rollover is only allowed in the hot phase
+		w = httptest.NewRecorder()
+		PutLifecyclePolicyHandler(newContext(
+			w,
+			`{"policy": {"phases": {"warm": {"actions": {"rollover": {"max_docs": 1}}}}}}`,
+		))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		// the segments being written are not migrated
+		w = httptest.NewRecorder()
+		PutLifecyclePolicyHandler(newContext(
+			w,
+			`{"policy": {"phases": {"hot": {"actions": {"migrate": {}}}}}}`,
+		))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = httptest.NewRecorder()
+		PutLifecyclePolicyHandler(newContext(
+			w,
+			`{"policy": {"phases": {"delete": {"min_age": "a week"}}}}`,
+		))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("test_get_lifecycle_policy", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		GetLifecyclePolicyHandler(newContext(w, ""))
+		assert.Equal(t, http.StatusOK, w.Code)
+		policies := make(map[string]*protocol.LifecyclePolicyResponse)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &policies))
+		assert.Contains(t, policies, policy)
+		assert.Equal(t, "7d", policies[policy].Policy.Phases.Delete.MinAge)
+	})
+
+	t.Run("test_explain_lifecycle", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ExplainLifecycleHandler(newContext(w, ""))
+		assert.Equal(t, http.StatusOK, w.Code)
+		response := &protocol.LifecycleExplainResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), response))
+		explain := response.Indices[index.Name]
+		assert.NotNil(t, explain)
+		assert.True(t, explain.Managed)
+		assert.Equal(t, policy, explain.Policy)
+		assert.Equal(t, index.GetCreateTime(), explain.CreationDate)
+	})
+
+	t.Run("test_delete_lifecycle_policy", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		DeleteLifecyclePolicyHandler(newContext(w, ""))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = httptest.NewRecorder()
+		GetLifecyclePolicyHandler(newContext(w, ""))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
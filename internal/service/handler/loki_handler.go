@@ -0,0 +1,56 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/input"
+	"github.com/tatris-io/tatris/internal/input/loki"
+)
+
+// LokiPushHandler receives the logs pushed by Promtail or Grafana Agent in the snappy-compressed
+// protobuf or JSON encoding of the Loki push API.
+// Each stream is ingested into the index chosen by config.Cfg.Input.Loki.IndexLabel, the labels
+// are mapped as keywords. Like Loki, the payload is decoded as protobuf unless it is declared as
+// JSON, and 204 is answered once all the entries are accepted.
+func LokiPushHandler(c *gin.Context) {
+	body, err := readBody(c)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	var req *loki.PushRequest
+	if c.ContentType() == contentTypeJSON {
+		req, err = loki.UnmarshalJSON(body)
+	} else {
+		req, err = loki.UnmarshalProto(body)
+	}
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	cfg := config.Cfg.Input.Loki
+	labels := req.Labels()
+	names, groups := req.Group(cfg.IndexLabel, cfg.DefaultIndex)
+	for _, name := range names {
+		err = input.Ingest(name, groups[name], labels...)
+		if errs.IsWalLagExceed(err) {
+			TooManyRequests(c, err.Error())
+			return
+		} else if errs.IsPipelineNotFound(err) || errs.IsProcessorError(err) ||
+			errs.IsInvalidResourceNameError(err) {
+			BadRequest(c, err.Error())
+			return
+		} else if err != nil {
+			InternalServerError(c, err.Error())
+			return
+		}
+	}
+	// the status is written right away since there is no body to write it along with
+	c.Status(http.StatusNoContent)
+	c.Writer.WriteHeaderNow()
+}
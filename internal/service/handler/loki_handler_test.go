@@ -0,0 +1,79 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/tatris-io/tatris/internal/query"
+)
+
+func TestLokiPushHandler(t *testing.T) {
+	version := strings.ReplaceAll(
+		time.Now().Format(consts.TimeFmtWithoutSeparator),
+		consts.Dot,
+		consts.Empty,
+	)
+	name := "loki_" + version
+	gin.SetMode(gin.ReleaseMode)
+
+	push := func(contentType string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = &http.Request{
+			Method: http.MethodPost,
+			URL:    &url.URL{},
+			Header: make(http.Header),
+			Body:   io.NopCloser(bytes.NewBufferString(body)),
+		}
+		c.Request.Header.Set("Content-Type", contentType)
+		LokiPushHandler(c)
+		return w
+	}
+
+	t.Run("test_loki_json", func(t *testing.T) {
+		// the entries are recent enough to be found by the default time range of the searches
+		now := time.Now().UnixNano()
+		w := push("application/json", fmt.Sprintf(`{"streams": [{
+			"stream": {"index": "%s", "job": "varlogs"},
+			"values": [
+				["%d", "payment failed"],
+				["%d", "payment retried"]
+			]
+		}]}`, name, now-int64(time.Second), now))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		index, err := metadata.GetIndexExplicitly(name)
+		assert.NoError(t, err)
+		assert.Equal(t, consts.MappingFieldTypeKeyword, index.Mappings.Properties["job"].Type)
+		assert.Eventually(t, func() bool {
+			resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+				Index: name,
+				Query: protocol.Query{Term: protocol.Term{"job": "varlogs"}},
+				Size:  0,
+			})
+			return err == nil && resp.Hits.Total.Value == 2
+		}, 10*time.Second, 100*time.Millisecond)
+	})
+
+	t.Run("test_loki_invalid", func(t *testing.T) {
+		w := push("application/x-protobuf", "not snappy")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = push("application/json", `{"streams": [{"values": [["now", "line"]]}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/input"
+	"github.com/tatris-io/tatris/internal/input/otlp"
+)
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+// OTLPLogsHandler receives the logs exported over OTLP/HTTP in protobuf or JSON, and ingests them
+// into the indexes rendered from config.Cfg.Input.OTLP.Index.
+// The response is encoded the same way as the request, 429 is answered if the WAL lags too much
+// so that the exporter retries later.
+func OTLPLogsHandler(c *gin.Context) {
+	contentType := c.ContentType()
+	if contentType != contentTypeProtobuf && contentType != contentTypeJSON {
+		c.JSON(http.StatusUnsupportedMediaType, nil)
+		return
+	}
+	body, err := readBody(c)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	var req *otlp.LogsRequest
+	if contentType == contentTypeProtobuf {
+		req, err = otlp.UnmarshalProto(body)
+	} else {
+		req, err = otlp.UnmarshalJSON(body)
+	}
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	names, groups := input.NewTarget(config.Cfg.Input.OTLP.Index).Group(req.Documents(time.Now()))
+	for _, name := range names {
+		err = input.Ingest(name, groups[name])
+		if errs.IsWalLagExceed(err) {
+			TooManyRequests(c, err.Error())
+			return
+		} else if errs.IsPipelineNotFound(err) || errs.IsProcessorError(err) ||
+			errs.IsInvalidResourceNameError(err) {
+			BadRequest(c, err.Error())
+			return
+		} else if err != nil {
+			InternalServerError(c, err.Error())
+			return
+		}
+	}
+	// an empty ExportLogsServiceResponse means all the records are accepted
+	if contentType == contentTypeProtobuf {
+		c.Data(http.StatusOK, contentTypeProtobuf, []byte{})
+	} else {
+		OK(c, struct{}{})
+	}
+}
+
+// readBody reads the request body, which may be compressed by gzip
+func readBody(c *gin.Context) ([]byte, error) {
+	reader := c.Request.Body
+	if c.GetHeader("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/core/config"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/tatris-io/tatris/internal/query"
+)
+
+// otlpLogsRequest returns the logs recorded just before now, which are recent enough to be found by
+// the default time range of the searches
+func otlpLogsRequest(now time.Time) string {
+	return fmt.Sprintf(`{
+  "resourceLogs": [{
+    "resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "Checkout"}}]},
+    "scopeLogs": [{
+      "logRecords": [
+        {"timeUnixNano": "%d", "body": {"stringValue": "payment failed"}},
+        {"timeUnixNano": "%d", "body": {"stringValue": "payment retried"}}
+      ]
+    }]
+  }]
+}`, now.Add(-time.Second).UnixNano(), now.UnixNano())
+}
+
+func TestOTLPLogsHandler(t *testing.T) {
+	version := strings.ReplaceAll(
+		time.Now().Format(consts.TimeFmtWithoutSeparator),
+		consts.Dot,
+		consts.Empty,
+	)
+	index := config.Cfg.Input.OTLP.Index
+	config.Cfg.Input.OTLP.Index = "otlp_" + version + "_{resource.service.name}"
+	defer func() { config.Cfg.Input.OTLP.Index = index }()
+	gin.SetMode(gin.ReleaseMode)
+
+	post := func(contentType string, body io.Reader, gzipped bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = &http.Request{
+			Method: http.MethodPost,
+			URL:    &url.URL{},
+			Header: make(http.Header),
+			Body:   io.NopCloser(body),
+		}
+		c.Request.Header.Set("Content-Type", contentType)
+		if gzipped {
+			c.Request.Header.Set("Content-Encoding", "gzip")
+		}
+		OTLPLogsHandler(c)
+		return w
+	}
+
+	t.Run("test_otlp_json", func(t *testing.T) {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, err := gz.Write([]byte(otlpLogsRequest(time.Now())))
+		assert.NoError(t, err)
+		assert.NoError(t, gz.Close())
+		w := post("application/json", &buf, true)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		name := "otlp_" + version + "_checkout"
+		assert.Eventually(t, func() bool {
+			index, err := metadata.GetIndexExplicitly(name)
+			if err != nil {
+				return false
+			}
+			resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+				Index: name,
+				Query: protocol.Query{MatchAll: &protocol.MatchAll{}},
+				Size:  0,
+			})
+			return err == nil && resp.Hits.Total.Value == 2
+		}, 10*time.Second, 100*time.Millisecond)
+	})
+
+	t.Run("test_otlp_invalid", func(t *testing.T) {
+		w := post("application/x-protobuf", bytes.NewBufferString("\x0a\xff"), false)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = post("text/plain", bytes.NewBufferString(otlpLogsRequest(time.Now())), false)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+}
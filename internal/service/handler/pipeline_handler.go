@@ -0,0 +1,76 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/common/errs"
+	"github.com/tatris-io/tatris/internal/ingestion/pipeline"
+	"github.com/tatris-io/tatris/internal/meta/metadata"
+	"github.com/tatris-io/tatris/internal/protocol"
+)
+
+// PutPipelineHandler creates or replaces the ingest pipeline, the pipeline is validated by
+// compiling it before it is saved
+func PutPipelineHandler(c *gin.Context) {
+	id := c.Param("id")
+	p := &protocol.Pipeline{}
+	if err := c.ShouldBind(p); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	p.ID = id
+	if _, err := pipeline.Compile(p); err != nil {
+		BadRequest(c, err.Error())
+	} else if err := metadata.SavePipeline(p); err != nil {
+		if errs.IsInvalidResourceNameError(err) {
+			BadRequest(c, err.Error())
+		} else {
+			InternalServerError(c, err.Error())
+		}
+	} else {
+		ACK(c)
+	}
+}
+
+// GetPipelineHandler returns the pipelines matching the id, or all the pipelines if no id is given
+func GetPipelineHandler(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		id = consts.Asterisk
+	}
+	pipelines, err := metadata.ResolvePipelines(id)
+	switch {
+	case errs.IsPipelineNotFound(err) && id == consts.Asterisk:
+		// having no pipeline at all is not an error
+		OK(c, map[string]*protocol.Pipeline{})
+	case errs.IsPipelineNotFound(err):
+		NotFound(c, "pipeline", id)
+	case err != nil:
+		InternalServerError(c, err.Error())
+	default:
+		response := make(map[string]*protocol.Pipeline, len(pipelines))
+		for _, p := range pipelines {
+			// the id is the key of the response for compatibility with elasticsearch
+			response[p.ID] = &protocol.Pipeline{
+				Description: p.Description,
+				Processors:  p.Processors,
+			}
+		}
+		OK(c, response)
+	}
+}
+
+func DeletePipelineHandler(c *gin.Context) {
+	id := c.Param("id")
+	if err := metadata.DeletePipeline(id); err != nil {
+		if errs.IsPipelineNotFound(err) {
+			NotFound(c, "pipeline", id)
+		} else {
+			InternalServerError(c, err.Error())
+		}
+	} else {
+		ACK(c)
+	}
+}
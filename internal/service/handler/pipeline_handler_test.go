@@ -0,0 +1,122 @@
+// Copyright 2023 Tatris Project Authors. Licensed under Apache-2.0.
+
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/tatris-io/tatris/internal/common/consts"
+	"github.com/tatris-io/tatris/internal/core"
+	"github.com/tatris-io/tatris/internal/protocol"
+	"github.com/tatris-io/tatris/internal/query"
+	"github.com/tatris-io/tatris/test/ut/prepare"
+)
+
+const pipelineRequest = `{
+  "description": "drop the java projects and tag the others",
+  "processors": [
+    {"drop": {"if": "ctx.lang == 'Java'"}},
+    {"lowercase": {"field": "lang", "ignore_missing": true}},
+    {"set": {"field": "tag", "value": "{{lang}}-project"}}
+  ]
+}`
+
+func TestPipelineHandler(t *testing.T) {
+	version := strings.ReplaceAll(
+		time.Now().Format(consts.TimeFmtWithoutSeparator),
+		consts.Dot,
+		consts.Empty,
+	)
+	index, err := prepare.CreateIndex(version)
+	if err != nil {
+		t.Fatalf("prepare index fail: %s", err.Error())
+	}
+	id := "pipeline_" + version
+	gin.SetMode(gin.ReleaseMode)
+
+	newContext := func(w *httptest.ResponseRecorder, query, body string) *gin.Context {
+		c, _ := gin.CreateTestContext(w)
+		c.Request = &http.Request{
+			URL:    &url.URL{RawQuery: query},
+			Header: make(http.Header),
+		}
+		c.Params = gin.Params{
+			gin.Param{Key: "id", Value: id},
+			gin.Param{Key: "index", Value: index.Name},
+		}
+		c.Request.Header.Set("Content-Type", "application/json;charset=utf-8")
+		c.Request.Body = io.NopCloser(bytes.NewBufferString(body))
+		return c
+	}
+
+	t.Run("test_put_pipeline", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		PutPipelineHandler(newContext(w, "", pipelineRequest))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = httptest.NewRecorder()
+		PutPipelineHandler(
+			newContext(w, "", `{"processors": [{"convert": {"field": "a", "type": "bigint"}}]}`),
+		)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("test_get_pipeline", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		GetPipelineHandler(newContext(w, "", ""))
+		assert.Equal(t, http.StatusOK, w.Code)
+		pipelines := make(map[string]*protocol.Pipeline)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &pipelines))
+		assert.Contains(t, pipelines, id)
+		assert.Len(t, pipelines[id].Processors, 3)
+	})
+
+	t.Run("test_ingest_with_pipeline", func(t *testing.T) {
+		ingestReq := protocol.IngestRequest{}
+		assert.NoError(t, json.Unmarshal([]byte(ingestRequest), &ingestReq))
+		kept := 0
+		for _, doc := range ingestReq.Documents {
+			if doc["lang"] != "Java" {
+				kept++
+			}
+		}
+		w := httptest.NewRecorder()
+		IngestHandler(newContext(w, "refresh=true&pipeline="+id, ingestRequest))
+		assert.Equal(t, http.StatusOK, w.Code)
+		resp, err := query.SearchDocs([]*core.Index{index}, protocol.QueryRequest{
+			Index: index.Name,
+			Query: protocol.Query{MatchAll: &protocol.MatchAll{}},
+			Size:  100,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(kept), resp.Hits.Total.Value)
+		for _, hit := range resp.Hits.Hits {
+			assert.NotEqual(t, "java", hit.Source["lang"])
+			assert.Equal(t, hit.Source["lang"].(string)+"-project", hit.Source["tag"])
+		}
+
+		w = httptest.NewRecorder()
+		IngestHandler(newContext(w, "pipeline=absent", ingestRequest))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("test_delete_pipeline", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		DeletePipelineHandler(newContext(w, "", ""))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = httptest.NewRecorder()
+		GetPipelineHandler(newContext(w, "", ""))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -73,6 +73,14 @@ func registerIngestion(group *gin.RouterGroup) {
 	group.POST("/:index/_bulk", handler.BulkHandler)
 	group.PUT("/_bulk", handler.BulkHandler)
 	group.POST("/_bulk", handler.BulkHandler)
+
+	group.PUT("/_ingest/pipeline/:id", handler.PutPipelineHandler)
+	group.GET("/_ingest/pipeline/:id", handler.GetPipelineHandler)
+	group.GET("/_ingest/pipeline", handler.GetPipelineHandler)
+	group.DELETE("/_ingest/pipeline/:id", handler.DeletePipelineHandler)
+
+	group.POST("/v1/logs", handler.OTLPLogsHandler)
+	group.POST("/loki/api/v1/push", handler.LokiPushHandler)
 }
 
 func registerQuery(group *gin.RouterGroup) {
@@ -123,6 +131,12 @@ func registerMeta(group *gin.RouterGroup) {
 	group.GET("/_index_template/:template", handler.GetIndexTemplateHandler)
 	group.DELETE("/_index_template/:template", handler.DeleteIndexTemplateHandler)
 	group.HEAD("/_index_template/:template", handler.IndexTemplateExistHandler)
+
+	group.PUT("/_ilm/policy/:policy", handler.PutLifecyclePolicyHandler)
+	group.GET("/_ilm/policy/:policy", handler.GetLifecyclePolicyHandler)
+	group.GET("/_ilm/policy", handler.GetLifecyclePolicyHandler)
+	group.DELETE("/_ilm/policy/:policy", handler.DeleteLifecyclePolicyHandler)
+	group.GET("/:index/_ilm/explain", handler.ExplainLifecycleHandler)
 }
 
 func addResponseHeader() gin.HandlerFunc {